@@ -0,0 +1,386 @@
+package gen
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A Change is a difference between two versions of a set of types that affects how they are
+// encoded. A change is breaking if data written by the old version may fail to decode, or decode
+// to different values, with the new version. With CompatOptions.Both, a change is also breaking
+// if data written by the new version may fail to decode with the old one.
+type Change struct {
+	Path     string // the type and the keys of the fields leading to the change, like Event.tags[]
+	Breaking bool
+	Message  string
+}
+
+func (c Change) String() string {
+	if c.Breaking {
+		return c.Path + ": " + c.Message + " (breaking)"
+	}
+	return c.Path + ": " + c.Message
+}
+
+// CompatOptions are the options of Compat.
+type CompatOptions struct {
+	// Unexported says to compare unexported types as well.
+	Unexported bool
+
+	// Both says that data written by the new version must also decode with the old version,
+	// so that changes the old version cannot read, such as widened numbers and added enum
+	// constants, are breaking too.
+	Both bool
+}
+
+// Compat compares the types in the source file, directory, or IDL file at oldPath with those at
+// newPath and returns the changes in how they are encoded, sorted by path. The changes flagged
+// as breaking are removed types, fields, and enum constants; renamed field keys that the new
+// field does not accept as an alias; changed field types, including the narrowing of numbers
+// and values that are no longer pointers; changed tuple lengths and field orders; and changed
+// struct layouts and enum encodings. Added types and fields are not breaking, since decoders
+// skip the fields they do not know. With opts.Both, widened numbers, values that became
+// pointers, added enum constants, and renamed keys are breaking as well.
+func Compat(oldPath, newPath string, opts CompatOptions) ([]Change, error) {
+	old, err := newSource(oldPath, &Options{Unexported: opts.Unexported})
+	if err != nil {
+		return nil, err
+	}
+	cur, err := newSource(newPath, &Options{Unexported: opts.Unexported})
+	if err != nil {
+		return nil, err
+	}
+	old.diags.print()
+	cur.diags.print()
+	c := &compatChecker{old: old, new: cur, both: opts.Both, seen: make(map[string]bool)}
+	for name, o := range old.identities {
+		n, ok := cur.identities[name]
+		if !ok {
+			c.report(name, true, "type removed")
+			continue
+		}
+		c.elem(name, o, n, true)
+	}
+	for name := range cur.identities {
+		if _, ok := old.identities[name]; !ok {
+			c.report(name, false, "type added")
+		}
+	}
+	sort.SliceStable(c.changes, func(i, j int) bool { return c.changes[i].Path < c.changes[j].Path })
+	return c.changes, nil
+}
+
+// Breaking says if any of the changes is breaking.
+func Breaking(changes []Change) bool {
+	for _, c := range changes {
+		if c.Breaking {
+			return true
+		}
+	}
+	return false
+}
+
+type compatChecker struct {
+	old, new *source
+	both     bool // whether changes that only the old version cannot read are breaking
+	changes  []Change
+	seen     map[string]bool // the pairs of differently named types already compared
+}
+
+func (c *compatChecker) report(path string, breaking bool, format string, args ...interface{}) {
+	c.changes = append(c.changes, Change{Path: path, Breaking: breaking, Message: fmt.Sprintf(format, args...)})
+}
+
+// elem compares the old and new versions of an element. Below the root, types that have the
+// same name in both versions are skipped because they are compared on their own.
+func (c *compatChecker) elem(path string, o, n Elem, root bool) {
+	if !root {
+		oname, nname := o.TypeName(), n.TypeName()
+		_, oident := c.old.identities[oname]
+		_, nident := c.new.identities[nname]
+		if oident && nident {
+			if oname == nname {
+				return
+			}
+			pair := oname + " " + nname
+			if c.seen[pair] {
+				return
+			}
+			c.seen[pair] = true
+			o, n = c.old.identities[oname], c.new.identities[nname]
+		}
+	}
+
+	switch o := o.(type) {
+	case *Struct:
+		if n, ok := n.(*Struct); ok {
+			c.structs(path, o, n)
+			return
+		}
+	case *Slice:
+		if n, ok := n.(*Slice); ok {
+			c.elem(path+"[]", o.Els, n.Els, false)
+			return
+		}
+	case *Array:
+		if n, ok := n.(*Array); ok {
+			if o.Size != n.Size {
+				c.report(path, true, "array length changed from %s to %s", o.Size, n.Size)
+			}
+			c.elem(path+"[]", o.Els, n.Els, false)
+			return
+		}
+	case *Map:
+		if n, ok := n.(*Map); ok {
+			c.elem(path+"{}", o.Value, n.Value, false)
+			return
+		}
+	case *Ptr:
+		if n, ok := n.(*Ptr); ok {
+			c.elem(path, o.Value, n.Value, false)
+			return
+		}
+		c.report(path, true, "no longer a pointer, so nil values cannot be decoded")
+		c.elem(path, o.Value, n, false)
+		return
+	case *BaseElem:
+		if n, ok := n.(*BaseElem); ok {
+			c.base(path, o, n)
+			return
+		}
+	}
+	if n, ok := n.(*Ptr); ok {
+		c.report(path, c.both, "now a pointer, so nil values cannot be decoded by the old version")
+		c.elem(path, o, n.Value, false)
+		return
+	}
+	c.report(path, true, "changed from %s to %s", wireKind(o), wireKind(n))
+}
+
+// wireKind describes how values of e are encoded.
+func wireKind(e Elem) string {
+	switch e := e.(type) {
+	case *Struct:
+		return "struct " + e.TypeName()
+	case *Slice:
+		return "slice"
+	case *Array:
+		return "array"
+	case *Map:
+		return "map"
+	case *Ptr:
+		return "pointer"
+	case *BaseElem:
+		if e.Value == IDENT {
+			return e.TypeName()
+		}
+		return primitiveType(e.Value)
+	}
+	return "unknown"
+}
+
+// primitiveType returns the Go type of the primitive p.
+func primitiveType(p primitive) string {
+	return (&BaseElem{Value: p}).BaseType()
+}
+
+func structLayout(s *Struct) string {
+	switch {
+	case s.AsTuple:
+		return "tuple"
+	case s.IntKeys:
+		return "intkeys"
+	}
+	return "map"
+}
+
+func (c *compatChecker) structs(path string, o, n *Struct) {
+	if ol, nl := structLayout(o), structLayout(n); ol != nl {
+		c.report(path, true, "layout changed from %s to %s", ol, nl)
+		return
+	}
+	if o.AsTuple {
+		c.tuples(path, o, n)
+		return
+	}
+
+	key := func(s *Struct, i int) string {
+		if s.IntKeys {
+			return strconv.FormatInt(s.Fields[i].fieldID, 10)
+		}
+		return s.Fields[i].fieldTag
+	}
+	newKeys := make(map[string]int, len(n.Fields))
+	for i := range n.Fields {
+		newKeys[key(n, i)] = i
+	}
+	matched := make(map[int]bool, len(n.Fields))
+	for i := range o.Fields {
+		k := key(o, i)
+		fpath := path + "." + k
+		j, ok := newKeys[k]
+		if !ok {
+			j = fieldWithAlias(n, k)
+			if j < 0 {
+				c.report(fpath, true, "field removed")
+				continue
+			}
+			c.report(fpath, c.both, "renamed to %s, which accepts the old key, but the old version ignores the new key", key(n, j))
+		}
+		matched[j] = true
+		c.elem(fpath, o.Fields[i].fieldElem, n.Fields[j].fieldElem, false)
+	}
+	for j := range n.Fields {
+		if !matched[j] {
+			c.report(path+"."+key(n, j), false, "field added")
+		}
+	}
+}
+
+// fieldWithAlias returns the index of the field of s that has the alias key, or -1.
+func fieldWithAlias(s *Struct, key string) int {
+	if s.IntKeys {
+		return -1
+	}
+	for i := range s.Fields {
+		for _, a := range s.Fields[i].aliases {
+			if a == key {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func (c *compatChecker) tuples(path string, o, n *Struct) {
+	if len(o.Fields) != len(n.Fields) {
+		c.report(path, true, "tuple length changed from %d to %d", len(o.Fields), len(n.Fields))
+	}
+	for i := 0; i < len(o.Fields) && i < len(n.Fields); i++ {
+		name := o.Fields[i].fieldName
+		fpath := path + "[" + strconv.Itoa(i) + "]"
+		if n.Fields[i].fieldName != name {
+			for j := range n.Fields {
+				if n.Fields[j].fieldName == name {
+					c.report(fpath, true, "field %s moved to position %d", name, j)
+					break
+				}
+			}
+		}
+		c.elem(fpath, o.Fields[i].fieldElem, n.Fields[i].fieldElem, false)
+	}
+}
+
+func (c *compatChecker) base(path string, o, n *BaseElem) {
+	oe, ne := c.old.enumOf(o), c.new.enumOf(n)
+	if oe != nil && ne != nil {
+		c.enums(path, oe, ne)
+		return
+	}
+	if o.Value == IDENT || n.Value == IDENT {
+		if o.Value != n.Value || o.TypeName() != n.TypeName() {
+			c.report(path, true, "changed from %s to %s", wireKind(o), wireKind(n))
+		}
+		return
+	}
+	if o.Value == n.Value {
+		return
+	}
+	if widens(o.Value, n.Value) {
+		c.report(path, c.both, "widened from %s to %s, which the old version cannot always decode", primitiveType(o.Value), primitiveType(n.Value))
+		return
+	}
+	if widens(n.Value, o.Value) {
+		c.report(path, true, "narrowed from %s to %s, which cannot hold every old value", primitiveType(o.Value), primitiveType(n.Value))
+		return
+	}
+	c.report(path, true, "changed from %s to %s", primitiveType(o.Value), primitiveType(n.Value))
+}
+
+// enumOf returns the enum that b is the shim of, or nil.
+func (s *source) enumOf(b *BaseElem) *enum {
+	if b.enumValues == "" {
+		return nil
+	}
+	for _, e := range s.enums {
+		if e.valuesVar() == b.enumValues {
+			return e
+		}
+	}
+	return nil
+}
+
+func (c *compatChecker) enums(path string, o, n *enum) {
+	if o.asString != n.asString {
+		c.report(path, true, "enum encoding changed")
+		return
+	}
+	have := make(map[string]bool, len(n.consts))
+	for _, name := range n.consts {
+		have[name] = true
+	}
+	var removed []string
+	for _, name := range o.consts {
+		if !have[name] {
+			removed = append(removed, name)
+		}
+		delete(have, name)
+	}
+	if len(removed) > 0 {
+		c.report(path, true, "enum constants removed: %s", strings.Join(removed, ", "))
+	}
+	if len(have) > 0 {
+		added := make([]string, 0, len(have))
+		for _, name := range n.consts {
+			if have[name] {
+				added = append(added, name)
+			}
+		}
+		c.report(path, c.both, "enum constants added: %s, which the old version rejects", strings.Join(added, ", "))
+	}
+}
+
+// widens says if every value of the primitive type o is a value of n, so that
+// n decodes whatever o encodes.
+func widens(o, n primitive) bool {
+	if o == Float32 && n == Float64 {
+		return true
+	}
+	obits, osigned, ok := intBits(o)
+	if !ok {
+		return false
+	}
+	nbits, nsigned, ok := intBits(n)
+	if !ok {
+		return false
+	}
+	if osigned == nsigned {
+		return nbits >= obits
+	}
+	return !osigned && nbits > obits
+}
+
+// intBits returns the size and signedness of the integer type p.
+func intBits(p primitive) (bits int, signed bool, ok bool) {
+	switch p {
+	case Int8:
+		return 8, true, true
+	case Int16:
+		return 16, true, true
+	case Int32:
+		return 32, true, true
+	case Int, Int64:
+		return 64, true, true
+	case Uint8, Byte:
+		return 8, false, true
+	case Uint16:
+		return 16, false, true
+	case Uint32:
+		return 32, false, true
+	case Uint, Uint64:
+		return 64, false, true
+	}
+	return 0, false, false
+}
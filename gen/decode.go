@@ -15,6 +15,8 @@ type decodeGen struct {
 	passes
 	p        printer
 	hasField bool
+	mask     string // the variable holding the msgp.FieldMask of the struct being decoded, if any
+	inPtr    bool   // the value being decoded is the value of a pointer
 }
 
 func (d *decodeGen) Method() Method { return Decode }
@@ -39,13 +41,33 @@ func (d *decodeGen) Execute(p Elem) error {
 	next(d, p)
 	d.p.nakedReturn()
 	unsetReceiver(p)
+	if st, ok := p.(*Struct); ok && st.FieldMask {
+		d.fields(st)
+	}
 	return d.p.err
 }
 
+// fields prints DecodeMsgFields, which decodes the fields of s selected by a msgp.FieldMask.
+func (d *decodeGen) fields(s *Struct) {
+	d.hasField = false
+	d.p.comment("DecodeMsgFields implements msgp.FieldsDecoder")
+	d.p.printf("\nfunc (%s %s) DecodeMsgFields(dc *msgp.Reader, mask msgp.FieldMask) (err error) {", s.Varname(), methodReceiver(s))
+	d.mask = "mask"
+	next(d, s)
+	d.mask = ""
+	d.p.nakedReturn()
+}
+
 func (d *decodeGen) gStruct(s *Struct) {
 	if !d.p.ok() {
 		return
 	}
+	if !s.FieldMask {
+		// The fields have no mask bits, so the struct is decoded completely.
+		mask := d.mask
+		d.mask = ""
+		defer func() { d.mask = mask }()
+	}
 	if s.AsTuple {
 		d.structAsTuple(s)
 	} else {
@@ -70,13 +92,33 @@ func (d *decodeGen) structAsTuple(s *Struct) {
 		if !d.p.ok() {
 			return
 		}
+		d.field(s, i)
+	}
+}
+
+// field prints the decoding of field i of s, which is skipped if the field is not selected
+// by the current mask.
+func (d *decodeGen) field(s *Struct, i int) {
+	mask := d.mask
+	if mask == "" || !maskable(s, i) {
+		d.mask = ""
 		next(d, s.Fields[i].fieldElem)
+		d.mask = mask
+		return
 	}
+	d.mask = d.p.maskedField(mask, s, i, "err = dc.Skip()")
+	next(d, s.Fields[i].fieldElem)
+	d.mask = mask
+	d.p.closeBlock()
 }
 
 func (d *decodeGen) structAsMap(s *Struct) {
 
-	if !d.hasField {
+	key := "field"
+	if s.IntKeys {
+		key = randIdent()
+		d.p.declare(key, "int64")
+	} else if !d.hasField {
 		d.p.declare("field", "[]byte")
 		d.hasField = true
 	}
@@ -90,11 +132,16 @@ func (d *decodeGen) structAsMap(s *Struct) {
 
 	d.p.printf("\nfor %s > 0 {", sz)
 	d.p.printf("\n%s--", sz)
-	d.assignAndCheck("field", mapKey)
-	d.p.print("\nswitch string(field) {")
+	if s.IntKeys {
+		d.assignAndCheck(key, "Int64")
+		d.p.printf("\nswitch %s {", key)
+	} else {
+		d.assignAndCheck("field", mapKey)
+		d.p.print("\nswitch string(field) {")
+	}
 	for i := range s.Fields {
-		d.p.printf("\ncase \"%s\":", s.Fields[i].fieldTag)
-		next(d, s.Fields[i].fieldElem)
+		d.p.printf("\ncase %s:", s.caseKeys(i))
+		d.field(s, i)
 		if !d.p.ok() {
 			return
 		}
@@ -123,17 +170,24 @@ func (d *decodeGen) gBase(b *BaseElem) {
 
 	vname := b.Varname()  // e.g. "z.FieldOne"
 	bname := b.BaseName() // e.g. "Float64"
+	if b.lenient {
+		bname += "Lenient"
+	}
 
 	// Handle special cases for object type.
 	switch b.Value {
 	case Bytes:
 		if b.Convert {
-			d.p.printf("\n%s, err = dc.ReadBytes([]byte(%s))", tmp, vname)
+			d.p.printf("\n%s, err = dc.Read%s([]byte(%s))", tmp, bname, vname)
 		} else {
-			d.p.printf("\n%s, err = dc.ReadBytes(%s)", vname, vname)
+			d.p.printf("\n%s, err = dc.Read%s(%s)", vname, bname, vname)
 		}
 	case IDENT:
-		d.p.printf("\nerr = %s.DecodeMsg(dc)", vname)
+		if d.mask != "" {
+			d.p.printf("\nerr = msgp.DecodeFields(dc, %s, %s)", fieldsRef(vname, d.inPtr), d.mask)
+		} else {
+			d.p.printf("\nerr = %s.DecodeMsg(dc)", vname)
+		}
 	case Ext:
 		d.p.printf("\nerr = dc.ReadExtension(%s)", vname)
 	default:
@@ -218,6 +272,8 @@ func (d *decodeGen) gPtr(p *Ptr) {
 	d.p.print(errCheck)
 	d.p.printf("\n%s = nil\n} else {", p.Varname())
 	d.p.initPtr(p)
+	_, d.inPtr = p.Value.(*BaseElem)
 	next(d, p.Value)
+	d.inPtr = false
 	d.p.closeBlock()
 }
@@ -0,0 +1,104 @@
+package gen
+
+import (
+	"fmt"
+	"go/token"
+	"os"
+	"strings"
+)
+
+// Severity is the severity of a Diagnostic.
+type Severity uint8
+
+const (
+	Warning Severity = iota // code is generated, but it may not be what was intended
+	Error                   // code is not generated
+)
+
+func (s Severity) String() string {
+	if s == Error {
+		return "error"
+	}
+	return "warning"
+}
+
+// A Diagnostic is a problem found in the source code.
+type Diagnostic struct {
+	Pos      token.Position // the position in the source, if it is known (otherwise only Pos.Filename is set)
+	Severity Severity
+	Path     string // the type and field names, like Event.Tags, if the problem is in a type
+	Message  string
+}
+
+// String returns the diagnostic in the form "file:line:col: severity: path: message".
+func (d Diagnostic) String() string {
+	var b strings.Builder
+	b.WriteString(d.Pos.String())
+	b.WriteString(": ")
+	b.WriteString(d.Severity.String())
+	b.WriteString(": ")
+	if d.Path != "" {
+		b.WriteString(d.Path)
+		b.WriteString(": ")
+	}
+	b.WriteString(d.Message)
+	return b.String()
+}
+
+// Diagnostics is a list of diagnostics. As an error it lists the diagnostics, one per line.
+type Diagnostics []Diagnostic
+
+func (ds Diagnostics) Error() string {
+	lines := make([]string, len(ds))
+	for i := range ds {
+		lines[i] = ds[i].String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Errors returns the diagnostics of Error severity.
+func (ds Diagnostics) Errors() Diagnostics {
+	var errs Diagnostics
+	for _, d := range ds {
+		if d.Severity == Error {
+			errs = append(errs, d)
+		}
+	}
+	return errs
+}
+
+// print writes the diagnostics to standard error, one per line.
+func (ds Diagnostics) print() {
+	for _, d := range ds {
+		fmt.Fprintln(os.Stderr, d)
+	}
+}
+
+// warn records a warning at pos, which may be token.NoPos.
+func (s *source) warn(pos token.Pos, format string, args ...interface{}) {
+	s.report(pos, Warning, format, args...)
+}
+
+// unsupported records that the field or type at pos is not supported, which is an error in
+// strict mode and a warning otherwise.
+func (s *source) unsupported(pos token.Pos, format string, args ...interface{}) {
+	sev := Warning
+	if s.strict {
+		sev = Error
+	}
+	s.report(pos, sev, format, args...)
+}
+
+func (s *source) report(pos token.Pos, sev Severity, format string, args ...interface{}) {
+	d := Diagnostic{
+		Pos:      token.Position{Filename: s.path},
+		Severity: sev,
+		Path:     strings.Join(s.names, "."),
+		Message:  fmt.Sprintf(format, args...),
+	}
+	// The positions in the Go code translated from an IDL file are not meaningful.
+	if pos.IsValid() && s.decls == nil {
+		d.Pos = s.fset.Position(pos)
+	}
+	s.diags = append(s.diags, d)
+}
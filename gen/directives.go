@@ -3,6 +3,8 @@ package gen
 import (
 	"fmt"
 	"go/ast"
+	"go/token"
+	"strconv"
 	"strings"
 )
 
@@ -18,9 +20,14 @@ type passDirective func(Method, []string, generatorSet) error
 // directives lists all recognized directives.
 // To add a directive, define a `directive` func and add it to this list.
 var directives = map[string]directive{
-	"shim":   applyShim,
-	"ignore": ignore,
-	"tuple":  astuple,
+	"shim":      applyShim,
+	"ignore":    ignore,
+	"tuple":     astuple,
+	"lenient":   lenient,
+	"strict":    strict,
+	"intkeys":   intkeys,
+	"enum":      applyEnum,
+	"fieldmask": fieldmask,
 }
 
 // passDirectives lists the directives that can be used with a named pass.
@@ -39,12 +46,19 @@ func passIgnore(m Method, typeNamePatterns []string, gs generatorSet) error {
 	return nil
 }
 
+// A dirComment is the text of a directive comment after the //msgp: prefix and the
+// position of the comment.
+type dirComment struct {
+	text string
+	pos  token.Pos
+}
+
 // getComments finds all comment lines that begin with //msgp:
-func getComments(c []*ast.CommentGroup) (comments []string) {
+func getComments(c []*ast.CommentGroup) (comments []dirComment) {
 	for _, cg := range c {
 		for _, line := range cg.List {
 			if strings.HasPrefix(line.Text, linePrefix) {
-				comments = append(comments, strings.TrimPrefix(line.Text, linePrefix))
+				comments = append(comments, dirComment{strings.TrimPrefix(line.Text, linePrefix), line.Pos()})
 			}
 		}
 	}
@@ -126,9 +140,150 @@ func astuple(text []string, s *source) error {
 				st.AsTuple = true
 				infoln(name)
 			} else {
-				warnf("%s: only structs can be tuples\n", name)
+				s.warn(s.dirPos, "%s: only structs can be tuples", name)
+			}
+		}
+	}
+	return nil
+}
+
+//msgp:intkeys {TypeA} {TypeB}...
+// The structs are encoded as maps keyed by their fields' integer IDs, which are given by the
+// "id=" tag option or by a tag that is an integer.
+func intkeys(text []string, s *source) error {
+	for _, item := range text[1:] {
+		name := strings.TrimSpace(item)
+		el, ok := s.identities[name]
+		if !ok {
+			s.warn(s.dirPos, "%s: cannot give unknown type integer keys", name)
+			continue
+		}
+		st, ok := el.(*Struct)
+		if !ok || st.AsTuple {
+			s.warn(s.dirPos, "%s: only structs encoded as maps can have integer keys", name)
+			continue
+		}
+		if err := s.setFieldIDs(st); err != nil {
+			return fmt.Errorf("%s: %s", name, err)
+		}
+		st.IntKeys = true
+		infoln(name)
+	}
+	return nil
+}
+
+// setFieldIDs sets the IDs of the fields in st that have only a numeric tag and checks that
+// each field has a unique ID.
+func (s *source) setFieldIDs(st *Struct) error {
+	seen := make(map[int64]string, len(st.Fields))
+	for i := range st.Fields {
+		f := &st.Fields[i]
+		if !f.hasID {
+			id, err := strconv.ParseInt(f.fieldTag, 10, 64)
+			if err != nil {
+				return fmt.Errorf("field %s has no integer ID", f.fieldName)
+			}
+			f.fieldID, f.hasID = id, true
+		}
+		if len(f.aliases) > 0 {
+			s.warn(s.dirPos, "%s: aliases are not used with integer keys", f.fieldName)
+		}
+		if other, ok := seen[f.fieldID]; ok {
+			return fmt.Errorf("fields %s and %s have the same ID %d", other, f.fieldName, f.fieldID)
+		}
+		seen[f.fieldID] = f.fieldName
+	}
+	return nil
+}
+
+//msgp:strict {TypeA} {TypeB}...
+// The UnmarshalMsg methods of the structs validate their input with msgp.Validate and all
+// the checks but msgp.RejectTrailingBytes before decoding. DecodeMsg is not affected, since
+// it cannot check an object in a stream before decoding it.
+func strict(text []string, s *source) error {
+	for _, item := range text[1:] {
+		name := strings.TrimSpace(item)
+		el, ok := s.identities[name]
+		if !ok {
+			s.warn(s.dirPos, "%s: cannot make unknown type strict", name)
+			continue
+		}
+		if st, ok := el.(*Struct); ok {
+			st.Strict = true
+			infoln(name)
+		} else {
+			s.warn(s.dirPos, "%s: only structs can be strict", name)
+		}
+	}
+	return nil
+}
+
+//msgp:fieldmask {TypeA} {TypeB}...
+// The structs get UnmarshalMsgFields and DecodeMsgFields methods, which decode only the
+// fields selected by a msgp.FieldMask, and a constant for the mask bit of each field.
+func fieldmask(text []string, s *source) error {
+	for _, item := range text[1:] {
+		name := strings.TrimSpace(item)
+		el, ok := s.identities[name]
+		if !ok {
+			s.warn(s.dirPos, "%s: cannot give unknown type a field mask", name)
+			continue
+		}
+		if st, ok := el.(*Struct); ok {
+			st.FieldMask = true
+			if len(st.Fields) > maxMaskFields {
+				s.warn(s.dirPos, "%s: only the first %d of its %d fields have mask bits; the others are always decoded",
+					name, maxMaskFields, len(st.Fields))
 			}
+			infoln(name)
+		} else {
+			s.warn(s.dirPos, "%s: only structs can have field masks", name)
+		}
+	}
+	return nil
+}
+
+//msgp:lenient {TypeA} {TypeB}...
+// The types are marked once inlining is done (see markLenient) so that the values
+// inlined into them are decoded leniently as well.
+func lenient(text []string, s *source) error {
+	for _, item := range text[1:] {
+		name := strings.TrimSpace(item)
+		if _, ok := s.identities[name]; !ok {
+			s.warn(s.dirPos, "%s: cannot make unknown type lenient", name)
+			continue
 		}
+		s.lenient = append(s.lenient, name)
+		infoln(name)
 	}
 	return nil
 }
+
+// markLenient marks the elements of the types named in lenient directives to be
+// decoded with msgp's lenient type conversions.
+func (s *source) markLenient() {
+	for _, name := range s.lenient {
+		if el, ok := s.identities[name]; ok {
+			setLenient(el)
+		}
+	}
+}
+
+func setLenient(e Elem) {
+	switch e := e.(type) {
+	case *BaseElem:
+		e.lenient = hasLenient(e.Value)
+	case *Struct:
+		for i := range e.Fields {
+			setLenient(e.Fields[i].fieldElem)
+		}
+	case *Array:
+		setLenient(e.Els)
+	case *Slice:
+		setLenient(e.Els)
+	case *Map:
+		setLenient(e.Value)
+	case *Ptr:
+		setLenient(e.Value)
+	}
+}
@@ -2,7 +2,10 @@ package gen
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
+
+	"github.com/dchenk/msgp/msgp"
 )
 
 var (
@@ -36,7 +39,7 @@ func randIdent() string {
 // 		name: "z",
 // 		Value: &Struct{
 // 			Name: "Marshaler",
-// 			Fields: []structField{
+// 			Fields: []StructField{
 // 				{
 // 					fieldTag: "thing1",
 // 					fieldElem: &Ptr{
@@ -85,9 +88,16 @@ const (
 	Int32
 	Int64
 	Bool
-	Intf // interface{}
-	Time // time.Time
-	Ext  // extension
+	Intf     // interface{}
+	Time     // time.Time
+	Ext      // extension
+	BigInt   // *big.Int
+	BigFloat // *big.Float
+	BigRat   // *big.Rat
+	Duration // time.Duration
+	IP       // net.IP
+	IPAddr   // netip.Addr
+	UUID     // msgp.UUID
 
 	IDENT // IDENT means an unrecognized identifier
 )
@@ -137,6 +147,20 @@ func (k primitive) String() string {
 		return "time.Time"
 	case Ext:
 		return "Extension"
+	case BigInt:
+		return "BigInt"
+	case BigFloat:
+		return "BigFloat"
+	case BigRat:
+		return "BigRat"
+	case Duration:
+		return "Duration"
+	case IP:
+		return "IP"
+	case IPAddr:
+		return "IPAddr"
+	case UUID:
+		return "UUID"
 	case IDENT:
 		return "Ident"
 	default:
@@ -169,6 +193,22 @@ var primitives = map[string]primitive{
 	"interface{}":    Intf,
 	"time.Time":      Time,
 	"msgp.Extension": Ext,
+	"*big.Int":       BigInt,
+	"*big.Float":     BigFloat,
+	"*big.Rat":       BigRat,
+	"time.Duration":  Duration,
+	"net.IP":         IP,
+	"netip.Addr":     IPAddr,
+	"msgp.UUID":      UUID,
+}
+
+// hasLenient says if the msgp package has lenient decoding functions for p.
+func hasLenient(p primitive) bool {
+	switch p {
+	case Bytes, String, Float32, Float64, Uint, Uint8, Uint16, Uint32, Uint64, Byte, Int, Int8, Int16, Int32, Int64:
+		return true
+	}
+	return false
 }
 
 // builtIns are types built into the library
@@ -176,6 +216,7 @@ var primitives = map[string]primitive{
 var builtIns = map[string]struct{}{
 	"msgp.Raw":    {},
 	"msgp.Number": {},
+	"msgp.Lazy":   {},
 }
 
 // common data/methods for every Elem
@@ -401,8 +442,33 @@ func (s *Ptr) NeedsInit() bool {
 // Struct represents a struct.
 type Struct struct {
 	common
-	Fields  []structField // field list
+	Fields  []StructField // field list
 	AsTuple bool          // write as an array instead of a map
+	IntKeys bool          // use the fields' integer IDs as map keys
+	Strict  bool          // validate input strictly in UnmarshalMsg
+
+	FieldMask bool // generate UnmarshalMsgFields and DecodeMsgFields
+}
+
+// fieldKey returns the encoded map key of field i.
+func (s *Struct) fieldKey(i int) []byte {
+	if s.IntKeys {
+		return msgp.AppendInt64(nil, s.Fields[i].fieldID)
+	}
+	return msgp.AppendString(nil, s.Fields[i].fieldTag)
+}
+
+// caseKeys returns the keys that decoders match to field i, for use in a case clause.
+func (s *Struct) caseKeys(i int) string {
+	f := &s.Fields[i]
+	if s.IntKeys {
+		return strconv.FormatInt(f.fieldID, 10)
+	}
+	keys := strconv.Quote(f.fieldTag)
+	for _, a := range f.aliases {
+		keys += ", " + strconv.Quote(a)
+	}
+	return keys
 }
 
 // TypeName returns the canonical Go type name.
@@ -430,7 +496,7 @@ func (s *Struct) SetVarname(a string) {
 // Copy returns a deep copy of the object.
 func (s *Struct) Copy() Elem {
 	g := *s
-	g.Fields = make([]structField, len(s.Fields))
+	g.Fields = make([]StructField, len(s.Fields))
 	copy(g.Fields, s.Fields)
 	for i := range s.Fields {
 		g.Fields[i].fieldElem = s.Fields[i].fieldElem.Copy()
@@ -447,15 +513,32 @@ func (s *Struct) Complexity() int {
 	return c
 }
 
-type structField struct {
-	fieldTag  string // the string inside the `msgp:""` tag
-	rawTag    string // the full tag (in case there are non-msgp keys)
-	fieldName string // the name of the struct field
-	fieldElem Elem   // the field type
+// A StructField is a field of a Struct.
+type StructField struct {
+	fieldTag  string   // the string inside the `msgp:""` tag
+	aliases   []string // other keys accepted when decoding (the tag's "alias=" option)
+	fieldID   int64    // the integer key (the tag's "id=" option or a numeric tag)
+	hasID     bool     // whether fieldID is set
+	lazyType  string   // the type a msgp.Lazy field decodes into (the tag's "lazy=" option)
+	rawTag    string   // the full tag (in case there are non-msgp keys)
+	fieldName string   // the name of the struct field
+	fieldElem Elem     // the field type
 }
 
+// Name returns the name of the field in the Go struct.
+func (sf *StructField) Name() string { return sf.fieldName }
+
+// Key returns the key of the field in the encoded map. Structs with integer keys use ID instead.
+func (sf *StructField) Key() string { return sf.fieldTag }
+
+// ID returns the integer key of the field and whether it has one.
+func (sf *StructField) ID() (int64, bool) { return sf.fieldID, sf.hasID }
+
+// Elem returns the type of the field.
+func (sf *StructField) Elem() Elem { return sf.fieldElem }
+
 // writeStructFields is a trampoline for writeBase for all of the fields in a struct.
-func writeStructFields(s []structField, structName string) {
+func writeStructFields(s []StructField, structName string) {
 	for i := range s {
 		s[i].fieldElem.SetVarname(fmt.Sprintf("%s.%s", structName, s[i].fieldName))
 	}
@@ -482,6 +565,9 @@ type BaseElem struct {
 	Convert      bool      // should we do an explicit conversion?
 	mustinline   bool      // must inline; not printable
 	needsref     bool      // needs reference for shim
+	lenient      bool      // decode with msgp's lenient type conversions
+	maxSize      int       // if not zero, the greatest encoded size of a shimmed value
+	enumValues   string    // for enum types, the name of the array of the type's constants
 }
 
 // Printable says if the element is printable.
@@ -568,6 +654,20 @@ func (s *BaseElem) BaseType() string {
 		return "time.Time"
 	case Ext:
 		return "msgp.Extension"
+	case BigInt:
+		return "*big.Int"
+	case BigFloat:
+		return "*big.Float"
+	case BigRat:
+		return "*big.Rat"
+	case Duration:
+		return "time.Duration"
+	case IP:
+		return "net.IP"
+	case IPAddr:
+		return "netip.Addr"
+	case UUID:
+		return "msgp.UUID"
 
 	// Everything else is base.String() with
 	// the first letter as lowercase.
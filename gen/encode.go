@@ -117,7 +117,7 @@ func (e *encodeGen) structAsMap(s *Struct) {
 		if !e.p.ok() {
 			return
 		}
-		data = msgp.AppendString(nil, s.Fields[i].fieldTag)
+		data = s.fieldKey(i)
 		e.p.printf("\n// write %q", s.Fields[i].fieldTag)
 		e.Fuse(data)
 		next(e, s.Fields[i].fieldElem)
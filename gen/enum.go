@@ -0,0 +1,325 @@
+package gen
+
+import (
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dchenk/msgp/msgp"
+)
+
+// An enum is an integer type named in an enum directive along with its named constants.
+type enum struct {
+	name     string           // the type name
+	base     string           // the Go type that values are encoded as
+	consts   []string         // the constants of the type, in declaration order
+	values   []constant.Value // the values of consts, if evalEnums has been called
+	asString bool             // whether values are encoded as the names of the constants
+}
+
+func (e *enum) encodeFunc() string { return "msgpEnumEncode" + e.name }
+func (e *enum) decodeFunc() string { return "msgpEnumDecode" + e.name }
+func (e *enum) valuesVar() string  { return "msgpEnum" + e.name + "Values" }
+func (e *enum) namesVar() string   { return "msgpEnum" + e.name + "Names" }
+
+// A constDecl is a constant declared in the package, in declaration order.
+type constDecl struct {
+	name string
+	typ  string // the name of the type, if it is given
+	ref  string // the constant whose type the constant has, if typ is not given
+}
+
+// getConsts records the constants declared in f. A constant is typed if its spec gives a type,
+// if its value is a conversion such as Color(1), or if it repeats the expression of a typed
+// spec (as with iota). A constant whose value is an expression of another constant, such as
+// Red or Red+1, has the type of that constant, which resolveConsts finds.
+func (s *source) getConsts(f *ast.File) {
+	for _, d := range f.Decls {
+		g, ok := d.(*ast.GenDecl)
+		if !ok || g.Tok != token.CONST {
+			continue
+		}
+		var typ, ref string
+		for _, spec := range g.Specs {
+			vs, ok := spec.(*ast.ValueSpec)
+			if !ok {
+				continue
+			}
+			switch {
+			case vs.Type != nil:
+				typ, ref = "", ""
+				if id, ok := vs.Type.(*ast.Ident); ok {
+					typ = id.Name
+				}
+			case len(vs.Values) > 0:
+				typ, ref = "", ""
+				if call, ok := vs.Values[0].(*ast.CallExpr); ok {
+					if id, ok := call.Fun.(*ast.Ident); ok {
+						typ = id.Name
+					}
+				} else {
+					ref = constRef(vs.Values[0])
+				}
+			}
+			if typ == "" && ref == "" {
+				continue
+			}
+			for _, n := range vs.Names {
+				if n.Name != "_" {
+					s.constDecls = append(s.constDecls, constDecl{name: n.Name, typ: typ, ref: ref})
+				}
+			}
+		}
+	}
+}
+
+// constRef returns the name of the constant that gives its type to the constant expression e,
+// or "" if there is none.
+func constRef(e ast.Expr) string {
+	switch e := e.(type) {
+	case *ast.Ident:
+		return e.Name
+	case *ast.ParenExpr:
+		return constRef(e.X)
+	case *ast.UnaryExpr:
+		return constRef(e.X)
+	case *ast.BinaryExpr:
+		if r := constRef(e.X); r != "" || e.Op == token.SHL || e.Op == token.SHR {
+			return r
+		}
+		return constRef(e.Y)
+	}
+	return ""
+}
+
+// resolveConsts records the names of the typed constants by type name in s.consts.
+func (s *source) resolveConsts() {
+	types := make(map[string]string, len(s.constDecls))
+	for _, c := range s.constDecls {
+		if c.typ != "" {
+			types[c.name] = c.typ
+		}
+	}
+	// A constant may refer to one declared after it, so repeat until nothing changes.
+	for changed := true; changed; {
+		changed = false
+		for _, c := range s.constDecls {
+			if _, ok := types[c.name]; ok || c.ref == "" {
+				continue
+			}
+			if t, ok := types[c.ref]; ok {
+				types[c.name] = t
+				changed = true
+			}
+		}
+	}
+	for _, c := range s.constDecls {
+		if t, ok := types[c.name]; ok {
+			s.consts[t] = append(s.consts[t], c.name)
+		}
+	}
+}
+
+// getPackageConsts records the constants declared in the other files of the package in the
+// directory of the file at path, which is not in the files given by getConsts.
+func (s *source) getPackageConsts(path string) error {
+	dir, name := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	skip := func(fi os.FileInfo) bool {
+		return fi.Name() != name && !strings.HasSuffix(fi.Name(), "_test.go")
+	}
+	pkgs, err := parser.ParseDir(token.NewFileSet(), dir, skip, 0)
+	if err != nil {
+		return err
+	}
+	if pkg, ok := pkgs[s.pkg]; ok {
+		for _, f := range sortedFiles(pkg) {
+			s.getConsts(f)
+		}
+	}
+	return nil
+}
+
+// evalEnums sets the values of the constants of the enums by type checking the package
+// of s, which the generated code does not need but a schema does.
+func (s *source) evalEnums() error {
+	if len(s.enums) == 0 {
+		return nil
+	}
+	fset := token.NewFileSet()
+	var files []*ast.File
+	if strings.HasSuffix(s.path, IDLExt) {
+		idl, err := parseIDLFile(s.path)
+		if err != nil {
+			return err
+		}
+		f, err := parser.ParseFile(fset, s.path, idl.goSource(), 0)
+		if err != nil {
+			return err
+		}
+		files = append(files, f)
+	} else {
+		dir := s.path
+		if stat, err := os.Stat(dir); err == nil && !stat.IsDir() {
+			dir = filepath.Dir(dir)
+		}
+		skip := func(fi os.FileInfo) bool { return !strings.HasSuffix(fi.Name(), "_test.go") }
+		pkgs, err := parser.ParseDir(fset, dir, skip, 0)
+		if err != nil {
+			return err
+		}
+		if pkg, ok := pkgs[s.pkg]; ok {
+			files = sortedFiles(pkg)
+		}
+	}
+	// Errors elsewhere in the package, such as imports that cannot be found, are ignored
+	// because the constants of an integer type do not depend on them.
+	conf := types.Config{Importer: importer.Default(), Error: func(error) {}}
+	pkg, _ := conf.Check(s.pkg, fset, files, nil)
+	for _, e := range s.enums {
+		e.values = make([]constant.Value, len(e.consts))
+		for i, name := range e.consts {
+			c, ok := pkg.Scope().Lookup(name).(*types.Const)
+			if !ok || c.Val().Kind() != constant.Int {
+				return fmt.Errorf("%s: cannot find the value of the constant %s", e.name, name)
+			}
+			e.values[i] = c.Val()
+		}
+	}
+	return nil
+}
+
+// sortedFiles returns the files of pkg in the order of their names.
+func sortedFiles(pkg *ast.Package) []*ast.File {
+	names := make([]string, 0, len(pkg.Files))
+	for n := range pkg.Files {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	files := make([]*ast.File, len(names))
+	for i, n := range names {
+		files[i] = pkg.Files[n]
+	}
+	return files
+}
+
+//msgp:enum {Type} [as:string|as:int]
+// The values of the integer type are encoded as the names of its constants (the default)
+// or as integers, and decoders reject values that are not constants of the type.
+func applyEnum(text []string, s *source) error {
+	if len(text) < 2 || len(text) > 3 {
+		return fmt.Errorf("enum directive should have 1 or 2 arguments; found %d", len(text)-1)
+	}
+	name := strings.TrimSpace(text[1])
+	asString := true
+	if len(text) == 3 {
+		switch mode := strings.TrimSpace(text[2]); mode {
+		case "as:string":
+		case "as:int":
+			asString = false
+		default:
+			return fmt.Errorf("invalid enum mode %q; expected as:string or as:int", mode)
+		}
+	}
+
+	el, ok := s.identities[name]
+	if !ok {
+		return fmt.Errorf("%s: cannot make unknown type an enum", name)
+	}
+	be, ok := el.(*BaseElem)
+	if !ok || !isInteger(be.Value) {
+		return fmt.Errorf("%s: only integer types can be enums", name)
+	}
+	consts := s.consts[name]
+	if len(consts) == 0 {
+		return fmt.Errorf("%s: no constants of the type found", name)
+	}
+
+	e := &enum{name: name, base: be.BaseType(), consts: consts, asString: asString}
+	shim := &BaseElem{
+		Value:        be.Value,
+		ShimMode:     Convert,
+		ShimToBase:   e.encodeFunc(),
+		ShimFromBase: e.decodeFunc(),
+		enumValues:   e.valuesVar(),
+	}
+	if asString {
+		shim.Value = String
+		e.base = "string"
+		for _, c := range consts {
+			if n := len(msgp.AppendString(nil, c)); n > shim.maxSize {
+				shim.maxSize = n
+			}
+		}
+	}
+	shim.Alias(name)
+	s.findShim(name, shim)
+	s.enums = append(s.enums, e)
+	infof("%s (%d constants)\n", name, len(consts))
+	return nil
+}
+
+func isInteger(p primitive) bool {
+	switch p {
+	case Uint, Uint8, Uint16, Uint32, Uint64, Byte, Int, Int8, Int16, Int32, Int64:
+		return true
+	}
+	return false
+}
+
+// printEnums writes the conversion functions of the enum types.
+// The constants are compared in a loop rather than in a switch because several
+// constants may have the same value; the first one declared is the one encoded.
+func (s *source) printEnums(w io.Writer) error {
+	sort.Slice(s.enums, func(i, j int) bool { return s.enums[i].name < s.enums[j].name })
+	p := printer{w: w}
+	for _, e := range s.enums {
+		values := e.valuesVar()
+		p.printf("\n// %s lists the constants of %s.", values, e.name)
+		p.printf("\nvar %s = [...]%s{%s}\n", values, e.name, strings.Join(e.consts, ", "))
+
+		if e.asString {
+			names := e.namesVar()
+			quoted := make([]string, len(e.consts))
+			for i, c := range e.consts {
+				quoted[i] = strconv.Quote(c)
+			}
+			p.printf("\n// %s lists the names of the constants of %s.", names, e.name)
+			p.printf("\nvar %s = [...]string{%s}\n", names, strings.Join(quoted, ", "))
+
+			p.printf("\n// %s returns the name of v.", e.encodeFunc())
+			p.printf("\nfunc %s(v %s) (string, error) {", e.encodeFunc(), e.name)
+			p.printf("\nfor i, c := range %s {\nif c == v {\nreturn %s[i], nil\n}\n}", values, names)
+			p.printf("\nreturn \"\", msgp.EnumError{Type: %q, Value: v}\n}\n", e.name)
+
+			p.printf("\n// %s returns the constant named s.", e.decodeFunc())
+			p.printf("\nfunc %s(s string) (%s, error) {", e.decodeFunc(), e.name)
+			p.printf("\nfor i, n := range %s {\nif n == s {\nreturn %s[i], nil\n}\n}", names, values)
+			p.printf("\nreturn 0, msgp.EnumError{Type: %q, Value: s}\n}\n", e.name)
+			continue
+		}
+
+		p.printf("\n// %s checks that v is a constant.", e.encodeFunc())
+		p.printf("\nfunc %s(v %s) (%s, error) {", e.encodeFunc(), e.name, e.base)
+		p.printf("\nfor _, c := range %s {\nif c == v {\nreturn %s(v), nil\n}\n}", values, e.base)
+		p.printf("\nreturn 0, msgp.EnumError{Type: %q, Value: v}\n}\n", e.name)
+
+		p.printf("\n// %s checks that v is the value of a constant.", e.decodeFunc())
+		p.printf("\nfunc %s(v %s) (%s, error) {", e.decodeFunc(), e.base, e.name)
+		p.printf("\nfor _, c := range %s {\nif c == %s(v) {\nreturn c, nil\n}\n}", values, e.name)
+		p.printf("\nreturn 0, msgp.EnumError{Type: %q, Value: v}\n}\n", e.name)
+	}
+	return p.err
+}
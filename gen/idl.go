@@ -0,0 +1,605 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"text/scanner"
+	"unicode"
+	"unicode/utf8"
+)
+
+// IDLExt is the file name extension of IDL files. Run, RunData, and Schema accept an IDL file
+// in place of a Go source file and generate the Go types it declares along with their methods.
+//
+// An IDL file declares a package and then messages (structs) and enums:
+//
+//  package events
+//
+//  // Level is the severity of an Event.
+//  enum Level as:string {
+//      Debug
+//      Info
+//      Error = 10
+//  }
+//
+//  // Event is a logged event.
+//  message Event intkeys strict {
+//      id       int64             = 1
+//      level    Level             = 2
+//      at       time              = 3
+//      tags     []string          = 4
+//      attrs    map[string]string = 5
+//      parent   *Event            = 6
+//  }
+//
+// A message may be followed by the options tuple, intkeys, strict, lenient, and fieldmask, which have
+// the meanings of the directives of the same names. Each field is on its own line and gives
+// the field's key and type, then "= ID" (required for intkeys messages) and "alias" followed
+// by the other keys that decoders accept, if it has them. A key that is not a name, such as
+// "user-id", is quoted. The Go name of a field is made of the letters and digits of its key
+// in CamelCase, so the keys user_id and "user-id" name the field UserID.
+//
+// The types are bool, string, bytes, byte, int, int8, int16, int32, int64, uint, uint8, uint16,
+// uint32, uint64, float32, float64, complex64, complex128, time, duration, any, the types of
+// the built-in extensions bigint (*big.Int), bigfloat, bigrat, ip (net.IP), ipaddr
+// (netip.Addr), and uuid (msgp.UUID), and the messages and enums of the file, along with
+// slices ([]T), arrays ([N]T), maps with string keys (map[string]T), and pointers (*T) of them.
+//
+// An enum may be followed by its integer Go type (int by default) and by as:string (the default)
+// or as:int, as with the enum directive. The constants are numbered from 0 unless given values.
+// Comments before a message, enum, field, or constant are copied to the Go declaration.
+const IDLExt = ".msgp"
+
+// idlTypes maps the names of the IDL's primitive types to Go types.
+var idlTypes = map[string]string{
+	"bool":       "bool",
+	"string":     "string",
+	"bytes":      "[]byte",
+	"byte":       "byte",
+	"int":        "int",
+	"int8":       "int8",
+	"int16":      "int16",
+	"int32":      "int32",
+	"int64":      "int64",
+	"uint":       "uint",
+	"uint8":      "uint8",
+	"uint16":     "uint16",
+	"uint32":     "uint32",
+	"uint64":     "uint64",
+	"float32":    "float32",
+	"float64":    "float64",
+	"complex64":  "complex64",
+	"complex128": "complex128",
+	"time":       "time.Time",
+	"duration":   "time.Duration",
+	"any":        "interface{}",
+	"bigint":     "*big.Int",
+	"bigfloat":   "*big.Float",
+	"bigrat":     "*big.Rat",
+	"ip":         "net.IP",
+	"ipaddr":     "netip.Addr",
+	"uuid":       "msgp.UUID",
+}
+
+// idlImports maps the names of the packages of the Go types in idlTypes to their paths.
+var idlImports = map[string]string{
+	"big":   "math/big",
+	"msgp":  "github.com/dchenk/msgp/msgp",
+	"net":   "net",
+	"netip": "net/netip",
+	"time":  "time",
+}
+
+// idlInitialisms lists the words of field keys that are written in upper case in Go names.
+var idlInitialisms = map[string]bool{
+	"api": true, "id": true, "ip": true, "json": true, "http": true, "uri": true, "url": true, "uuid": true,
+}
+
+// An idlFile is a parsed IDL file.
+type idlFile struct {
+	pkg     string
+	decls   []idlDecl
+	imports map[string]bool // the paths of the packages of the types used
+}
+
+// An idlDecl is a message or an enum.
+type idlDecl interface {
+	writeGo(b *bytes.Buffer)
+	directives() []string
+}
+
+type idlMessage struct {
+	doc     []string
+	name    string
+	options []string
+	fields  []idlField
+}
+
+type idlField struct {
+	doc     []string
+	key     string
+	name    string // the Go name
+	typ     string // the Go type
+	id      int64
+	hasID   bool
+	aliases []string
+}
+
+type idlEnum struct {
+	doc    []string
+	name   string
+	base   string
+	mode   string
+	consts []idlConst
+}
+
+type idlConst struct {
+	doc   []string
+	name  string
+	value int64
+}
+
+// parseIDLFile reads and parses the IDL file at path.
+func parseIDLFile(path string) (*idlFile, error) {
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseIDL(path, src)
+}
+
+// goSource returns a Go source file declaring the types of f, with the directives that give
+// them the encodings the IDL describes.
+func (f *idlFile) goSource() []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "package %s\n\n", f.pkg)
+	paths := make([]string, 0, len(f.imports))
+	for path := range f.imports {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		fmt.Fprintf(&b, "import %q\n", path)
+	}
+	b.WriteByte('\n')
+	for _, d := range f.decls {
+		for _, dir := range d.directives() {
+			b.WriteString(linePrefix + dir + "\n")
+		}
+	}
+	b.WriteByte('\n')
+	b.Write(f.goDecls())
+	return b.Bytes()
+}
+
+// goDecls returns the Go declarations of the types of f.
+func (f *idlFile) goDecls() []byte {
+	var b bytes.Buffer
+	for _, d := range f.decls {
+		d.writeGo(&b)
+	}
+	return b.Bytes()
+}
+
+func writeDoc(b *bytes.Buffer, doc []string) {
+	for _, line := range doc {
+		b.WriteString(line + "\n")
+	}
+}
+
+func (m *idlMessage) directives() []string {
+	dirs := make([]string, len(m.options))
+	for i, opt := range m.options {
+		dirs[i] = opt + " " + m.name
+	}
+	return dirs
+}
+
+func (m *idlMessage) writeGo(b *bytes.Buffer) {
+	writeDoc(b, m.doc)
+	fmt.Fprintf(b, "type %s struct {\n", m.name)
+	for _, f := range m.fields {
+		writeDoc(b, f.doc)
+		tag := f.key
+		if f.hasID {
+			tag += ",id=" + strconv.FormatInt(f.id, 10)
+		}
+		if len(f.aliases) > 0 {
+			tag += ",alias=" + strings.Join(f.aliases, "|")
+		}
+		fmt.Fprintf(b, "%s %s `msgp:%q`\n", f.name, f.typ, tag)
+	}
+	b.WriteString("}\n\n")
+}
+
+func (e *idlEnum) directives() []string {
+	return []string{"enum " + e.name + " " + e.mode}
+}
+
+func (e *idlEnum) writeGo(b *bytes.Buffer) {
+	writeDoc(b, e.doc)
+	fmt.Fprintf(b, "type %s %s\n\nconst (\n", e.name, e.base)
+	for _, c := range e.consts {
+		writeDoc(b, c.doc)
+		fmt.Fprintf(b, "%s %s = %d\n", c.name, e.name, c.value)
+	}
+	b.WriteString(")\n\n")
+}
+
+// An idlParser parses an IDL file. Newlines are tokens because each field and constant is on
+// its own line. Errors are raised with a panic of an idlError and recovered by parseIDL.
+type idlParser struct {
+	sc    scanner.Scanner
+	tok   rune
+	doc   []string // the comments read since the last declaration, field, or constant
+	file  *idlFile
+	names map[string]scanner.Position // the declared types and constants
+	types map[string]bool             // the declared types
+	refs  []idlRef                    // the uses of declared types
+}
+
+// An idlRef is a use of a declared type, which is checked once the whole file is parsed.
+type idlRef struct {
+	name string
+	pos  scanner.Position
+}
+
+type idlError struct{ err error }
+
+// parseIDL parses the IDL file named filename with the contents src.
+func parseIDL(filename string, src []byte) (f *idlFile, err error) {
+	p := &idlParser{
+		file:  &idlFile{imports: make(map[string]bool)},
+		names: make(map[string]scanner.Position),
+		types: make(map[string]bool),
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(idlError)
+			if !ok {
+				panic(r)
+			}
+			err = e.err
+		}
+	}()
+
+	p.sc.Init(bytes.NewReader(src))
+	p.sc.Filename = filename
+	p.sc.Mode = scanner.ScanIdents | scanner.ScanInts | scanner.ScanStrings | scanner.ScanComments
+	p.sc.Whitespace = 1<<'\t' | 1<<'\r' | 1<<' '
+	p.sc.Error = func(s *scanner.Scanner, msg string) {
+		p.errorAt(s.Pos(), "%s", msg)
+	}
+
+	p.next()
+	p.skipNewlines()
+	p.keyword("package")
+	p.file.pkg = p.ident()
+	p.endLine()
+	for p.tok != scanner.EOF {
+		switch p.sc.TokenText() {
+		case "message":
+			p.file.decls = append(p.file.decls, p.message())
+		case "enum":
+			p.file.decls = append(p.file.decls, p.enum())
+		default:
+			p.errorf("expected message or enum; found %s", p.describe())
+		}
+	}
+	for _, r := range p.refs {
+		if !p.types[r.name] {
+			p.errorAt(r.pos, "undefined type %s", r.name)
+		}
+	}
+	return p.file, nil
+}
+
+func (p *idlParser) errorAt(pos scanner.Position, format string, args ...interface{}) {
+	panic(idlError{fmt.Errorf("%s: %s", pos, fmt.Sprintf(format, args...))})
+}
+
+func (p *idlParser) errorf(format string, args ...interface{}) {
+	p.errorAt(p.sc.Position, format, args...)
+}
+
+// describe returns a description of the current token for error messages.
+func (p *idlParser) describe() string {
+	switch p.tok {
+	case scanner.EOF:
+		return "end of file"
+	case '\n':
+		return "newline"
+	}
+	return strconv.Quote(p.sc.TokenText())
+}
+
+// next reads the next token, collecting the comments before it.
+func (p *idlParser) next() {
+	p.tok = p.sc.Scan()
+	for p.tok == scanner.Comment {
+		text := p.sc.TokenText()
+		if !strings.HasPrefix(text, "//") {
+			p.errorf("only // comments are allowed")
+		}
+		p.doc = append(p.doc, text)
+		p.tok = p.sc.Scan()
+	}
+}
+
+// takeDoc returns the comments collected since the last call.
+func (p *idlParser) takeDoc() []string {
+	doc := p.doc
+	p.doc = nil
+	return doc
+}
+
+func (p *idlParser) skipNewlines() {
+	for p.tok == '\n' {
+		p.next()
+	}
+}
+
+// endLine reads the end of a line and any blank lines that follow. A comment at the end of
+// the line is dropped rather than being taken as the doc of what follows.
+func (p *idlParser) endLine() {
+	if p.tok != '\n' && p.tok != scanner.EOF {
+		p.errorf("expected newline; found %s", p.describe())
+	}
+	p.doc = nil
+	p.skipNewlines()
+}
+
+func (p *idlParser) expect(tok rune) {
+	if p.tok != tok {
+		p.errorf("expected %q; found %s", tok, p.describe())
+	}
+	p.next()
+}
+
+func (p *idlParser) keyword(kw string) {
+	if p.tok != scanner.Ident || p.sc.TokenText() != kw {
+		p.errorf("expected %s; found %s", kw, p.describe())
+	}
+	p.next()
+}
+
+func (p *idlParser) ident() string {
+	if p.tok != scanner.Ident {
+		p.errorf("expected a name; found %s", p.describe())
+	}
+	name := p.sc.TokenText()
+	p.next()
+	return name
+}
+
+// key reads the key of a field, which is a name or a quoted string.
+func (p *idlParser) key() string {
+	if p.tok != scanner.String {
+		return p.ident()
+	}
+	// Commas and bars separate the options of a tag and backquotes end it.
+	key, err := strconv.Unquote(p.sc.TokenText())
+	if err != nil || key == "" || strings.ContainsAny(key, ",|`") {
+		p.errorf("invalid key %s", p.sc.TokenText())
+	}
+	p.next()
+	return key
+}
+
+// int reads an integer, which may be negative.
+func (p *idlParser) int() int64 {
+	neg := p.tok == '-'
+	if neg {
+		p.next()
+	}
+	if p.tok != scanner.Int {
+		p.errorf("expected an integer; found %s", p.describe())
+	}
+	text := p.sc.TokenText()
+	if neg {
+		text = "-" + text
+	}
+	n, err := strconv.ParseInt(text, 0, 64)
+	if err != nil {
+		p.errorf("invalid integer %s", text)
+	}
+	p.next()
+	return n
+}
+
+// declare reads the name of a message or enum.
+func (p *idlParser) declare() string {
+	pos := p.sc.Position
+	name := p.ident()
+	if !ast.IsExported(name) {
+		p.errorAt(pos, "type name %s must begin with an upper-case letter", name)
+	}
+	if _, ok := idlTypes[name]; ok {
+		p.errorAt(pos, "type name %s is reserved", name)
+	}
+	if prev, ok := p.names[name]; ok {
+		p.errorAt(pos, "%s redeclared; previous declaration at %s", name, prev)
+	}
+	p.names[name] = pos
+	p.types[name] = true
+	return name
+}
+
+// block reads the opening brace of a declaration's body.
+func (p *idlParser) block() {
+	p.expect('{')
+	p.endLine()
+}
+
+func (p *idlParser) message() *idlMessage {
+	m := &idlMessage{doc: p.takeDoc()}
+	p.next()
+	m.name = p.declare()
+	for p.tok == scanner.Ident {
+		switch opt := p.sc.TokenText(); opt {
+		case "tuple", "intkeys", "strict", "lenient", "fieldmask":
+			m.options = append(m.options, opt)
+		default:
+			p.errorf("unknown message option %s", opt)
+		}
+		p.next()
+	}
+	p.block()
+
+	keys := make(map[string]bool)
+	names := make(map[string]bool)
+	ids := make(map[int64]bool)
+	intKeys := false
+	for _, opt := range m.options {
+		intKeys = intKeys || opt == "intkeys"
+	}
+	for p.tok != '}' {
+		pos := p.sc.Position
+		f := idlField{doc: p.takeDoc(), key: p.key()}
+		if f.name = goFieldName(f.key); !token.IsIdentifier(f.name) || !ast.IsExported(f.name) {
+			p.errorAt(pos, "cannot make an exported Go name of field %s", f.key)
+		}
+		if keys[f.key] || names[f.name] {
+			p.errorAt(pos, "duplicate field %s", f.key)
+		}
+		keys[f.key], names[f.name] = true, true
+		f.typ = p.typ()
+		if p.tok == '=' {
+			p.next()
+			f.id, f.hasID = p.int(), true
+			if ids[f.id] {
+				p.errorAt(pos, "duplicate field ID %d", f.id)
+			}
+			ids[f.id] = true
+		} else if intKeys {
+			p.errorAt(pos, "field %s of an intkeys message has no ID", f.key)
+		}
+		if p.tok == scanner.Ident && p.sc.TokenText() == "alias" {
+			p.next()
+			for p.tok == scanner.Ident || p.tok == scanner.String {
+				f.aliases = append(f.aliases, p.key())
+			}
+		}
+		p.endLine()
+		m.fields = append(m.fields, f)
+	}
+	p.next()
+	p.endLine()
+	return m
+}
+
+func (p *idlParser) enum() *idlEnum {
+	e := &idlEnum{doc: p.takeDoc(), base: "int", mode: "as:string"}
+	p.next()
+	e.name = p.declare()
+	if p.tok == scanner.Ident && p.sc.TokenText() != "as" {
+		e.base = p.ident()
+		if prim, ok := primitives[e.base]; !ok || !isInteger(prim) {
+			p.errorf("enum %s must have an integer type, not %s", e.name, e.base)
+		}
+	}
+	if p.tok == scanner.Ident {
+		p.keyword("as")
+		p.expect(':')
+		switch mode := p.ident(); mode {
+		case "string", "int":
+			e.mode = "as:" + mode
+		default:
+			p.errorf("invalid enum mode as:%s; expected as:string or as:int", mode)
+		}
+	}
+	p.block()
+
+	var value int64
+	for p.tok != '}' {
+		pos := p.sc.Position
+		c := idlConst{doc: p.takeDoc(), name: p.ident()}
+		if !ast.IsExported(c.name) {
+			p.errorAt(pos, "constant name %s must begin with an upper-case letter", c.name)
+		}
+		if prev, ok := p.names[c.name]; ok {
+			p.errorAt(pos, "%s redeclared; previous declaration at %s", c.name, prev)
+		}
+		p.names[c.name] = pos
+		if p.tok == '=' {
+			p.next()
+			value = p.int()
+		}
+		c.value = value
+		value++
+		p.endLine()
+		e.consts = append(e.consts, c)
+	}
+	if len(e.consts) == 0 {
+		p.errorf("enum %s has no constants", e.name)
+	}
+	p.next()
+	p.endLine()
+	return e
+}
+
+// typ reads a type and returns it as a Go type.
+func (p *idlParser) typ() string {
+	switch p.tok {
+	case '*':
+		p.next()
+		return "*" + p.typ()
+	case '[':
+		p.next()
+		if p.tok == ']' {
+			p.next()
+			return "[]" + p.typ()
+		}
+		pos := p.sc.Position
+		n := p.int()
+		if n < 0 {
+			p.errorAt(pos, "negative array length")
+		}
+		p.expect(']')
+		return "[" + strconv.FormatInt(n, 10) + "]" + p.typ()
+	case scanner.Ident:
+		pos := p.sc.Position
+		name := p.ident()
+		if name == "map" {
+			p.expect('[')
+			if key := p.ident(); key != "string" {
+				p.errorAt(pos, "map keys must be strings, not %s", key)
+			}
+			p.expect(']')
+			return "map[string]" + p.typ()
+		}
+		if t, ok := idlTypes[name]; ok {
+			if i := strings.IndexByte(t, '.'); i >= 0 {
+				p.file.imports[idlImports[strings.TrimPrefix(t[:i], "*")]] = true
+			}
+			return t
+		}
+		p.refs = append(p.refs, idlRef{name: name, pos: pos})
+		return name
+	}
+	p.errorf("expected a type; found %s", p.describe())
+	return ""
+}
+
+// goFieldName returns the CamelCase Go name of a field with the given key.
+// The characters other than letters and digits separate the words.
+func goFieldName(key string) string {
+	words := strings.FieldsFunc(key, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+	var b strings.Builder
+	for _, word := range words {
+		if idlInitialisms[strings.ToLower(word)] {
+			b.WriteString(strings.ToUpper(word))
+		} else {
+			r, n := utf8.DecodeRuneInString(word)
+			b.WriteRune(unicode.ToUpper(r))
+			b.WriteString(word[n:])
+		}
+	}
+	return b.String()
+}
@@ -1,5 +1,7 @@
 package gen
 
+import "go/token"
+
 // This file defines when and how we propagate type information
 // from one type declaration to another. After the processing pass,
 // every non-primitive type is marshalled/unmarshalled/etc through
@@ -112,7 +114,9 @@ func (s *source) nextInline(ref *Elem, root string) {
 			} else if !ok && !el.Resolved() {
 				// At this point we are sure that we've got a type that is neither
 				// a primitive, a library builtin, nor a processed type.
-				warnf("Unresolved identifier: %s\n", typ)
+				s.names = []string{root}
+				s.warn(token.NoPos, "unresolved identifier %s", typ)
+				s.names = nil
 			}
 		}
 	case *Struct:
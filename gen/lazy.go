@@ -0,0 +1,51 @@
+package gen
+
+import "io"
+
+func lazies(w io.Writer) *lazyGen {
+	return &lazyGen{
+		p: printer{w: w},
+	}
+}
+
+// lazyGen prints the accessors of the msgp.Lazy fields that have the type they decode into
+// set with the "lazy=" tag option.
+type lazyGen struct {
+	passes
+	p printer
+}
+
+// Method says that the accessors go with both UnmarshalMsg and DecodeMsg, which fill the fields.
+func (l *lazyGen) Method() Method { return Decode | Unmarshal }
+
+func (l *lazyGen) Execute(p Elem) error {
+	if !l.p.ok() {
+		return l.p.err
+	}
+	if e := l.applyAll(p); e != nil {
+		p = e
+	}
+	s, ok := p.(*Struct)
+	if !ok {
+		return nil
+	}
+	for i := range s.Fields {
+		if s.Fields[i].lazyType != "" {
+			l.accessor(s, &s.Fields[i])
+		}
+	}
+	return l.p.err
+}
+
+// accessor prints the method that returns field sf of s decoded into its lazy type. The decoded
+// value is kept in the field, so changes made to it are encoded.
+func (l *lazyGen) accessor(s *Struct, sf *StructField) {
+	field := s.Varname() + "." + sf.fieldName
+	l.p.printf("\n\n// %sValue returns the %s field decoded into a %s.", sf.fieldName, sf.fieldName, sf.lazyType)
+	l.p.print("\n// The value is decoded on the first call and kept in the field. It is nil if the field holds nil.")
+	l.p.printf("\nfunc (%s %s) %sValue() (*%s, error) {", s.Varname(), methodReceiver(s), sf.fieldName, sf.lazyType)
+	l.p.printf("\nif v, ok := %s.Value().(*%s); ok {\nreturn v, nil\n}", field, sf.lazyType)
+	l.p.printf("\nv := new(%s)", sf.lazyType)
+	l.p.printf("\nif err := %s.Decode(v); err != nil || !%s.Decoded() {\nreturn nil, err\n}", field, field)
+	l.p.printf("\n%s.Set(v)\nreturn v, nil\n}", field)
+}
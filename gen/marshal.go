@@ -110,9 +110,9 @@ func (m *marshalGen) mapstruct(s *Struct) {
 		if !m.p.ok() {
 			return
 		}
-		data = msgp.AppendString(nil, s.Fields[i].fieldTag)
+		data = s.fieldKey(i)
 
-		m.p.printf("\n// string %q", s.Fields[i].fieldTag)
+		m.p.printf("\n// key %q", s.Fields[i].fieldTag)
 		m.Fuse(data)
 
 		next(m, s.Fields[i].fieldElem)
@@ -0,0 +1,101 @@
+package gen
+
+import "io"
+
+// maxMaskFields is the number of fields of a struct that have bits in a msgp.FieldMask.
+const maxMaskFields = 64
+
+func masks(w io.Writer) *maskGen {
+	return &maskGen{
+		p: printer{w: w},
+	}
+}
+
+// maskGen prints the constants for the mask bits of the fields of the structs with field masks.
+type maskGen struct {
+	passes
+	p printer
+}
+
+// Method says that the constants go with both UnmarshalMsgFields and DecodeMsgFields.
+func (m *maskGen) Method() Method { return Decode | Unmarshal }
+
+func (m *maskGen) Execute(p Elem) error {
+	if !m.p.ok() {
+		return m.p.err
+	}
+	// The constants are printed even if one of the methods is ignored, since the other may use them.
+	if e := m.applyAll(p); e != nil {
+		p = e
+	}
+	s, ok := p.(*Struct)
+	if !ok || !s.FieldMask {
+		return nil
+	}
+
+	m.p.printf("\n\n// The bits of the fields of %s in a msgp.FieldMask.\nconst (", s.TypeName())
+	for i := range s.Fields {
+		if i == maxMaskFields {
+			break
+		}
+		m.p.printf("\n%s uint64 = 1 << %d", s.maskBit(i), i)
+	}
+	m.p.print("\n)")
+	return m.p.err
+}
+
+// maskBit returns the name of the constant for the mask bit of field i.
+func (s *Struct) maskBit(i int) string {
+	return s.TypeName() + "Field" + s.Fields[i].fieldName
+}
+
+// hasNestedMask says if a sub-mask applies to e, which is the case if e is or holds a struct
+// with field masks or a named type that may have them.
+func hasNestedMask(e Elem) bool {
+	switch e := e.(type) {
+	case *Struct:
+		return e.FieldMask && len(e.Fields) > 0
+	case *Ptr:
+		return hasNestedMask(e.Value)
+	case *Slice:
+		return hasNestedMask(e.Els)
+	case *Array:
+		return hasNestedMask(e.Els)
+	case *Map:
+		return hasNestedMask(e.Value)
+	case *BaseElem:
+		return e.Value == IDENT
+	}
+	return false
+}
+
+// maskedField prints the start of the code that decodes field i of s if it is selected by mask
+// and runs skip otherwise. The code that decodes the field must be followed by closeBlock.
+// It returns the name of the variable holding the mask for the structs in the field, or "" if
+// the field holds none.
+func (p *printer) maskedField(mask string, s *Struct, i int, skip string) string {
+	bit := s.maskBit(i)
+	p.printf("\nif !%s.Has(%s) {\n%s", mask, bit, skip)
+	p.print(errCheck)
+	p.print("\n} else {")
+	if !hasNestedMask(s.Fields[i].fieldElem) {
+		return ""
+	}
+	sub := randIdent()
+	p.printf("\n%s := %s.Sub(%s)", sub, mask, bit)
+	return sub
+}
+
+// maskable says if field i of s has a mask bit.
+func maskable(s *Struct, i int) bool {
+	return s.FieldMask && i < maxMaskFields
+}
+
+// fieldsRef returns the argument of msgp.UnmarshalFields or msgp.DecodeFields for the named
+// value vname, which is a pointer if inPtr is set.
+func fieldsRef(vname string, inPtr bool) string {
+	if inPtr {
+		return vname
+	}
+	return "&" + vname
+}
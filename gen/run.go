@@ -13,29 +13,90 @@
 //
 //  err := gen.Run("path/to/my_file.go", gen.Size|gen.Marshal|gen.Unmarshal|gen.Test, false)
 //
+// To generate more code for the same types, implement Generator and run the generator with Options:
+//
+//  opts := gen.Options{Mode: gen.Size | gen.Marshal | gen.Unmarshal, Generators: []func(out, tests io.Writer) gen.Generator{newCopyGen}}
+//  err := opts.Run("path/to/my_file.go", "")
+//
 package gen
 
 import (
 	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/ttacon/chalk"
 	"golang.org/x/tools/imports"
 )
 
+// Options are the settings of a run of the code generator. Besides the methods to generate, they
+// can add generators, transformation passes, and directives of your own, so that programs importing
+// this package can generate more code for the same types without changing the package.
+type Options struct {
+	// Mode is the set of Method types and tests to generate.
+	Mode Method
+
+	// Unexported says whether code is generated for unexported as well as for exported types.
+	Unexported bool
+
+	// Strict says whether unsupported fields and types are errors rather than warnings.
+	Strict bool
+
+	// Generators create generators that print code for each type after the built-in ones do.
+	// They print to out, the generated file, and to tests, the generated test file, which is
+	// nil unless Mode includes Test.
+	Generators []func(out, tests io.Writer) Generator
+
+	// Passes are added to every generator, built in or not, before the directives are applied.
+	Passes []TransformPass
+
+	// Directives maps the names of directives to their handlers. For example, a handler
+	// named "deepcopy" is called for each //msgp:deepcopy comment. Using the name of a
+	// built-in directive or of a method (such as "encode") is an error.
+	Directives map[string]DirectiveHandler
+
+	// Imports are the paths of packages, other than msgp and those imported by the source,
+	// to import in the generated file.
+	Imports []string
+
+	// Report is called with each problem found in the source. If it is nil, the problems are
+	// printed to standard error in the form file:line:col: severity: message.
+	Report func(Diagnostic)
+}
+
+// A DirectiveHandler applies a directive. The args are the words of the directive, starting
+// with its name, and types are the types found in the source by name, which the handler may
+// change. An error is reported as a warning.
+type DirectiveHandler func(args []string, types map[string]Elem) error
+
 // Run writes your desired methods and test files. You must set the source code path. The output file
 // path can be left blank to have a file created at old_name_gen.go (_gen appended to the old name; the
 // test file, if you opt to create one, will be at old_name_gen_test.go). The mode is the set of Method
 // types and tests you would like. Set unexported to true if you want code to be generated for unexported
-// as well as for exported types.
+// as well as for exported types. Problems found in the source are printed to standard error.
 func Run(srcPath string, outputPath string, mode Method, unexported bool) error {
+	return (&Options{Mode: mode, Unexported: unexported}).Run(srcPath, outputPath)
+}
+
+// RunData works just like Run except that, instead of writing out a file, it outputs the generated file's contents,
+// the corresponding generated test file (nil if mode does not include gen.Test), and a possibly nil error.
+// If srcPath is an IDL file (see IDLExt), the generated file also declares the types of the IDL file.
+func RunData(srcPath string, mode Method, unexported bool) (mainBuf *bytes.Buffer, testsBuf *bytes.Buffer, err error) {
+	return (&Options{Mode: mode, Unexported: unexported}).RunData(srcPath)
+}
+
+// Run works like the Run function with the options in o. If any of the problems found in the
+// source is an error, no files are written and the returned error is the Diagnostics of Error
+// severity.
+func (o *Options) Run(srcPath string, outputPath string) error {
 
-	mainBuf, testsBuf, err := RunData(srcPath, mode, unexported)
+	mainBuf, testsBuf, err := o.RunData(srcPath)
 	if err != nil {
 		return err
 	}
@@ -48,6 +109,8 @@ func Run(srcPath string, outputPath string, mode Method, unexported bool) error
 	} else if stat, err := os.Stat(srcPath); err == nil && stat.IsDir() {
 		// The new file is named msgp_gen.go in the source directory.
 		outputPath = filepath.Join(srcPath, "msgp_gen.go")
+	} else if strings.HasSuffix(srcPath, IDLExt) {
+		outputPath = strings.TrimSuffix(srcPath, IDLExt) + "_gen.go"
 	} else {
 		// The new file name is the source file name + _gen.go
 		outputPath = strings.TrimSuffix(srcPath, ".go") + "_gen.go"
@@ -70,19 +133,35 @@ func Run(srcPath string, outputPath string, mode Method, unexported bool) error
 
 }
 
-// RunData works just like Run except that, instead of writing out a file, it outputs the generated file's contents,
-// the corresponding generated test file (nil if mode does not include gen.Test), and a possibly nil error.
-func RunData(srcPath string, mode Method, unexported bool) (mainBuf *bytes.Buffer, testsBuf *bytes.Buffer, err error) {
+// RunData works like the RunData function with the options in o. If any of the problems found in
+// the source is an error, no code is returned and the returned error is the Diagnostics of Error
+// severity.
+func (o *Options) RunData(srcPath string) (mainBuf *bytes.Buffer, testsBuf *bytes.Buffer, err error) {
+
+	mode := o.Mode
 
-	if mode&^Test == 0 {
+	if mode&^Test == 0 && len(o.Generators) == 0 {
 		err = errors.New("no methods to generate; -io=false and -marshal=false")
 		return
 	}
 
-	s, err := newSource(srcPath, unexported)
+	for name := range o.Directives {
+		if _, ok := directives[name]; ok || strToMethod(name) != 0 {
+			err = fmt.Errorf("directive %q: the name of a built-in directive cannot be used", name)
+			return
+		}
+	}
+
+	s, err := newSource(srcPath, o)
 	if err != nil {
 		return
 	}
+	defer func() {
+		o.report(s.diags)
+		if errs := s.diags.Errors(); len(errs) > 0 && err == nil {
+			mainBuf, testsBuf, err = nil, nil, errs
+		}
+	}()
 
 	if len(s.identities) == 0 {
 		err = errors.New("no types requiring code generation were found")
@@ -96,6 +175,9 @@ func RunData(srcPath string, mode Method, unexported bool) (mainBuf *bytes.Buffe
 	writePkgHeader(mainBuf, s.pkg)
 
 	mainImports := []string{"github.com/dchenk/msgp/msgp"}
+	for _, path := range o.Imports {
+		mainImports = append(mainImports, strconv.Quote(path))
+	}
 	for _, imp := range s.imports {
 		if imp.Name != nil {
 			// If the import has an alias, include it (imp.Path.Value is a quoted string).
@@ -122,24 +204,49 @@ func RunData(srcPath string, mode Method, unexported bool) (mainBuf *bytes.Buffe
 	}
 
 	writeImportHeader(mainBuf, mainImports)
+	mainBuf.Write(s.decls)
+	if err = s.printEnums(mainBuf); err != nil {
+		return
+	}
 
 	// Write the test file if it's desired.
 	if mode&Test == Test {
 		testsBuf = bytes.NewBuffer(make([]byte, 0, 4096))
 		writePkgHeader(testsBuf, s.pkg)
-		neededImports := []string{"github.com/dchenk/msgp/msgp", "testing"}
-		if mode&(Encode|Decode) != 0 {
-			neededImports = append(neededImports, "bytes")
-		}
+		neededImports := []string{"bytes", "github.com/dchenk/msgp/msgp", "math/rand", "testing"}
 		writeImportHeader(testsBuf, neededImports)
 	}
 
-	err = s.printTo(newGeneratorSet(mode, mainBuf, testsBuf))
+	var gs generatorSet
+	if mode&^Test != 0 {
+		gs = newGeneratorSet(mode, mainBuf, testsBuf)
+	}
+	for _, newGen := range o.Generators {
+		gs = append(gs, newGen(mainBuf, testsBuf))
+	}
+	for _, p := range o.Passes {
+		for _, g := range gs {
+			g.Add(p)
+		}
+	}
+
+	err = s.printTo(gs)
 
 	return
 
 }
 
+// report passes the diagnostics to o.Report or prints them.
+func (o *Options) report(ds Diagnostics) {
+	if o.Report == nil {
+		ds.print()
+		return
+	}
+	for _, d := range ds {
+		o.Report(d)
+	}
+}
+
 // formatWrite runs the imports formatter on data (representing a Go source file) and
 // writes the output to a file at fileName, creating a file if nothing exists there.
 func formatWrite(fileName string, data []byte) error {
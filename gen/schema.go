@@ -0,0 +1,277 @@
+package gen
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/dchenk/msgp/msgp"
+)
+
+// SchemaURI is the JSON Schema dialect of the documents written by Schema.
+const SchemaURI = "https://json-schema.org/draft/2020-12/schema"
+
+// Schema returns a JSON Schema document describing the MessagePack encoding of the types in the
+// source file or directory at srcPath, as the generated code writes them. Each type is described
+// under "$defs" by its name, and references to other types are made with "$ref".
+//
+// Standard JSON Schema keywords describe the values in terms of JSON. Because MessagePack has
+// types that JSON lacks, the following keywords describe the values more exactly:
+//
+//  x-msgp-type     the MessagePack type: "nil", "bool", "int", "uint", "float32", "float64",
+//                  "str", "bin", "array", "map", "ext", or "any"
+//  x-msgp-ext      the extension type number of an "ext" value, if it is known
+//  x-msgp-layout   how a struct is written: "map" (keyed by field names), "intkeys" (a map keyed
+//                  by field IDs, which are the property names), or "tuple" (an array of the
+//                  fields in order)
+//  x-msgp-length   the length of an array type whose length is a named constant, or of a
+//                  byte array (which is written as "bin" data)
+//  x-msgp-aliases  the keys besides the property name that decoders accept for a field
+//  x-msgp-lazy     true if a field is decoded only when it is needed (it holds any value)
+//  x-msgp-strict   true if decoders validate input strictly
+//  x-msgp-lenient  true if decoders accept lossless conversions from other types
+//  x-msgp-shim     the Go type and the functions that convert it to and from the encoded type
+//  x-msgp-enum     the names of the constants of an integer enum whose values are listed with
+//                  the standard "enum" keyword, in the same order (the values of a string enum
+//                  are the names, so they are listed with "enum" alone)
+//  x-go-type       the Go type of a definition or of a type that is not defined in the document
+//  x-go-name       the Go name of a struct field
+func Schema(srcPath string, unexported bool) ([]byte, error) {
+	s, err := newSource(srcPath, &Options{Unexported: unexported})
+	if err != nil {
+		return nil, err
+	}
+	s.diags.print()
+	if err = s.evalEnums(); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(s.identities))
+	for name := range s.identities {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	defs := make(map[string]interface{}, len(names))
+	for _, name := range names {
+		d := s.schema(s.identities[name], true)
+		d["x-go-type"] = name
+		defs[name] = d
+	}
+	return json.MarshalIndent(map[string]interface{}{
+		"$schema": SchemaURI,
+		"$defs":   defs,
+	}, "", "  ")
+}
+
+// WriteSchema writes the document returned by Schema to the file at outPath.
+func WriteSchema(srcPath, outPath string, unexported bool) error {
+	doc, err := Schema(srcPath, unexported)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(outPath, append(doc, '\n'), 0600)
+}
+
+// schema returns the schema of e. Types other than the root that are defined in s are
+// referred to with "$ref".
+func (s *source) schema(e Elem, root bool) map[string]interface{} {
+	if !root {
+		if _, ok := s.identities[e.TypeName()]; ok {
+			return map[string]interface{}{"$ref": "#/$defs/" + e.TypeName()}
+		}
+	}
+	switch e := e.(type) {
+	case *Struct:
+		return s.structSchema(e)
+	case *Slice:
+		return map[string]interface{}{
+			"type":        "array",
+			"x-msgp-type": "array",
+			"items":       s.schema(e.Els, false),
+		}
+	case *Array:
+		sc := map[string]interface{}{
+			"type":        "array",
+			"x-msgp-type": "array",
+			"items":       s.schema(e.Els, false),
+		}
+		if be, ok := e.Els.(*BaseElem); ok && be.Value == Byte {
+			// See the special case in decode.go.
+			sc = map[string]interface{}{"type": "string", "x-msgp-type": "bin"}
+		}
+		if n, err := strconv.Atoi(e.Size); err == nil {
+			if sc["x-msgp-type"] == "bin" {
+				sc["x-msgp-length"] = n
+			} else {
+				sc["minItems"], sc["maxItems"] = n, n
+			}
+		} else {
+			sc["x-msgp-length"] = e.Size
+		}
+		return sc
+	case *Map:
+		return map[string]interface{}{
+			"type":                 "object",
+			"x-msgp-type":          "map",
+			"additionalProperties": s.schema(e.Value, false),
+		}
+	case *Ptr:
+		return map[string]interface{}{
+			"anyOf": []interface{}{
+				s.schema(e.Value, false),
+				map[string]interface{}{"type": "null", "x-msgp-type": "nil"},
+			},
+		}
+	case *BaseElem:
+		return s.baseSchema(e)
+	}
+	return map[string]interface{}{}
+}
+
+func (s *source) structSchema(st *Struct) map[string]interface{} {
+	sc := map[string]interface{}{}
+	if st.Strict {
+		sc["x-msgp-strict"] = true
+	}
+	if st.AsTuple {
+		items := make([]interface{}, len(st.Fields))
+		for i := range st.Fields {
+			f := s.schema(st.Fields[i].fieldElem, false)
+			f["x-go-name"] = st.Fields[i].fieldName
+			items[i] = f
+		}
+		sc["type"] = "array"
+		sc["x-msgp-type"] = "array"
+		sc["x-msgp-layout"] = "tuple"
+		sc["prefixItems"] = items
+		sc["minItems"], sc["maxItems"] = len(items), len(items)
+		return sc
+	}
+
+	props := make(map[string]interface{}, len(st.Fields))
+	for i := range st.Fields {
+		sf := &st.Fields[i]
+		f := s.schema(sf.fieldElem, false)
+		f["x-go-name"] = sf.fieldName
+		if sf.lazyType != "" {
+			f["x-msgp-lazy"] = true
+		}
+		key := sf.fieldTag
+		if st.IntKeys {
+			key = strconv.FormatInt(sf.fieldID, 10)
+		} else if len(sf.aliases) > 0 {
+			f["x-msgp-aliases"] = sf.aliases
+		}
+		props[key] = f
+	}
+	sc["type"] = "object"
+	sc["x-msgp-type"] = "map"
+	sc["x-msgp-layout"] = "map"
+	if st.IntKeys {
+		sc["x-msgp-layout"] = "intkeys"
+	}
+	sc["properties"] = props
+	return sc
+}
+
+func (s *source) baseSchema(b *BaseElem) map[string]interface{} {
+	var sc map[string]interface{}
+	switch b.Value {
+	case String:
+		sc = map[string]interface{}{"type": "string", "x-msgp-type": "str"}
+	case Bytes:
+		sc = map[string]interface{}{"type": "string", "x-msgp-type": "bin"}
+	case Bool:
+		sc = map[string]interface{}{"type": "boolean", "x-msgp-type": "bool"}
+	case Float32:
+		sc = map[string]interface{}{"type": "number", "x-msgp-type": "float32"}
+	case Float64:
+		sc = map[string]interface{}{"type": "number", "x-msgp-type": "float64"}
+	case Int8:
+		sc = intSchema(math.MinInt8, math.MaxInt8)
+	case Int16:
+		sc = intSchema(math.MinInt16, math.MaxInt16)
+	case Int32:
+		sc = intSchema(math.MinInt32, math.MaxInt32)
+	case Int, Int64, Duration:
+		sc = intSchema(math.MinInt64, math.MaxInt64)
+	case Uint8, Byte:
+		sc = uintSchema(math.MaxUint8)
+	case Uint16:
+		sc = uintSchema(math.MaxUint16)
+	case Uint32:
+		sc = uintSchema(math.MaxUint32)
+	case Uint, Uint64:
+		sc = uintSchema(math.MaxUint64)
+	case Complex64:
+		sc = extSchema(msgp.Complex64Extension)
+	case Complex128:
+		sc = extSchema(msgp.Complex128Extension)
+	case Time:
+		sc = extSchema(msgp.TimeExtension)
+	case BigInt:
+		sc = extSchema(msgp.BigIntExtension)
+	case BigFloat:
+		sc = extSchema(msgp.BigFloatExtension)
+	case BigRat:
+		sc = extSchema(msgp.BigRatExtension)
+	case IP, IPAddr:
+		sc = extSchema(msgp.IPExtension)
+	case UUID:
+		sc = extSchema(msgp.UUIDExtension)
+	case Ext:
+		sc = map[string]interface{}{"x-msgp-type": "ext"}
+	case Intf:
+		sc = map[string]interface{}{"x-msgp-type": "any"}
+	default:
+		// A type that is not defined in the source, which implements the msgp interfaces itself.
+		return map[string]interface{}{"x-go-type": b.TypeName()}
+	}
+	if b.lenient {
+		sc["x-msgp-lenient"] = true
+	}
+	if b.ShimToBase == "" {
+		return sc
+	}
+	for _, e := range s.enums {
+		if e.valuesVar() == b.enumValues {
+			if e.asString {
+				sc["enum"] = e.consts
+				return sc
+			}
+			// Constants with the same value are listed once, by the name that is encoded.
+			values := make([]interface{}, 0, len(e.values))
+			names := make([]string, 0, len(e.values))
+			seen := make(map[string]bool, len(e.values))
+			for i, v := range e.values {
+				if !seen[v.ExactString()] {
+					seen[v.ExactString()] = true
+					values = append(values, json.Number(v.ExactString()))
+					names = append(names, e.consts[i])
+				}
+			}
+			sc["enum"] = values
+			sc["x-msgp-enum"] = names
+			return sc
+		}
+	}
+	sc["x-msgp-shim"] = map[string]interface{}{
+		"type": b.TypeName(),
+		"to":   b.ShimToBase,
+		"from": b.ShimFromBase,
+	}
+	return sc
+}
+
+func intSchema(min, max int64) map[string]interface{} {
+	return map[string]interface{}{"type": "integer", "x-msgp-type": "int", "minimum": min, "maximum": max}
+}
+
+func uintSchema(max uint64) map[string]interface{} {
+	return map[string]interface{}{"type": "integer", "x-msgp-type": "uint", "minimum": 0, "maximum": max}
+}
+
+func extSchema(typ int8) map[string]interface{} {
+	return map[string]interface{}{"x-msgp-type": "ext", "x-msgp-ext": typ}
+}
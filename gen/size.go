@@ -106,9 +106,7 @@ func (s *sizeGen) gStruct(st *Struct) {
 		data := msgp.AppendMapHeader(nil, nfields)
 		s.addConstant(strconv.Itoa(len(data)))
 		for i := range st.Fields {
-			data = data[:0]
-			data = msgp.AppendString(data, st.Fields[i].fieldTag)
-			s.addConstant(strconv.Itoa(len(data)))
+			s.addConstant(strconv.Itoa(len(st.fieldKey(i))))
 			next(s, st.Fields[i].fieldElem)
 		}
 	}
@@ -179,7 +177,9 @@ func (s *sizeGen) gBase(b *BaseElem) {
 	if !s.p.ok() {
 		return
 	}
-	if b.Convert && b.ShimMode == Convert {
+	if b.maxSize > 0 {
+		s.addConstant(strconv.Itoa(b.maxSize))
+	} else if b.Convert && b.ShimMode == Convert && !fixedSize(b.Value) {
 		s.state = add
 		vname := randIdent()
 		s.p.declare(vname, b.BaseType())
@@ -206,7 +206,11 @@ func lenExpr(sl *Slice) string {
 
 // fixedSize says if a given primitive is always the same (max) size on the wire.
 func fixedSize(p primitive) bool {
-	return p != Intf && p != Ext && p != IDENT && p != Bytes && p != String
+	switch p {
+	case Intf, Ext, IDENT, Bytes, String, BigInt, BigFloat, BigRat:
+		return false
+	}
+	return true
 }
 
 // stripRef strips the address operator "&" from s.
@@ -227,6 +231,9 @@ func fixedSizeExpr(e Elem) (string, bool) {
 			return fmt.Sprintf("(%s * (%s))", e.Size, str), true
 		}
 	case *BaseElem:
+		if e.maxSize > 0 {
+			return strconv.Itoa(e.maxSize), true
+		}
 		if fixedSize(e.Value) {
 			return builtinSize(e.BaseName()), true
 		}
@@ -246,10 +253,8 @@ func fixedSizeExpr(e Elem) (string, bool) {
 		var hdrlen int
 		mhdr := msgp.AppendMapHeader(nil, uint32(len(e.Fields)))
 		hdrlen += len(mhdr)
-		var strbody []byte
-		for _, f := range e.Fields {
-			strbody = msgp.AppendString(strbody[:0], f.fieldTag)
-			hdrlen += len(strbody)
+		for i := range e.Fields {
+			hdrlen += len(e.fieldKey(i))
 		}
 		return fmt.Sprintf("%d + %s", hdrlen, str), true
 	}
@@ -261,7 +266,7 @@ func baseSizeExpr(value primitive, vname, basename string) string {
 	switch value {
 	case Ext:
 		return "msgp.ExtensionPrefixSize + " + stripRef(vname) + ".Len()"
-	case Intf:
+	case Intf, BigInt, BigFloat, BigRat:
 		return "msgp.GuessSize(" + vname + ")"
 	case IDENT:
 		return vname + ".Msgsize()"
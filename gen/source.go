@@ -5,9 +5,11 @@ import (
 	"go/ast"
 	"go/parser"
 	"go/token"
+	"go/types"
 	"os"
 	"reflect"
 	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -16,28 +18,48 @@ type source struct {
 	pkg        string              // package name
 	specs      map[string]ast.Expr // type specs found in the code
 	identities map[string]Elem     // identities processed from specs
-	directives []string            // raw preprocessor directives (lines of comments)
+	directives []dirComment        // raw preprocessor directives (lines of comments)
 	imports    []*ast.ImportSpec   // imports
+	lenient    []string            // types named in lenient directives
+	consts     map[string][]string // names of typed constants by type name
+	constDecls []constDecl         // the constants declared in the package
+	enums      []*enum             // types named in enum directives
+	decls      []byte              // Go declarations of the types of an IDL file
+	handlers   map[string]DirectiveHandler
+	path       string         // the path of the source
+	fset       *token.FileSet // the positions of the parsed files
+	strict     bool           // whether unsupported fields are errors
+	names      []string       // the type and field names leading to what is being parsed
+	dirPos     token.Pos      // the position of the directive being applied
+	diags      Diagnostics    // the problems found
 }
 
 // newSource parses a file at the path provided and produces a new *source.
 // If srcPath is the path to a directory, the entire directory will be parsed.
-// If unexported is true, the unexported identifiers in source will be included.
+// If srcPath is the path to an IDL file (see IDLExt), the Go declarations of its types are parsed.
+// The options give whether to include unexported types, the handlers of directives that
+// are not built in, and whether unsupported fields are errors (which are added to s.diags).
 // If the resulting source would be empty, an error is returned.
-func newSource(srcPath string, unexported bool) (*source, error) {
+func newSource(srcPath string, opts *Options) (*source, error) {
 
 	pushState(srcPath)
 	defer popState()
+	unexported := opts.Unexported
 	s := &source{
 		specs:      make(map[string]ast.Expr),
 		identities: make(map[string]Elem),
+		consts:     make(map[string][]string),
+		handlers:   opts.Directives,
+		path:       srcPath,
+		fset:       token.NewFileSet(),
+		strict:     opts.Strict,
 	}
 
 	stat, err := os.Stat(srcPath)
 	if err != nil {
 		return nil, err
 	}
-	fset := token.NewFileSet()
+	fset := s.fset
 	if stat.IsDir() {
 		pkgs, err := parser.ParseDir(fset, srcPath, nil, parser.ParseComments)
 		if err != nil {
@@ -53,9 +75,10 @@ func newSource(srcPath string, unexported bool) (*source, error) {
 			pkg = pkgs[n]
 			break
 		}
-		for _, fl := range pkg.Files {
+		for _, fl := range sortedFiles(pkg) {
 			pushState(fl.Name.Name)
 			s.directives = append(s.directives, getComments(fl.Comments)...)
+			s.getConsts(fl)
 			if !unexported {
 				ast.FileExports(fl)
 			}
@@ -63,17 +86,33 @@ func newSource(srcPath string, unexported bool) (*source, error) {
 			popState()
 		}
 	} else {
-		f, err := parser.ParseFile(fset, srcPath, nil, parser.ParseComments)
+		var src interface{}
+		if strings.HasSuffix(srcPath, IDLExt) {
+			idl, err := parseIDLFile(srcPath)
+			if err != nil {
+				return nil, err
+			}
+			src = idl.goSource()
+			s.decls = idl.goDecls()
+		}
+		f, err := parser.ParseFile(fset, srcPath, src, parser.ParseComments)
 		if err != nil {
 			return nil, err
 		}
 		s.pkg = f.Name.Name
 		s.directives = getComments(f.Comments)
+		s.getConsts(f)
+		if src == nil {
+			if err = s.getPackageConsts(srcPath); err != nil {
+				return nil, err
+			}
+		}
 		if !unexported {
 			ast.FileExports(f)
 		}
 		s.getTypeSpecs(f)
 	}
+	s.resolveConsts()
 
 	if len(s.specs) == 0 {
 		return nil, fmt.Errorf("no definitions in %s", srcPath)
@@ -82,6 +121,7 @@ func newSource(srcPath string, unexported bool) (*source, error) {
 	s.process()
 	s.applyDirectives()
 	s.propInline()
+	s.markLenient()
 
 	return s, nil
 
@@ -110,14 +150,21 @@ func (s *source) printTo(gs generatorSet) error {
 // applyDirectives applies all of the directives that are known to the parser.
 // Additional method-specific directives remain in s.directives.
 func (s *source) applyDirectives() {
-	newdirs := make([]string, 0, len(s.directives))
+	newdirs := make([]dirComment, 0, len(s.directives))
 	for _, d := range s.directives {
-		chunks := strings.Split(d, " ")
+		chunks := strings.Split(d.text, " ")
+		s.dirPos = d.pos
 		if len(chunks) > 0 {
 			if fn, ok := directives[chunks[0]]; ok {
 				pushState(chunks[0])
 				if err := fn(chunks, s); err != nil {
-					warnln(err.Error())
+					s.warn(d.pos, "%s", err)
+				}
+				popState()
+			} else if fn, ok := s.handlers[chunks[0]]; ok {
+				pushState(chunks[0])
+				if err := fn(chunks, s.identities); err != nil {
+					s.warn(d.pos, "%s", err)
 				}
 				popState()
 			} else {
@@ -126,6 +173,7 @@ func (s *source) applyDirectives() {
 		}
 	}
 	s.directives = newdirs
+	s.dirPos = token.NoPos
 }
 
 // A linkset is a graph of unresolved identities.
@@ -166,7 +214,9 @@ func (s *source) resolve(ls linkset) {
 
 	// Whatever is left can't be resolved.
 	for name, elem := range ls {
-		warnf("couldn't resolve type %s (%s)\n", name, elem.TypeName())
+		s.names = []string{name}
+		s.warn(s.specs[name].Pos(), "couldn't resolve type %s", elem.TypeName())
+		s.names = nil
 	}
 
 }
@@ -178,9 +228,11 @@ func (s *source) process() {
 
 	for name, def := range s.specs {
 		pushState(name)
+		s.names = []string{name}
 		el := s.parseExpr(def)
+		s.names = nil
 		if el == nil {
-			warnln("failed to parse")
+			s.unsupported(def.Pos(), "unsupported type %s; the type is ignored", types.ExprString(def))
 			popState()
 			continue
 		}
@@ -223,7 +275,7 @@ func strToMethod(s string) Method {
 // applyDirs applies directives of the form: //msgp:encode ignore {{TypeName}}
 func (s *source) applyDirs(p generatorSet) {
 	for _, d := range s.directives {
-		chunks := strings.Split(d, " ")
+		chunks := strings.Split(d.text, " ")
 		if len(chunks) > 1 {
 			for i := range chunks {
 				// Remove spacing around each word (type name) in
@@ -232,21 +284,21 @@ func (s *source) applyDirs(p generatorSet) {
 			}
 			m := strToMethod(chunks[0]) // m is the directive's Method
 			if m == 0 {
-				warnf("unknown pass name: %q\n", chunks[0])
+				s.warn(d.pos, "unknown pass name %q", chunks[0])
 				continue
 			}
 			if fn, ok := passDirectives[chunks[1]]; ok {
 				pushState(chunks[1])
 				err := fn(m, chunks[2:], p)
 				if err != nil {
-					warnf("error applying directive: %s\n", err)
+					s.warn(d.pos, "error applying directive: %s", err)
 				}
 				popState()
 			} else {
-				warnf("unrecognized directive %q\n", chunks[1])
+				s.warn(d.pos, "unrecognized directive %q", chunks[1])
 			}
 		} else {
-			warnf("empty directive: %q\n", d)
+			s.warn(d.pos, "empty directive %q", d.text)
 		}
 	}
 }
@@ -292,46 +344,119 @@ func fieldName(f *ast.Field) string {
 	return f.Names[0].Name + " (and others)"
 }
 
-func (s *source) parseFieldList(fl *ast.FieldList) []structField {
+func (s *source) parseFieldList(fl *ast.FieldList) []StructField {
 	if fl == nil || fl.NumFields() == 0 {
 		return nil
 	}
-	out := make([]structField, 0, fl.NumFields())
+	out := make([]StructField, 0, fl.NumFields())
+	tags := make([]token.Pos, 0, fl.NumFields()) // the position of the tag of each field
 	for _, field := range fl.List {
 		pushState(fieldName(field))
-		fds := s.getField(field)
-		if len(fds) > 0 {
-			out = append(out, fds...)
-		} else {
-			warnln("ignored.")
-		}
+		s.names = append(s.names, fieldName(field))
+		fields := s.getField(field)
+		out = append(out, fields...)
+		s.names = s.names[:len(s.names)-1]
 		popState()
+		pos := field.Pos()
+		if field.Tag != nil {
+			pos = field.Tag.Pos()
+		}
+		for range fields {
+			tags = append(tags, pos)
+		}
 	}
+	s.checkFieldKeys(out, tags)
 	return out
 }
 
-// translate *ast.Field into []structField
-func (s *source) getField(f *ast.Field) []structField {
+// checkFieldKeys removes the aliases that are also the key of an earlier field or alias so
+// that each key decodes into one field. The tags are the positions of the tags of the fields.
+func (s *source) checkFieldKeys(fields []StructField, tags []token.Pos) {
+	seen := make(map[string]bool, len(fields))
+	for i := range fields {
+		seen[fields[i].fieldTag] = true
+	}
+	for i := range fields {
+		aliases := fields[i].aliases[:0]
+		for _, a := range fields[i].aliases {
+			if seen[a] {
+				s.names = append(s.names, fields[i].fieldName)
+				s.warn(tags[i], "alias %q is already a key", a)
+				s.names = s.names[:len(s.names)-1]
+				continue
+			}
+			seen[a] = true
+			aliases = append(aliases, a)
+		}
+		fields[i].aliases = aliases
+	}
+}
+
+// isTypeName says if s is the name of a type, possibly qualified by a package name.
+func isTypeName(s string) bool {
+	e, err := parser.ParseExpr(s)
+	if err != nil {
+		return false
+	}
+	switch e := e.(type) {
+	case *ast.Ident:
+		return true
+	case *ast.SelectorExpr:
+		_, ok := e.X.(*ast.Ident)
+		return ok
+	}
+	return false
+}
 
-	fields := make([]structField, 1)
+// translate *ast.Field into []StructField
+func (s *source) getField(f *ast.Field) []StructField {
+
+	fields := make([]StructField, 1)
 	var extension bool
 	// Parse the tag; otherwise the field name is field tag.
 	if f.Tag != nil {
 		body := reflect.StructTag(strings.Trim(f.Tag.Value, "`")).Get("msgp")
 		tags := strings.Split(body, ",")
-		if len(tags) == 2 && tags[1] == "extension" {
-			extension = true
-		}
 		// Ignore "-" fields.
 		if tags[0] == "-" {
 			return nil
 		}
+		// Options that this package does not define, such as omitempty, are ignored.
+		for _, opt := range tags[1:] {
+			switch {
+			case opt == "extension":
+				extension = true
+			case opt == "lazy":
+				s.report(f.Tag.Pos(), Error, "the lazy option needs the type to decode into, as in lazy=T, on a field of type msgp.Lazy")
+			case strings.HasPrefix(opt, "lazy="):
+				typ := strings.TrimPrefix(opt, "lazy=")
+				if !isTypeName(typ) {
+					s.report(f.Tag.Pos(), Error, "invalid type name in %q", opt)
+					continue
+				}
+				fields[0].lazyType = typ
+			case strings.HasPrefix(opt, "id="):
+				id, err := strconv.ParseInt(strings.TrimPrefix(opt, "id="), 10, 64)
+				if err != nil {
+					s.warn(f.Tag.Pos(), "invalid field ID in %q", opt)
+					continue
+				}
+				fields[0].fieldID, fields[0].hasID = id, true
+			case strings.HasPrefix(opt, "alias="):
+				for _, a := range strings.Split(strings.TrimPrefix(opt, "alias="), "|") {
+					if a != "" {
+						fields[0].aliases = append(fields[0].aliases, a)
+					}
+				}
+			}
+		}
 		fields[0].fieldTag = tags[0]
 		fields[0].rawTag = f.Tag.Value
 	}
 
 	ex := s.parseExpr(f.Type)
 	if ex == nil {
+		s.unsupported(f.Type.Pos(), "unsupported type %s; the field is ignored", types.ExprString(f.Type))
 		return nil
 	}
 
@@ -346,7 +471,7 @@ func (s *source) getField(f *ast.Field) []structField {
 		// e.g. type A struct { One, Two int }
 		fields = fields[0:0]
 		for _, nm := range f.Names {
-			fields = append(fields, structField{
+			fields = append(fields, StructField{
 				fieldTag:  nm.Name,
 				fieldName: nm.Name,
 				fieldElem: ex.Copy(),
@@ -355,6 +480,9 @@ func (s *source) getField(f *ast.Field) []structField {
 		return fields
 	}
 	fields[0].fieldElem = ex
+	if fields[0].lazyType != "" && ex.TypeName() != "msgp.Lazy" {
+		s.report(f.Type.Pos(), Error, "lazy fields must be of type msgp.Lazy, not %s", types.ExprString(f.Type))
+	}
 	if fields[0].fieldTag == "" {
 		fields[0].fieldTag = fields[0].fieldName
 	}
@@ -366,13 +494,13 @@ func (s *source) getField(f *ast.Field) []structField {
 			if b, ok := ex.Value.(*BaseElem); ok {
 				b.Value = Ext
 			} else {
-				warnln("Couldn't cast to extension.")
+				s.unsupported(f.Type.Pos(), "%s cannot be an extension; the field is ignored", stringify(f.Type))
 				return nil
 			}
 		case *BaseElem:
 			ex.Value = Ext
 		default:
-			warnln("Couldn't cast to extension.")
+			s.unsupported(f.Type.Pos(), "%s cannot be an extension; the field is ignored", stringify(f.Type))
 			return nil
 		}
 	}
@@ -452,7 +580,7 @@ func (s *source) parseExpr(e ast.Expr) Elem {
 		// once we've resolved everything else.
 		if b.Value == IDENT {
 			if _, ok := s.specs[e.Name]; !ok {
-				warnf("non-local identifier: %s\n", e.Name)
+				s.warn(e.Pos(), "non-local identifier %s", e.Name)
 			}
 		}
 		return b
@@ -500,6 +628,10 @@ func (s *source) parseExpr(e ast.Expr) Elem {
 		return &Slice{Els: els}
 
 	case *ast.StarExpr:
+		// Some pointer types, such as *big.Int, are primitives themselves.
+		if p, ok := primitives[stringify(e)]; ok {
+			return &BaseElem{Value: p}
+		}
 		if v := s.parseExpr(e.X); v != nil {
 			return &Ptr{Value: v}
 		}
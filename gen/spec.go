@@ -73,20 +73,26 @@ const (
 	marshaltest = Marshal | Unmarshal | Test             // tests for Marshaler and Unmarshaler
 )
 
-// A generator has all the methods needed to generate code.
-type generator interface {
+// A Generator has all the methods needed to generate code. Execute is called with each type
+// to print, after the passes added with Add are applied to it. Method says which methods the
+// generator prints, so that the directives naming those methods (like //msgp:encode ignore T)
+// are applied to it as well.
+type Generator interface {
 	Method() Method
 	Add(p TransformPass)
 	Execute(Elem) error
 }
 
-type generatorSet []generator
+type generatorSet []Generator
 
 func newGeneratorSet(m Method, out io.Writer, tests io.Writer) generatorSet {
 	if m.isSet(Test) && tests == nil {
 		panic("cannot print tests with 'nil' tests argument")
 	}
-	gens := make(generatorSet, 0, 7)
+	gens := make(generatorSet, 0, 8)
+	if m.isSet(Decode) || m.isSet(Unmarshal) {
+		gens = append(gens, masks(out), lazies(out))
+	}
 	if m.isSet(Decode) {
 		gens = append(gens, decode(out))
 	}
@@ -108,6 +114,9 @@ func newGeneratorSet(m Method, out io.Writer, tests io.Writer) generatorSet {
 	if m.isSet(encodetest) {
 		gens = append(gens, etest(tests))
 	}
+	if m.isSet(marshaltest) || m.isSet(encodetest) {
+		gens = append(gens, rtest(tests))
+	}
 	if len(gens) == 0 {
 		panic("newGeneratorSet called with invalid method flags")
 	}
@@ -184,7 +193,13 @@ func (p *passes) Add(t TransformPass) {
 }
 
 func (p *passes) applyAll(e Elem) Elem {
-	for _, t := range *p {
+	return ApplyPasses(*p, e)
+}
+
+// ApplyPasses applies the passes to e in order and returns the result, which is nil
+// if any of the passes returns nil. Generators use it in Execute.
+func ApplyPasses(ps []TransformPass, e Elem) Elem {
+	for _, t := range ps {
 		e = t(e) // Execute the TransformPass func.
 		if e == nil {
 			return nil
@@ -6,13 +6,15 @@ import (
 )
 
 var (
-	marshalTestTempl = template.New("MarshalTest")
-	encodeTestTempl  = template.New("EncodeTest")
+	marshalTestTempl       = template.New("MarshalTest")
+	encodeTestTempl        = template.New("EncodeTest")
+	marshalRandomTestTempl = template.New("MarshalRandomTest")
+	encodeRandomTestTempl  = template.New("EncodeRandomTest")
 )
 
-// TODO:
-// For simplicity's sake, right now we can only generate tests for types that
-// can be initialized with the "Type{}" syntax. We should support all the types.
+// The tests and benchmarks of zero values are generated for the types that can be
+// initialized with the "Type{}" syntax. The tests of random values, which are set by
+// the methods that rtestGen prints, and the fuzz targets are generated for all types.
 
 func mtest(w io.Writer) *mtestGen {
 	return &mtestGen{w: w}
@@ -28,8 +30,11 @@ func (m *mtestGen) Execute(p Elem) error {
 	if p != nil && isPrintable(p) {
 		switch p.(type) {
 		case *Struct, *Array, *Slice, *Map:
-			return marshalTestTempl.Execute(m.w, p)
+			if err := marshalTestTempl.Execute(m.w, p); err != nil {
+				return err
+			}
 		}
+		return marshalRandomTestTempl.Execute(m.w, p)
 	}
 	return nil
 }
@@ -50,8 +55,11 @@ func (e *etestGen) Execute(p Elem) error {
 	if p != nil && isPrintable(p) {
 		switch p.(type) {
 		case *Struct, *Array, *Slice, *Map:
-			return encodeTestTempl.Execute(e.w, p)
+			if err := encodeTestTempl.Execute(e.w, p); err != nil {
+				return err
+			}
 		}
+		return encodeRandomTestTempl.Execute(e.w, p)
 	}
 	return nil
 }
@@ -174,6 +182,86 @@ func BenchmarkDecode{{.TypeName}}(b *testing.B) {
 	}
 }
 
+`))
+
+	template.Must(marshalRandomTestTempl.Parse(`func TestRandomMarshalUnmarshal{{.TypeName}}(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 100; i++ {
+		var v {{.TypeName}}
+		v.msgpRandomize(r, 0)
+		bts, err := v.MarshalMsg(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m := v.Msgsize(); m < len(bts) {
+			t.Errorf("Msgsize() is %d but the encoded length is %d", m, len(bts))
+		}
+
+		var out {{.TypeName}}
+		left, err := out.UnmarshalMsg(bts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(left) > 0 {
+			t.Errorf("%d bytes left over after UnmarshalMsg(): %q", len(left), left)
+		}
+		again, err := out.MarshalMsg(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !msgp.Equal(bts, again, nil) {
+			t.Fatalf("encoding changed in a round trip:\n%x\n%x", bts, again)
+		}
+	}
+}
+
+func FuzzUnmarshal{{.TypeName}}(f *testing.F) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 10; i++ {
+		var v {{.TypeName}}
+		v.msgpRandomize(r, 0)
+		bts, err := v.MarshalMsg(nil)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(bts)
+	}
+	f.Fuzz(func(t *testing.T, bts []byte) {
+		var v {{.TypeName}}
+		v.UnmarshalMsg(bts)
+	})
+}
+
+`))
+
+	template.Must(encodeRandomTestTempl.Parse(`func TestRandomEncodeDecode{{.TypeName}}(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	var buf, again bytes.Buffer
+	for i := 0; i < 100; i++ {
+		var v {{.TypeName}}
+		v.msgpRandomize(r, 0)
+		buf.Reset()
+		if err := msgp.Encode(&buf, &v); err != nil {
+			t.Fatal(err)
+		}
+		if m := v.Msgsize(); m < buf.Len() {
+			t.Errorf("Msgsize() is %d but the encoded length is %d", m, buf.Len())
+		}
+
+		var out {{.TypeName}}
+		if err := msgp.Decode(bytes.NewReader(buf.Bytes()), &out); err != nil {
+			t.Fatal(err)
+		}
+		again.Reset()
+		if err := msgp.Encode(&again, &out); err != nil {
+			t.Fatal(err)
+		}
+		if !msgp.Equal(buf.Bytes(), again.Bytes(), nil) {
+			t.Fatalf("encoding changed in a round trip:\n%x\n%x", buf.Bytes(), again.Bytes())
+		}
+	}
+}
+
 `))
 
 }
@@ -0,0 +1,213 @@
+package gen
+
+import (
+	"fmt"
+	"io"
+)
+
+// randomizeMethod is the name of the method generated in test files to fill a value with random data.
+const randomizeMethod = "msgpRandomize"
+
+// randomDepth is the depth of nested types below which the generated randomize methods
+// allocate slices, maps, and pointers, so that recursive types are finite.
+const randomDepth = "3"
+
+func rtest(w io.Writer) *rtestGen {
+	return &rtestGen{p: printer{w: w}}
+}
+
+// rtestGen prints, for each type, a method that sets a value of the type to random data.
+//
+// Maps get up to four entries, so a value that is encoded, decoded, and encoded again may
+// not yield the same bytes; the generated tests compare the encodings with msgp.Equal,
+// which does not depend on the order of map entries. Values converted with shims are left zero (the conversion may not
+// accept arbitrary data), and so are extensions; slices, maps, and pointers holding such
+// values are left nil.
+type rtestGen struct {
+	passes
+	p printer
+}
+
+func (r *rtestGen) Method() Method { return Test }
+
+func (r *rtestGen) Execute(p Elem) error {
+	if !r.p.ok() {
+		return r.p.err
+	}
+	p = r.applyAll(p)
+	if p == nil || !isPrintable(p) {
+		return nil
+	}
+
+	r.p.comment(randomizeMethod + " sets z to random data.")
+	r.p.printf("\nfunc (%s %s) %s(r *rand.Rand, depth int) {", p.Varname(), methodReceiver(p), randomizeMethod)
+	r.p.print("\n_ = depth")
+	next(r, p)
+	r.p.print("\n}\n")
+	unsetReceiver(p)
+	return r.p.err
+}
+
+// randomizable says if the generated code sets values of e to random data.
+func randomizable(e Elem) bool {
+	switch e := e.(type) {
+	case *BaseElem:
+		if e.enumValues != "" {
+			return true
+		}
+		return e.ShimToBase == "" && e.Value != Ext
+	case *Slice:
+		return randomizable(e.Els)
+	case *Array:
+		return randomizable(e.Els)
+	case *Map:
+		return randomizable(e.Value)
+	case *Ptr:
+		return randomizable(e.Value)
+	}
+	return true
+}
+
+func (r *rtestGen) gStruct(s *Struct) {
+	for i := range s.Fields {
+		if !r.p.ok() {
+			return
+		}
+		next(r, s.Fields[i].fieldElem)
+	}
+}
+
+func (r *rtestGen) gArray(a *Array) {
+	// Special case for [const]byte objects; see decode.go.
+	if be, ok := a.Els.(*BaseElem); ok && be.Value == Byte {
+		r.p.printf("\nr.Read((%s)[:])", a.Varname())
+		return
+	}
+	if randomizable(a.Els) {
+		r.p.rangeBlock(a.Index, a.Varname(), r, a.Els)
+	}
+}
+
+func (r *rtestGen) gSlice(s *Slice) {
+	if !randomizable(s.Els) {
+		return
+	}
+	r.p.printf("\nif depth < %s {", randomDepth)
+	r.p.printf("\n%s = make(%s, r.Intn(4))", s.Varname(), s.TypeName())
+	r.p.rangeBlock(s.Index, s.Varname(), r, s.Els)
+	r.p.closeBlock()
+}
+
+func (r *rtestGen) gMap(m *Map) {
+	if !randomizable(m.Value) {
+		return
+	}
+	n := randIdent()
+	r.p.printf("\nif depth < %s && r.Intn(2) == 0 {", randomDepth)
+	r.p.printf("\n%s = make(%s)", m.Varname(), m.TypeName())
+	r.p.printf("\nfor %[1]s := 1 + r.Intn(4); %[1]s > 0; %[1]s-- {", n)
+	r.p.declare(m.KeyIndx, "string")
+	r.p.declare(m.ValIndx, m.Value.TypeName())
+	r.p.printf("\n%s = strconv.FormatUint(r.Uint64(), 36)", m.KeyIndx)
+	next(r, m.Value)
+	r.p.mapAssign(m)
+	r.p.closeBlock()
+	r.p.closeBlock()
+}
+
+func (r *rtestGen) gPtr(p *Ptr) {
+	if !randomizable(p.Value) {
+		return
+	}
+	vname := p.Varname()
+	r.p.printf("\nif depth < %s && r.Intn(2) == 0 {", randomDepth)
+	r.p.printf("\n%s = new(%s)", vname, p.Value.TypeName())
+	if be, ok := p.Value.(*BaseElem); ok && be.Value == IDENT {
+		// The element's variable is the pointer itself.
+		r.randomizeIdent(vname)
+	} else {
+		next(r, p.Value)
+	}
+	r.p.closeBlock()
+}
+
+// randomizeIdent prints a call of the randomize method of ptr if its type has one.
+func (r *rtestGen) randomizeIdent(ptr string) {
+	r.p.printf("\nif rz, ok := interface{}(%s).(interface{ %s(*rand.Rand, int) }); ok {", ptr, randomizeMethod)
+	r.p.printf("\nrz.%s(r, depth+1)", randomizeMethod)
+	r.p.closeBlock()
+}
+
+func (r *rtestGen) gBase(b *BaseElem) {
+	if !r.p.ok() || !randomizable(b) {
+		return
+	}
+	vname := b.Varname()
+	if b.enumValues != "" {
+		r.p.printf("\n%s = %s[r.Intn(len(%[2]s))]", vname, b.enumValues)
+		return
+	}
+
+	switch b.Value {
+	case IDENT:
+		r.randomizeIdent("&" + vname)
+		return
+	case Bytes:
+		r.p.printf("\n%s = make(%s, r.Intn(16))", vname, b.TypeName())
+		r.p.printf("\nr.Read(%s)", vname)
+		return
+	case UUID:
+		r.p.printf("\nr.Read(%s[:])", vname)
+		return
+	}
+
+	val, err := randomExpr(b.Value)
+	if err != nil {
+		r.p.err = err
+		return
+	}
+	if b.Convert {
+		val = b.FromBase() + "(" + val + ")"
+	}
+	r.p.printf("\n%s = %s", vname, val)
+}
+
+// randomExpr returns an expression giving a random value of the primitive type p,
+// using a *rand.Rand named r.
+func randomExpr(p primitive) (string, error) {
+	switch p {
+	case String:
+		return "strconv.FormatUint(r.Uint64(), 36)", nil
+	case Float32:
+		return "float32(r.NormFloat64())", nil
+	case Float64:
+		return "r.NormFloat64()", nil
+	case Complex64:
+		return "complex(float32(r.NormFloat64()), float32(r.NormFloat64()))", nil
+	case Complex128:
+		return "complex(r.NormFloat64(), r.NormFloat64())", nil
+	case Uint64:
+		return "r.Uint64()", nil
+	case Uint, Uint8, Uint16, Uint32, Byte, Int, Int8, Int16, Int32, Int64:
+		return (&BaseElem{Value: p}).BaseType() + "(r.Uint64())", nil
+	case Bool:
+		return "r.Intn(2) == 0", nil
+	case Intf:
+		return "r.Int63()", nil
+	case Time:
+		return "time.Unix(r.Int63n(1<<33), r.Int63n(1e9))", nil
+	case Duration:
+		return "time.Duration(r.Int63())", nil
+	case BigInt:
+		return "big.NewInt(r.Int63() - r.Int63())", nil
+	case BigFloat:
+		return "big.NewFloat(r.NormFloat64())", nil
+	case BigRat:
+		return "big.NewRat(r.Int63()-r.Int63(), 1+r.Int63n(1000))", nil
+	case IP:
+		return "net.IPv4(byte(r.Uint64()), byte(r.Uint64()), byte(r.Uint64()), byte(r.Uint64()))", nil
+	case IPAddr:
+		return "netip.AddrFrom4([4]byte{byte(r.Uint64()), byte(r.Uint64()), byte(r.Uint64()), byte(r.Uint64())})", nil
+	}
+	return "", fmt.Errorf("no random expression for %s", p)
+}
@@ -15,6 +15,8 @@ type unmarshalGen struct {
 	passes
 	p        printer
 	hasField bool
+	mask     string // the variable holding the msgp.FieldMask of the struct being decoded, if any
+	inPtr    bool   // the value being decoded is the value of a pointer
 }
 
 func (u *unmarshalGen) Method() Method { return Unmarshal }
@@ -36,14 +38,35 @@ func (u *unmarshalGen) Execute(p Elem) error {
 	u.p.comment("UnmarshalMsg implements msgp.Unmarshaler")
 
 	u.p.printf("\nfunc (%s %s) UnmarshalMsg(bts []byte) (o []byte, err error) {", p.Varname(), methodReceiver(p))
+	if st, ok := p.(*Struct); ok && st.Strict {
+		u.p.print("\nif err = msgp.Validate(bts, msgp.Strict&^msgp.RejectTrailingBytes); err != nil {\nreturn\n}")
+	}
 	next(u, p)
 	u.p.print("\no = bts")
 	u.p.nakedReturn()
 	unsetReceiver(p)
+	if st, ok := p.(*Struct); ok && st.FieldMask {
+		u.fields(st)
+	}
 	return u.p.err
 
 }
 
+// fields prints UnmarshalMsgFields, which decodes the fields of s selected by a msgp.FieldMask.
+func (u *unmarshalGen) fields(s *Struct) {
+	u.hasField = false
+	u.p.comment("UnmarshalMsgFields implements msgp.FieldsUnmarshaler")
+	u.p.printf("\nfunc (%s %s) UnmarshalMsgFields(bts []byte, mask msgp.FieldMask) (o []byte, err error) {", s.Varname(), methodReceiver(s))
+	if s.Strict {
+		u.p.print("\nif err = msgp.Validate(bts, msgp.Strict&^msgp.RejectTrailingBytes); err != nil {\nreturn\n}")
+	}
+	u.mask = "mask"
+	next(u, s)
+	u.mask = ""
+	u.p.print("\no = bts")
+	u.p.nakedReturn()
+}
+
 // does assignment to the variable "name" with the type "base"
 func (u *unmarshalGen) assignAndCheck(name, base string) {
 	if !u.p.ok() {
@@ -57,6 +80,12 @@ func (u *unmarshalGen) gStruct(s *Struct) {
 	if !u.p.ok() {
 		return
 	}
+	if !s.FieldMask {
+		// The fields have no mask bits, so the struct is decoded completely.
+		mask := u.mask
+		u.mask = ""
+		defer func() { u.mask = mask }()
+	}
 	if s.AsTuple {
 		u.tuple(s)
 	} else {
@@ -73,13 +102,33 @@ func (u *unmarshalGen) tuple(s *Struct) {
 		if !u.p.ok() {
 			return
 		}
+		u.field(s, i)
+	}
+}
+
+// field prints the decoding of field i of s, which is skipped if the field is not selected
+// by the current mask.
+func (u *unmarshalGen) field(s *Struct, i int) {
+	mask := u.mask
+	if mask == "" || !maskable(s, i) {
+		u.mask = ""
 		next(u, s.Fields[i].fieldElem)
+		u.mask = mask
+		return
 	}
+	u.mask = u.p.maskedField(mask, s, i, "bts, err = msgp.Skip(bts)")
+	next(u, s.Fields[i].fieldElem)
+	u.mask = mask
+	u.p.closeBlock()
 }
 
 func (u *unmarshalGen) structAsMap(s *Struct) {
 
-	if !u.hasField {
+	key := "field"
+	if s.IntKeys {
+		key = randIdent()
+		u.p.declare(key, "int64")
+	} else if !u.hasField {
 		u.p.declare("field", "[]byte")
 		u.hasField = true
 	}
@@ -94,15 +143,20 @@ func (u *unmarshalGen) structAsMap(s *Struct) {
 
 	u.p.printf("\nfor %s > 0 {", sz)
 	u.p.printf("\n%s--", sz)
-	u.p.print("\nfield, bts, err = msgp.ReadMapKeyZC(bts)")
-	u.p.print(errCheck)
-	u.p.print("\nswitch string(field) {")
+	if s.IntKeys {
+		u.assignAndCheck(key, "Int64")
+		u.p.printf("\nswitch %s {", key)
+	} else {
+		u.p.print("\nfield, bts, err = msgp.ReadMapKeyZC(bts)")
+		u.p.print(errCheck)
+		u.p.print("\nswitch string(field) {")
+	}
 	for i := range s.Fields {
 		if !u.p.ok() {
 			return
 		}
-		u.p.printf("\ncase \"%s\":", s.Fields[i].fieldTag)
-		next(u, s.Fields[i].fieldElem)
+		u.p.printf("\ncase %s:", s.caseKeys(i))
+		u.field(s, i)
 	}
 	u.p.print("\ndefault:\nbts, err = msgp.Skip(bts)")
 	u.p.print(errCheck)
@@ -129,15 +183,24 @@ func (u *unmarshalGen) gBase(b *BaseElem) {
 		u.p.declare(refname, b.BaseType())
 	}
 
+	var suffix string
+	if b.lenient {
+		suffix = "Lenient"
+	}
+
 	switch b.Value {
 	case Bytes:
-		u.p.printf("\n%s, bts, err = msgp.ReadBytesBytes(bts, %s)", refname, lowered)
+		u.p.printf("\n%s, bts, err = msgp.ReadBytesBytes%s(bts, %s)", refname, suffix, lowered)
 	case Ext:
 		u.p.printf("\nbts, err = msgp.ReadExtensionBytes(bts, %s)", lowered)
 	case IDENT:
-		u.p.printf("\nbts, err = %s.UnmarshalMsg(bts)", lowered)
+		if u.mask != "" {
+			u.p.printf("\nbts, err = msgp.UnmarshalFields(bts, %s, %s)", fieldsRef(lowered, u.inPtr), u.mask)
+		} else {
+			u.p.printf("\nbts, err = %s.UnmarshalMsg(bts)", lowered)
+		}
 	default:
-		u.p.printf("\n%s, bts, err = msgp.Read%sBytes(bts)", refname, b.BaseName())
+		u.p.printf("\n%s, bts, err = msgp.Read%sBytes%s(bts)", refname, b.BaseName(), suffix)
 	}
 	u.p.print(errCheck)
 
@@ -210,6 +273,8 @@ func (u *unmarshalGen) gMap(m *Map) {
 func (u *unmarshalGen) gPtr(p *Ptr) {
 	u.p.printf("\nif msgp.IsNil(bts) { bts, err = msgp.ReadNilBytes(bts); if err != nil { return }; %s = nil; } else { ", p.Varname())
 	u.p.initPtr(p)
+	_, u.inPtr = p.Value.(*BaseElem)
 	next(u, p.Value)
+	u.inPtr = false
 	u.p.closeBlock()
 }
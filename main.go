@@ -10,10 +10,24 @@
 // without any command-line flags. However, the following options are supported, if you need them:
 //
 //  -o = output file name (default is {input}_gen.go)
-//  -src = input file name or directory (default is $GOFILE set by the `go generate` command)
+//  -src = input file name or directory (default is $GOFILE set by the `go generate` command); a file
+//         ending in .msgp is read as an IDL file (see gen.IDLExt)
 //  -io = satisfy the `msgp.Decoder` and `msgp.Encoder` interfaces (default is true)
 //  -marshal = satisfy the `msgp.Marshaler` and `msgp.Unmarshaler` interfaces (default is true)
 //  -tests = generate tests and benchmarks (default is true)
+//  -schema = write a JSON Schema of the types to this file instead of generating code
+//  -strict = fail if a field or type is not supported instead of skipping it with a warning
+//
+// Problems found in the source are printed to standard error in the form file:line:col: severity: message.
+//
+// To check whether a change to your types breaks compatibility with data encoded by the old version, run
+//
+//     msgp compat [-unexported] [-both] old.go new.go
+//
+// which lists the changes in how the types are encoded and exits with status 1 if any is breaking:
+// if data written by the old version may not decode with the new one. With -both, changes that keep
+// the old version from decoding data written by the new one are breaking as well.
+// Either argument may also be a directory or an IDL file, so a saved copy of the types can serve as a snapshot.
 //
 // You can also import github.com/dchenk/msgp/gen and use the code generator from any of your Go programs.
 //
@@ -31,16 +45,22 @@ import (
 )
 
 var (
-	src        = flag.String("src", "", "input file or directory")
+	src        = flag.String("src", "", "input file or directory, or an IDL file ending in .msgp")
 	out        = flag.String("o", "", "output file")
 	encode     = flag.Bool("io", true, "create Encode and Decode methods")
 	marshal    = flag.Bool("marshal", true, "create Marshal and Unmarshal methods")
 	tests      = flag.Bool("tests", true, "create tests and benchmarks")
 	unexported = flag.Bool("unexported", false, "also process unexported types")
+	schema     = flag.String("schema", "", "write a JSON Schema of the types to this file instead of generating code")
+	strict     = flag.Bool("strict", false, "make unsupported fields and types errors")
 )
 
 func main() {
 
+	if len(os.Args) > 1 && os.Args[1] == "compat" {
+		os.Exit(compat(os.Args[2:]))
+	}
+
 	flag.Parse()
 
 	if *src == "" {
@@ -52,6 +72,14 @@ func main() {
 		}
 	}
 
+	if *schema != "" {
+		if err := gen.WriteSchema(*src, *schema, *unexported); err != nil {
+			fmt.Println(chalk.Red.Color(err.Error()))
+			os.Exit(1)
+		}
+		return
+	}
+
 	var mode gen.Method
 	if *encode {
 		mode |= (gen.Encode | gen.Decode | gen.Size)
@@ -63,9 +91,47 @@ func main() {
 		mode |= gen.Test
 	}
 
-	if err := gen.Run(*src, *out, mode, *unexported); err != nil {
-		fmt.Println(chalk.Red.Color(err.Error()))
+	opts := gen.Options{Mode: mode, Unexported: *unexported, Strict: *strict}
+	if err := opts.Run(*src, *out); err != nil {
+		// The diagnostics have been printed already.
+		if _, ok := err.(gen.Diagnostics); !ok {
+			fmt.Println(chalk.Red.Color(err.Error()))
+		}
 		os.Exit(1)
 	}
 
 }
+
+// compat runs the compat command with the arguments after "compat" and returns the exit status.
+func compat(args []string) int {
+	flags := flag.NewFlagSet("compat", flag.ContinueOnError)
+	unexported := flags.Bool("unexported", false, "also compare unexported types")
+	both := flags.Bool("both", false, "also flag changes that the old version cannot decode")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: msgp compat [-unexported] [-both] old.go new.go")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return 2
+	}
+	changes, err := gen.Compat(flags.Arg(0), flags.Arg(1), gen.CompatOptions{Unexported: *unexported, Both: *both})
+	if err != nil {
+		fmt.Println(chalk.Red.Color(err.Error()))
+		return 2
+	}
+	for _, c := range changes {
+		if c.Breaking {
+			fmt.Println(chalk.Red.Color(c.String()))
+		} else {
+			fmt.Println(c.String())
+		}
+	}
+	if gen.Breaking(changes) {
+		return 1
+	}
+	return 0
+}
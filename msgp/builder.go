@@ -0,0 +1,425 @@
+package msgp
+
+import (
+	"fmt"
+	"time"
+)
+
+// A Builder constructs messages by hand without precomputed sizes. The elements of the maps and
+// arrays opened with Map and Array are counted as they are added, and the headers are written
+// with the counts when the functions return:
+//
+//  b := msgp.NewBuilder(nil)
+//  b.Map(func(m *msgp.MapBuilder) {
+//      m.String("name", "gopher")
+//      m.Array("tags", func(a *msgp.ArrayBuilder) {
+//          a.String("a")
+//          a.Int(2)
+//      })
+//  })
+//  msg, err := b.Finish()
+//
+// The methods of the embedded ArrayBuilder append top-level objects. A MapBuilder or ArrayBuilder
+// may be used only inside of its function and not while one of its nested builders is open;
+// otherwise the Builder stops with a BuilderError. The first error is kept and later calls do
+// nothing.
+//
+// Use NewBuilder or NewWriterBuilder to make a Builder; the zero Builder cannot add objects.
+type Builder struct {
+	ArrayBuilder
+
+	// Debug makes misuse panic with a BuilderError where it happens instead of being returned
+	// by Finish, and it makes MapBuilders check for duplicate keys.
+	Debug bool
+
+	buf   []byte
+	w     *Writer
+	err   error
+	depth int // the depth of the innermost open builder
+}
+
+// NewBuilder returns a Builder that appends to b.
+func NewBuilder(b []byte) *Builder {
+	bl := &Builder{buf: b}
+	bl.ArrayBuilder.b = bl
+	return bl
+}
+
+// NewWriterBuilder returns a Builder that writes each top-level object to w when it is complete.
+// The caller flushes w.
+func NewWriterBuilder(w *Writer) *Builder {
+	bl := NewBuilder(nil)
+	bl.w = w
+	return bl
+}
+
+// Finish returns the message built and the first error, if there was one. A Builder from
+// NewWriterBuilder returns no bytes. Finish may not be called while a map or array is open.
+func (b *Builder) Finish() ([]byte, error) {
+	if b.depth != 0 {
+		b.misuse("Finish called inside of a map or array")
+	}
+	if b.w != nil {
+		return nil, b.err
+	}
+	return b.buf, b.err
+}
+
+// Err returns the first error, if there was one.
+func (b *Builder) Err() error { return b.err }
+
+// misuse records (or panics with) a BuilderError.
+func (b *Builder) misuse(format string, args ...interface{}) {
+	err := BuilderError{Msg: fmt.Sprintf(format, args...)}
+	if b.Debug {
+		panic(err)
+	}
+	if b.err == nil {
+		b.err = err
+	}
+}
+
+// fail records err if it is the first error.
+func (b *Builder) fail(err error) {
+	if b.err == nil {
+		b.err = err
+	}
+}
+
+// ready says if a builder at depth may add an element.
+func (b *Builder) ready(depth int, closed bool) bool {
+	if b.err != nil {
+		return false
+	}
+	if closed {
+		b.misuse("element added after its function returned")
+		return false
+	}
+	if depth != b.depth {
+		b.misuse("element added to an outer builder inside of a nested one")
+		return false
+	}
+	return true
+}
+
+// added is called after a top-level object is complete; it writes the object to b.w.
+func (b *Builder) added() {
+	if b.depth != 0 || b.w == nil {
+		return
+	}
+	if _, err := b.w.Write(b.buf); err != nil {
+		b.fail(err)
+	}
+	b.buf = b.buf[:0]
+}
+
+// appended keeps buf, the result of appending an element to b.buf, or records err.
+func (b *Builder) appended(buf []byte, err error) {
+	if err != nil {
+		b.fail(err)
+		return
+	}
+	b.buf = buf
+	b.added()
+}
+
+// nest runs fn for a map or array whose elements start at the end of b.buf, and then inserts
+// before them the header that appendHeader makes for the count of elements.
+func (b *Builder) nest(fn func(), count func() uint32, appendHeader func([]byte, uint32) []byte) {
+	start := len(b.buf)
+	b.depth++
+	fn()
+	b.depth--
+	if b.err != nil {
+		return
+	}
+	var h [5]byte
+	hdr := appendHeader(h[:0], count())
+	b.buf = append(b.buf, hdr...)
+	copy(b.buf[start+len(hdr):], b.buf[start:len(b.buf)-len(hdr)])
+	copy(b.buf[start:], hdr)
+}
+
+// A BuilderError reports a misuse of a Builder.
+type BuilderError struct {
+	Msg string
+}
+
+// Error implements the error interface.
+func (e BuilderError) Error() string { return "msgp: builder: " + e.Msg }
+
+// Resumable is always false for BuilderErrors.
+func (e BuilderError) Resumable() bool { return false }
+
+// An ArrayBuilder adds the elements of an array. See Builder.
+type ArrayBuilder struct {
+	b      *Builder
+	depth  int
+	n      uint32
+	closed bool
+}
+
+// next says if the builder may add an element and counts it.
+func (a *ArrayBuilder) next() bool {
+	if !a.b.ready(a.depth, a.closed) {
+		return false
+	}
+	a.n++
+	return true
+}
+
+// Nil adds nil.
+func (a *ArrayBuilder) Nil() {
+	if a.next() {
+		a.b.buf = AppendNil(a.b.buf)
+		a.b.added()
+	}
+}
+
+// Bool adds a bool.
+func (a *ArrayBuilder) Bool(v bool) {
+	if a.next() {
+		a.b.buf = AppendBool(a.b.buf, v)
+		a.b.added()
+	}
+}
+
+// Int adds an int64.
+func (a *ArrayBuilder) Int(v int64) {
+	if a.next() {
+		a.b.buf = AppendInt64(a.b.buf, v)
+		a.b.added()
+	}
+}
+
+// Uint adds a uint64.
+func (a *ArrayBuilder) Uint(v uint64) {
+	if a.next() {
+		a.b.buf = AppendUint64(a.b.buf, v)
+		a.b.added()
+	}
+}
+
+// Float adds a float64.
+func (a *ArrayBuilder) Float(v float64) {
+	if a.next() {
+		a.b.buf = AppendFloat64(a.b.buf, v)
+		a.b.added()
+	}
+}
+
+// Float32 adds a float32.
+func (a *ArrayBuilder) Float32(v float32) {
+	if a.next() {
+		a.b.buf = AppendFloat32(a.b.buf, v)
+		a.b.added()
+	}
+}
+
+// String adds a string.
+func (a *ArrayBuilder) String(v string) {
+	if a.next() {
+		a.b.buf = AppendString(a.b.buf, v)
+		a.b.added()
+	}
+}
+
+// Bytes adds a binary object.
+func (a *ArrayBuilder) Bytes(v []byte) {
+	if a.next() {
+		a.b.buf = AppendBytes(a.b.buf, v)
+		a.b.added()
+	}
+}
+
+// Time adds a time.Time.
+func (a *ArrayBuilder) Time(v time.Time) {
+	if a.next() {
+		a.b.buf = AppendTime(a.b.buf, v)
+		a.b.added()
+	}
+}
+
+// Raw adds an object that is already encoded.
+func (a *ArrayBuilder) Raw(v Raw) {
+	if a.next() {
+		a.b.appended(v.MarshalMsg(a.b.buf))
+	}
+}
+
+// Marshal adds the encoding of v.
+func (a *ArrayBuilder) Marshal(v Marshaler) {
+	if a.next() {
+		a.b.appended(v.MarshalMsg(a.b.buf))
+	}
+}
+
+// Intf adds v as AppendIntf encodes it.
+func (a *ArrayBuilder) Intf(v interface{}) {
+	if a.next() {
+		a.b.appended(AppendIntf(a.b.buf, v))
+	}
+}
+
+// Map adds a map whose entries are added by fn.
+func (a *ArrayBuilder) Map(fn func(*MapBuilder)) {
+	if a.next() {
+		a.b.buildMap(fn)
+		a.b.added()
+	}
+}
+
+// Array adds an array whose elements are added by fn.
+func (a *ArrayBuilder) Array(fn func(*ArrayBuilder)) {
+	if a.next() {
+		a.b.buildArray(fn)
+		a.b.added()
+	}
+}
+
+func (b *Builder) buildMap(fn func(*MapBuilder)) {
+	m := &MapBuilder{b: b, depth: b.depth + 1}
+	if b.Debug {
+		m.keys = make(map[string]struct{})
+	}
+	b.nest(func() {
+		if fn != nil {
+			fn(m)
+		}
+	}, func() uint32 { return m.n }, AppendMapHeader)
+	m.closed = true
+}
+
+func (b *Builder) buildArray(fn func(*ArrayBuilder)) {
+	a := &ArrayBuilder{b: b, depth: b.depth + 1}
+	b.nest(func() {
+		if fn != nil {
+			fn(a)
+		}
+	}, func() uint32 { return a.n }, AppendArrayHeader)
+	a.closed = true
+}
+
+// A MapBuilder adds the entries of a map with string keys. See Builder.
+type MapBuilder struct {
+	b      *Builder
+	depth  int
+	n      uint32
+	closed bool
+	keys   map[string]struct{} // the keys added, in debug mode
+}
+
+// key appends key and counts the entry if the builder may add one.
+func (m *MapBuilder) key(key string) bool {
+	if !m.b.ready(m.depth, m.closed) {
+		return false
+	}
+	if m.keys != nil {
+		if _, ok := m.keys[key]; ok {
+			m.b.misuse("duplicate map key %q", key)
+			return false
+		}
+		m.keys[key] = struct{}{}
+	}
+	m.b.buf = AppendString(m.b.buf, key)
+	m.n++
+	return true
+}
+
+// Nil adds an entry with a nil value.
+func (m *MapBuilder) Nil(key string) {
+	if m.key(key) {
+		m.b.buf = AppendNil(m.b.buf)
+	}
+}
+
+// Bool adds an entry with a bool value.
+func (m *MapBuilder) Bool(key string, v bool) {
+	if m.key(key) {
+		m.b.buf = AppendBool(m.b.buf, v)
+	}
+}
+
+// Int adds an entry with an int64 value.
+func (m *MapBuilder) Int(key string, v int64) {
+	if m.key(key) {
+		m.b.buf = AppendInt64(m.b.buf, v)
+	}
+}
+
+// Uint adds an entry with a uint64 value.
+func (m *MapBuilder) Uint(key string, v uint64) {
+	if m.key(key) {
+		m.b.buf = AppendUint64(m.b.buf, v)
+	}
+}
+
+// Float adds an entry with a float64 value.
+func (m *MapBuilder) Float(key string, v float64) {
+	if m.key(key) {
+		m.b.buf = AppendFloat64(m.b.buf, v)
+	}
+}
+
+// Float32 adds an entry with a float32 value.
+func (m *MapBuilder) Float32(key string, v float32) {
+	if m.key(key) {
+		m.b.buf = AppendFloat32(m.b.buf, v)
+	}
+}
+
+// String adds an entry with a string value.
+func (m *MapBuilder) String(key string, v string) {
+	if m.key(key) {
+		m.b.buf = AppendString(m.b.buf, v)
+	}
+}
+
+// Bytes adds an entry with a binary value.
+func (m *MapBuilder) Bytes(key string, v []byte) {
+	if m.key(key) {
+		m.b.buf = AppendBytes(m.b.buf, v)
+	}
+}
+
+// Time adds an entry with a time.Time value.
+func (m *MapBuilder) Time(key string, v time.Time) {
+	if m.key(key) {
+		m.b.buf = AppendTime(m.b.buf, v)
+	}
+}
+
+// Raw adds an entry whose value is already encoded.
+func (m *MapBuilder) Raw(key string, v Raw) {
+	if m.key(key) {
+		m.b.appended(v.MarshalMsg(m.b.buf))
+	}
+}
+
+// Marshal adds an entry whose value is the encoding of v.
+func (m *MapBuilder) Marshal(key string, v Marshaler) {
+	if m.key(key) {
+		m.b.appended(v.MarshalMsg(m.b.buf))
+	}
+}
+
+// Intf adds an entry whose value is v as AppendIntf encodes it.
+func (m *MapBuilder) Intf(key string, v interface{}) {
+	if m.key(key) {
+		m.b.appended(AppendIntf(m.b.buf, v))
+	}
+}
+
+// Map adds an entry whose value is a map whose entries are added by fn.
+func (m *MapBuilder) Map(key string, fn func(*MapBuilder)) {
+	if m.key(key) {
+		m.b.buildMap(fn)
+	}
+}
+
+// Array adds an entry whose value is an array whose elements are added by fn.
+func (m *MapBuilder) Array(key string, fn func(*ArrayBuilder)) {
+	if m.key(key) {
+		m.b.buildArray(fn)
+	}
+}
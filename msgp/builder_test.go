@@ -0,0 +1,146 @@
+package msgp
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuilder(t *testing.T) {
+	tm := time.Unix(1500000000, 0)
+	long := strings.Repeat("x", 300)
+
+	b := NewBuilder(nil)
+	b.Map(func(m *MapBuilder) {
+		m.String("name", "gopher")
+		m.Int("age", -3)
+		m.Array("tags", func(a *ArrayBuilder) {
+			for i := 0; i < 20; i++ {
+				a.Uint(uint64(i))
+			}
+			a.Map(nil)
+			a.Array(func(a *ArrayBuilder) { a.Nil() })
+		})
+		m.Map("more", func(m *MapBuilder) {
+			m.Bool("ok", true)
+			m.Float("f", 1.5)
+			m.Bytes("bin", []byte(long))
+			m.Time("t", tm)
+			m.Raw("raw", AppendInt64(nil, 7))
+			m.Intf("intf", []interface{}{"a"})
+		})
+	})
+	b.String("second")
+	got, err := b.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var want []byte
+	want = AppendMapHeader(want, 4)
+	want = AppendString(want, "name")
+	want = AppendString(want, "gopher")
+	want = AppendString(want, "age")
+	want = AppendInt64(want, -3)
+	want = AppendString(want, "tags")
+	want = AppendArrayHeader(want, 22)
+	for i := 0; i < 20; i++ {
+		want = AppendUint64(want, uint64(i))
+	}
+	want = AppendMapHeader(want, 0)
+	want = AppendArrayHeader(want, 1)
+	want = AppendNil(want)
+	want = AppendString(want, "more")
+	want = AppendMapHeader(want, 6)
+	want = AppendString(want, "ok")
+	want = AppendBool(want, true)
+	want = AppendString(want, "f")
+	want = AppendFloat64(want, 1.5)
+	want = AppendString(want, "bin")
+	want = AppendBytes(want, []byte(long))
+	want = AppendString(want, "t")
+	want = AppendTime(want, tm)
+	want = AppendString(want, "raw")
+	want = AppendInt64(want, 7)
+	want = AppendString(want, "intf")
+	want = AppendArrayHeader(want, 1)
+	want = AppendString(want, "a")
+	want = AppendString(want, "second")
+	if !bytes.Equal(got, want) {
+		t.Errorf("got  % x\nwant % x", got, want)
+	}
+
+	// The Writer gets the same bytes.
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	wb := NewWriterBuilder(w)
+	wb.Map(func(m *MapBuilder) {
+		m.String("name", "gopher")
+	})
+	wb.Int(1)
+	if _, err := wb.Finish(); err != nil {
+		t.Fatal(err)
+	}
+	w.Flush()
+	want = AppendMapHeader(nil, 1)
+	want = AppendString(want, "name")
+	want = AppendString(want, "gopher")
+	want = AppendInt64(want, 1)
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("got  % x\nwant % x", buf.Bytes(), want)
+	}
+}
+
+func TestBuilderMisuse(t *testing.T) {
+	cases := map[string]func(b *Builder){
+		"outer inside nested": func(b *Builder) {
+			b.Map(func(m *MapBuilder) {
+				m.Array("a", func(*ArrayBuilder) {
+					m.Int("b", 1)
+				})
+			})
+		},
+		"after return": func(b *Builder) {
+			var saved *ArrayBuilder
+			b.Array(func(a *ArrayBuilder) { saved = a })
+			saved.Int(1)
+		},
+		"top level inside nested": func(b *Builder) {
+			b.Array(func(*ArrayBuilder) { b.Int(1) })
+		},
+		"finish inside nested": func(b *Builder) {
+			b.Array(func(*ArrayBuilder) { b.Finish() })
+		},
+	}
+	for name, fn := range cases {
+		b := NewBuilder(nil)
+		fn(b)
+		if _, err := b.Finish(); err == nil {
+			t.Errorf("%s: no error", name)
+		} else if _, ok := err.(BuilderError); !ok {
+			t.Errorf("%s: got error %v; want a BuilderError", name, err)
+		}
+	}
+
+	// In debug mode, duplicate keys are misuse, and misuse panics.
+	b := NewBuilder(nil)
+	b.Map(func(m *MapBuilder) {
+		m.Int("a", 1)
+		m.Int("a", 2)
+	})
+	if _, err := b.Finish(); err != nil {
+		t.Errorf("got error %v without debug mode", err)
+	}
+	defer func() {
+		if _, ok := recover().(BuilderError); !ok {
+			t.Error("no BuilderError panic in debug mode")
+		}
+	}()
+	b = NewBuilder(nil)
+	b.Debug = true
+	b.Map(func(m *MapBuilder) {
+		m.Int("a", 1)
+		m.Int("a", 2)
+	})
+}
@@ -0,0 +1,209 @@
+package msgp
+
+import (
+	"bytes"
+	"hash"
+	"math"
+	"sort"
+)
+
+// EqualOptions loosen the comparison of objects by Equal, Compare, Hash, and AppendCanonical.
+// A nil *EqualOptions is the same as the zero EqualOptions.
+type EqualOptions struct {
+	// NumbersByValue makes integers equal to the floats with the same value, so 1 equals 1.0.
+	NumbersByValue bool
+
+	// BinAsString makes binary objects equal to the strings with the same bytes.
+	BinAsString bool
+}
+
+// Canonicalize returns the canonical form of the first object in raw, in which objects that mean
+// the same thing are encoded the same way:
+//
+//  - Integers are encoded in the fewest bytes, as unsigned integers if they are not negative.
+//  - Floats are encoded as float64, with a single NaN and no negative zero.
+//  - Strings, binary objects, arrays, maps, and extensions have the shortest headers.
+//  - Map entries are sorted by the canonical encodings of their keys (and values).
+//
+// Canonicalize keeps integers apart from floats and strings apart from binary objects;
+// AppendCanonical can merge them.
+func Canonicalize(raw []byte) ([]byte, error) {
+	return AppendCanonical(nil, raw, nil)
+}
+
+// AppendCanonical appends the canonical form of the first object in raw to b. With opts, integral
+// floats are encoded as integers (NumbersByValue) and binary objects as strings (BinAsString).
+// See Canonicalize.
+func AppendCanonical(b []byte, raw []byte, opts *EqualOptions) ([]byte, error) {
+	if opts == nil {
+		opts = new(EqualOptions)
+	}
+	b, _, err := appendCanonical(b, raw, opts)
+	return b, err
+}
+
+// Equal says if the first objects in a and b are equal once canonicalized with opts. Objects
+// that cannot be decoded are not equal to anything.
+func Equal(a, b []byte, opts *EqualOptions) bool {
+	ca, err := AppendCanonical(nil, a, opts)
+	if err != nil {
+		return false
+	}
+	cb, err := AppendCanonical(nil, b, opts)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(ca, cb)
+}
+
+// Compare compares the first objects in a and b, returning 0 if they are equal as with Equal,
+// -1 if a is less than b, and +1 otherwise. The order is that of the bytes of the canonical forms,
+// which is fit for sorting and deduplication but is not the numeric order of numbers.
+func Compare(a, b []byte, opts *EqualOptions) (int, error) {
+	ca, err := AppendCanonical(nil, a, opts)
+	if err != nil {
+		return 0, err
+	}
+	cb, err := AppendCanonical(nil, b, opts)
+	if err != nil {
+		return 0, err
+	}
+	return bytes.Compare(ca, cb), nil
+}
+
+// Hash writes the canonical form of the first object in raw to h, so that objects that are equal
+// as with Equal with the same opts have the same hash.
+func Hash(raw []byte, h hash.Hash, opts *EqualOptions) error {
+	c, err := AppendCanonical(nil, raw, opts)
+	if err != nil {
+		return err
+	}
+	_, err = h.Write(c)
+	return err
+}
+
+// appendCanonical appends the canonical form of the next object in raw to b and returns the
+// bytes after the object.
+func appendCanonical(b, raw []byte, opts *EqualOptions) ([]byte, []byte, error) {
+	if len(raw) < 1 {
+		return b, raw, ErrShortBytes
+	}
+	switch NextType(raw) {
+	case NilType:
+		raw, err := ReadNilBytes(raw)
+		return AppendNil(b), raw, err
+	case BoolType:
+		v, raw, err := ReadBoolBytes(raw)
+		return AppendBool(b, v), raw, err
+	case IntType, UintType, Float32Type, Float64Type:
+		var n Number
+		raw, err := n.UnmarshalMsg(raw)
+		if err != nil {
+			return b, raw, err
+		}
+		return appendCanonicalNumber(b, &n, opts), raw, nil
+	case StrType:
+		s, raw, err := ReadStringZC(raw)
+		return AppendString(b, string(s)), raw, err
+	case BinType:
+		v, raw, err := ReadBytesZC(raw)
+		if opts.BinAsString {
+			return AppendString(b, string(v)), raw, err
+		}
+		return AppendBytes(b, v), raw, err
+	case ArrayType:
+		sz, raw, err := ReadArrayHeaderBytes(raw)
+		if err != nil {
+			return b, raw, err
+		}
+		b = AppendArrayHeader(b, sz)
+		for i := uint32(0); i < sz; i++ {
+			if b, raw, err = appendCanonical(b, raw, opts); err != nil {
+				return b, raw, err
+			}
+		}
+		return b, raw, nil
+	case MapType:
+		return appendCanonicalMap(b, raw, opts)
+	case InvalidType:
+		return b, raw, InvalidPrefixError(raw[0])
+	}
+	// The other types are extensions, whose data is kept as it is.
+	typ, err := peekExtension(raw)
+	if err != nil {
+		return b, raw, err
+	}
+	e := RawExtension{Type: typ}
+	if raw, err = ReadExtensionBytes(raw, &e); err != nil {
+		return b, raw, err
+	}
+	b, err = AppendExtension(b, &e)
+	return b, raw, err
+}
+
+func appendCanonicalNumber(b []byte, n *Number, opts *EqualOptions) []byte {
+	if i, ok := n.Int(); ok {
+		if i >= 0 {
+			return AppendUint64(b, uint64(i))
+		}
+		return AppendInt64(b, i)
+	}
+	if u, ok := n.Uint(); ok {
+		return AppendUint64(b, u)
+	}
+	f, _ := n.Float()
+	if math.IsNaN(f) {
+		return AppendFloat64(b, math.NaN())
+	}
+	if f == 0 {
+		f = 0 // no negative zero
+	}
+	if opts.NumbersByValue && f == math.Trunc(f) {
+		if f >= 0 && f < 1<<64 {
+			return AppendUint64(b, uint64(f))
+		}
+		if f < 0 && f >= -1<<63 {
+			return AppendInt64(b, int64(f))
+		}
+	}
+	return AppendFloat64(b, f)
+}
+
+// appendCanonicalMap appends a map with its entries sorted by their canonical encodings.
+func appendCanonicalMap(b, raw []byte, opts *EqualOptions) ([]byte, []byte, error) {
+	sz, raw, err := ReadMapHeaderBytes(raw)
+	if err != nil {
+		return b, raw, err
+	}
+	// Each entry is the canonical key followed by the canonical value.
+	var buf []byte
+	var ends, keyEnds []int
+	for i := uint32(0); i < sz; i++ {
+		if buf, raw, err = appendCanonical(buf, raw, opts); err != nil {
+			return b, raw, err
+		}
+		keyEnds = append(keyEnds, len(buf))
+		if buf, raw, err = appendCanonical(buf, raw, opts); err != nil {
+			return b, raw, err
+		}
+		ends = append(ends, len(buf))
+	}
+	type entry struct{ key, kv []byte }
+	entries := make([]entry, sz)
+	start := 0
+	for i := range entries {
+		entries[i] = entry{key: buf[start:keyEnds[i]], kv: buf[start:ends[i]]}
+		start = ends[i]
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if c := bytes.Compare(entries[i].key, entries[j].key); c != 0 {
+			return c < 0
+		}
+		return bytes.Compare(entries[i].kv, entries[j].kv) < 0
+	})
+	b = AppendMapHeader(b, sz)
+	for _, e := range entries {
+		b = append(b, e.kv...)
+	}
+	return b, raw, nil
+}
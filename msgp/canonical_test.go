@@ -0,0 +1,117 @@
+package msgp
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"math"
+	"testing"
+)
+
+func TestCanonicalize(t *testing.T) {
+	// {"b": int8(1), "a": [float32(1.5), "x"]} written with wide encodings
+	a := AppendMapHeader(nil, 2)
+	a = AppendString(a, "b")
+	a = append(a, mint8, 1)
+	a = AppendString(a, "a")
+	a = append(a, marray16, 0, 2)
+	a = AppendFloat32(a, 1.5)
+	a = append(a, mstr8, 1, 'x')
+
+	// the same in the other order with the smallest encodings
+	b := AppendMapHeader(nil, 2)
+	b = AppendString(b, "a")
+	b = AppendArrayHeader(b, 2)
+	b = AppendFloat64(b, 1.5)
+	b = AppendString(b, "x")
+	b = AppendString(b, "b")
+	b = AppendUint(b, 1)
+
+	ca, err := Canonicalize(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(ca, b) {
+		t.Errorf("canonicalized to %x; want %x", ca, b)
+	}
+	if !Equal(a, b, nil) {
+		t.Error("not equal")
+	}
+	if c, err := Compare(a, b, nil); c != 0 || err != nil {
+		t.Errorf("Compare = %d, %v", c, err)
+	}
+
+	ha, hb := sha256.New(), sha256.New()
+	if err = Hash(a, ha, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = Hash(b, hb, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(ha.Sum(nil), hb.Sum(nil)) {
+		t.Error("the hashes differ")
+	}
+}
+
+func TestCanonicalExtensionLengths(t *testing.T) {
+	for _, c := range []struct {
+		n      int
+		header int
+	}{{255, 3}, {256, 4}, {65535, 4}, {65536, 6}} {
+		// the data written with an ext32 header
+		raw := []byte{mext32, byte(c.n >> 24), byte(c.n >> 16), byte(c.n >> 8), byte(c.n), 20}
+		raw = append(raw, make([]byte, c.n)...)
+		b, err := Canonicalize(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(b) != c.header+c.n {
+			t.Errorf("%d bytes: the header is %d bytes; want %d", c.n, len(b)-c.n, c.header)
+		}
+		if err = Validate(b, Strict); err != nil {
+			t.Errorf("%d bytes: %v", c.n, err)
+		}
+	}
+}
+
+func TestEqualNumbers(t *testing.T) {
+	tests := []struct {
+		a, b  []byte
+		opts  *EqualOptions
+		equal bool
+	}{
+		{AppendInt64(nil, 200), AppendUint8(nil, 200), nil, true},
+		{AppendInt64(nil, -3), append([]byte{mint32}, 0xff, 0xff, 0xff, 0xfd), nil, true},
+		{AppendFloat32(nil, 0.25), AppendFloat64(nil, 0.25), nil, true},
+		{AppendFloat64(nil, math.Copysign(0, -1)), AppendFloat64(nil, 0), nil, true},
+		{AppendFloat64(nil, math.NaN()), AppendFloat32(nil, float32(math.NaN())), nil, true},
+		{AppendInt(nil, 1), AppendFloat64(nil, 1), nil, false},
+		{AppendInt(nil, -1), AppendFloat64(nil, -1), &EqualOptions{NumbersByValue: true}, true},
+		{AppendInt(nil, 1), AppendFloat64(nil, 1.5), &EqualOptions{NumbersByValue: true}, false},
+		{AppendString(nil, "ab"), AppendBytes(nil, []byte("ab")), nil, false},
+		{AppendString(nil, "ab"), AppendBytes(nil, []byte("ab")), &EqualOptions{BinAsString: true}, true},
+		{AppendNil(nil), AppendBool(nil, false), nil, false},
+		{[]byte{mmap16}, AppendNil(nil), nil, false},
+	}
+	for i, tt := range tests {
+		if got := Equal(tt.a, tt.b, tt.opts); got != tt.equal {
+			t.Errorf("%d: Equal(%x, %x) = %t", i, tt.a, tt.b, got)
+		}
+		ha, hb := sha256.New(), sha256.New()
+		if Hash(tt.a, ha, tt.opts) == nil && Hash(tt.b, hb, tt.opts) == nil && bytes.Equal(ha.Sum(nil), hb.Sum(nil)) != tt.equal {
+			t.Errorf("%d: the hashes of %x and %x are equal: %t", i, tt.a, tt.b, !tt.equal)
+		}
+	}
+}
+
+func TestCompareOrder(t *testing.T) {
+	one, two := AppendInt(nil, 1), AppendInt(nil, 2)
+	if c, _ := Compare(one, two, nil); c != -1 {
+		t.Errorf("Compare(1, 2) = %d", c)
+	}
+	if c, _ := Compare(two, one, nil); c != 1 {
+		t.Errorf("Compare(2, 1) = %d", c)
+	}
+	if _, err := Compare([]byte{mstr8}, one, nil); err == nil {
+		t.Error("no error for a short object")
+	}
+}
@@ -0,0 +1,168 @@
+// Package cbor converts between CBOR (RFC 8949) and MessagePack without decoding into Go values.
+//
+// Like msgp.CopyToJSON, the functions of this package stream objects from a reader to a writer
+// until EOF. The major types of CBOR map to MessagePack types as follows:
+//
+//  - Unsigned and negative integers are integers. Negative integers below math.MinInt64
+//    become msgp.BigIntExtension objects.
+//  - Byte strings are binary objects and text strings are strings. Indefinite-length strings,
+//    arrays, and maps are joined into definite-length ones.
+//  - false, true, null, and floats are themselves. Half-precision floats become float32.
+//
+// Tags map to extensions:
+//
+//  - The timestamp tags 0 (RFC 3339 text) and 1 (epoch seconds) and the extended time tag 1001
+//    (RFC 9581) become msgp.TimeExtension objects. Fractional epoch times are rounded to the
+//    nearest nanosecond.
+//  - The bignum tags 2 and 3 become msgp.BigIntExtension objects.
+//  - Tag 37 (UUID) becomes a msgp.UUIDExtension object.
+//  - Tag ExtensionTag holds a MessagePack extension that has no CBOR counterpart.
+//  - The self-described CBOR tag 55799 is dropped.
+//  - Any other tag becomes a TagExtension object.
+//
+// Going the other way, MessagePack objects are written as the CBOR items above, with definite
+// lengths and floats of the same precision. Times without fractional seconds are written with
+// tag 1 and the others with tag 1001, so no precision is lost.
+//
+// Some values have no exact counterpart in the other format: the CBOR undefined and simple values,
+// offsets of RFC 3339 times, epoch times finer than a nanosecond, and MessagePack strings that are
+// not valid UTF-8. A Transcoder fails with a LossError on the first of these unless AllowLossy is
+// set, in which case it converts them as best it can and records them in Losses. So a conversion
+// without an error is exact.
+package cbor
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"github.com/dchenk/msgp/msgp"
+)
+
+const (
+	// TagExtension is the MessagePack extension type of CBOR tags that have no MessagePack
+	// counterpart. The data is the tag number as a MessagePack unsigned integer followed by the
+	// tagged item in MessagePack. The type is one of those that package msgp reserves for the
+	// packages of this module.
+	TagExtension = -122
+
+	// ExtensionTag is the CBOR tag of MessagePack extensions that have no CBOR counterpart.
+	// The tagged item is an array of the extension type and a byte string of the data.
+	ExtensionTag = 0x6d736770 // "msgp"
+)
+
+// The tags that have a MessagePack counterpart.
+const (
+	tagTimeText     = 0
+	tagTimeEpoch    = 1
+	tagPosBignum    = 2
+	tagNegBignum    = 3
+	tagUUID         = 37
+	tagTimeExt      = 1001
+	tagSelfDescribe = 55799
+)
+
+// A LossError reports a value that has no exact counterpart in the format being written.
+type LossError struct {
+	Value  string // a description of the value read
+	Result string // what the value was converted to
+}
+
+// Error implements the error interface.
+func (e LossError) Error() string {
+	return fmt.Sprintf("cbor: lossy conversion of %s to %s", e.Value, e.Result)
+}
+
+// A SyntaxError is returned when the CBOR input is not well-formed or a tag does not hold the
+// kind of item it must.
+type SyntaxError struct {
+	Offset int64 // the byte offset of the error in the input
+	Msg    string
+}
+
+// Error implements the error interface.
+func (e SyntaxError) Error() string {
+	return fmt.Sprintf("cbor: %s at offset %d", e.Msg, e.Offset)
+}
+
+// A Transcoder converts between CBOR and MessagePack. The zero Transcoder fails on the first
+// lossy conversion.
+type Transcoder struct {
+	// AllowLossy makes the Transcoder convert the values that have no exact counterpart as
+	// best it can, recording each in Losses, instead of failing with a LossError.
+	AllowLossy bool
+
+	// Losses lists the lossy conversions made, in order, if AllowLossy is set.
+	Losses []LossError
+}
+
+// CopyToMsgp reads CBOR from src and writes it as MessagePack to dst until EOF, failing on
+// lossy conversions. It returns the number of bytes written.
+func CopyToMsgp(dst io.Writer, src io.Reader) (int64, error) {
+	return new(Transcoder).ToMsgp(dst, src)
+}
+
+// CopyFromMsgp reads MessagePack from src and writes it as CBOR to dst until EOF, failing on
+// lossy conversions. It returns the number of bytes written.
+func CopyFromMsgp(dst io.Writer, src io.Reader) (int64, error) {
+	return new(Transcoder).FromMsgp(dst, src)
+}
+
+// ToMsgp reads CBOR from src and writes it as MessagePack to dst until src returns io.EOF
+// between items. It returns the number of bytes written.
+func (t *Transcoder) ToMsgp(dst io.Writer, src io.Reader) (int64, error) {
+	cw := &countWriter{w: dst}
+	d := &decoder{t: t, r: bufio.NewReader(src), w: msgp.NewWriter(cw)}
+	for {
+		if _, err := d.r.Peek(1); err == io.EOF {
+			break
+		} else if err != nil {
+			return cw.n, err
+		}
+		if err := d.value(); err != nil {
+			d.w.Flush()
+			return cw.n, err
+		}
+	}
+	err := d.w.Flush()
+	return cw.n, err
+}
+
+// FromMsgp reads MessagePack from src and writes it as CBOR to dst until src returns io.EOF
+// between objects. It returns the number of bytes written.
+func (t *Transcoder) FromMsgp(dst io.Writer, src io.Reader) (int64, error) {
+	cw := &countWriter{w: dst}
+	e := &encoder{t: t, w: bufio.NewWriter(cw), r: msgp.NewReader(src)}
+	var err error
+	for err == nil {
+		err = e.object()
+	}
+	if err != io.EOF {
+		e.w.Flush()
+		return cw.n, err
+	}
+	err = e.w.Flush()
+	return cw.n, err
+}
+
+// lose reports a lossy conversion of value to result.
+func (t *Transcoder) lose(value, result string) error {
+	l := LossError{Value: value, Result: result}
+	if !t.AllowLossy {
+		return l
+	}
+	t.Losses = append(t.Losses, l)
+	return nil
+}
+
+// countWriter counts the bytes written to w.
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,259 @@
+package cbor
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"math"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/dchenk/msgp/msgp"
+)
+
+func fromHex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestToMsgp(t *testing.T) {
+	bigNeg, _ := new(big.Int).SetString("-18446744073709551616", 10)
+	uri := msgp.AppendUint64(nil, 32)
+	uri = msgp.AppendString(uri, "http://www.example.com")
+
+	// Most of the items are from Appendix A of RFC 8949.
+	cases := []struct {
+		in   string
+		want []byte
+	}{
+		{"00", msgp.AppendInt64(nil, 0)},
+		{"1903e8", msgp.AppendInt64(nil, 1000)},
+		{"1bffffffffffffffff", msgp.AppendUint64(nil, math.MaxUint64)},
+		{"3903e7", msgp.AppendInt64(nil, -1000)},
+		{"3b7fffffffffffffff", msgp.AppendInt64(nil, math.MinInt64)},
+		{"3bffffffffffffffff", msgp.AppendBigInt(nil, bigNeg)},
+		{"c249010000000000000000", msgp.AppendBigInt(nil, new(big.Int).Lsh(big.NewInt(1), 64))},
+		{"f93c00", msgp.AppendFloat32(nil, 1)},
+		{"f97bff", msgp.AppendFloat32(nil, 65504)},
+		{"f90001", msgp.AppendFloat32(nil, 5.960464477539063e-8)},
+		{"f9c400", msgp.AppendFloat32(nil, -4)},
+		{"f97c00", msgp.AppendFloat32(nil, float32(math.Inf(1)))},
+		{"fa47c35000", msgp.AppendFloat32(nil, 100000)},
+		{"fb3ff199999999999a", msgp.AppendFloat64(nil, 1.1)},
+		{"f4", msgp.AppendBool(nil, false)},
+		{"f6", msgp.AppendNil(nil)},
+		{"4401020304", msgp.AppendBytes(nil, []byte{1, 2, 3, 4})},
+		{"6449455446", msgp.AppendString(nil, "IETF")},
+		{"5f42010243030405ff", msgp.AppendBytes(nil, []byte{1, 2, 3, 4, 5})},
+		{"7f657374726561646d696e67ff", msgp.AppendString(nil, "streaming")},
+		{"8301820203820405", fromHex(t, "9301920203920405")},
+		{"9f018202039f0405ffff", fromHex(t, "9301920203920405")},
+		{"bf61610161629f0203ffff", fromHex(t, "82a16101a162920203")},
+		{"c074323031332d30332d32315432303a30343a30305a", msgp.AppendTime(nil, time.Unix(1363896240, 0))},
+		{"c11a514b67b0", msgp.AppendTime(nil, time.Unix(1363896240, 0))},
+		{"c1fb41d452d9ec200000", msgp.AppendTime(nil, time.Unix(1363896240, 5e8))},
+		{"d903e9a2011a514b67b0251903e7", msgp.AppendTime(nil, time.Unix(1363896240, 999e3))},
+		{"d82550000102030405060708090a0b0c0d0e0f", mustExt(t, &msgp.UUID{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15})},
+		{"d9d9f701", msgp.AppendInt64(nil, 1)},
+		{"d82076687474703a2f2f7777772e6578616d706c652e636f6d", mustExt(t, &msgp.RawExtension{Type: TagExtension, Data: uri})},
+		{"da6d73677082182a4401020304", mustExt(t, &msgp.RawExtension{Type: 42, Data: []byte{1, 2, 3, 4}})},
+		{"0102", []byte{1, 2}},
+	}
+	for _, c := range cases {
+		var out bytes.Buffer
+		n, err := CopyToMsgp(&out, bytes.NewReader(fromHex(t, c.in)))
+		if err != nil {
+			t.Errorf("%s: %v", c.in, err)
+			continue
+		}
+		if n != int64(out.Len()) {
+			t.Errorf("%s: returned %d bytes written; wrote %d", c.in, n, out.Len())
+		}
+		if !equalAll(out.Bytes(), c.want) {
+			t.Errorf("%s: got % x; want % x", c.in, out.Bytes(), c.want)
+		}
+	}
+}
+
+// equalAll says if a and b hold the same objects as with msgp.Equal.
+func equalAll(a, b []byte) bool {
+	for len(a) > 0 || len(b) > 0 {
+		if !msgp.Equal(a, b, nil) {
+			return false
+		}
+		a, _ = msgp.Skip(a)
+		b, _ = msgp.Skip(b)
+	}
+	return true
+}
+
+func mustExt(t *testing.T, e msgp.Extension) []byte {
+	b, err := msgp.AppendExtension(nil, e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestToMsgpErrors(t *testing.T) {
+	for _, in := range []string{"ff", "1c", "8201ff", "5f6161ff", "c06161", "c1f5"} {
+		_, err := CopyToMsgp(io.Discard, bytes.NewReader(fromHex(t, in)))
+		if _, ok := err.(SyntaxError); !ok {
+			t.Errorf("%s: got error %v; want a SyntaxError", in, err)
+		}
+	}
+	for _, in := range []string{"1903", "830102", "62ff"} {
+		_, err := CopyToMsgp(io.Discard, bytes.NewReader(fromHex(t, in)))
+		if err != io.ErrUnexpectedEOF {
+			t.Errorf("%s: got error %v; want io.ErrUnexpectedEOF", in, err)
+		}
+	}
+}
+
+func TestLossy(t *testing.T) {
+	in := fromHex(t, "83f7f0c07819323031332d30332d32315432313a30343a30302b30313a3030")
+
+	_, err := CopyToMsgp(io.Discard, bytes.NewReader(in))
+	if _, ok := err.(LossError); !ok {
+		t.Fatalf("got error %v; want a LossError", err)
+	}
+
+	tr := Transcoder{AllowLossy: true}
+	var out bytes.Buffer
+	if _, err = tr.ToMsgp(&out, bytes.NewReader(in)); err != nil {
+		t.Fatal(err)
+	}
+	want := msgp.AppendArrayHeader(nil, 3)
+	want = msgp.AppendNil(want)
+	want = msgp.AppendNil(want)
+	want = msgp.AppendTime(want, time.Unix(1363896240, 0))
+	if !equalAll(out.Bytes(), want) {
+		t.Errorf("got % x; want % x", out.Bytes(), want)
+	}
+	if len(tr.Losses) != 3 {
+		t.Errorf("got losses %v; want 3", tr.Losses)
+	}
+
+	// An epoch time of 1e-10 seconds is rounded to the epoch.
+	epoch := fromHex(t, "c1fb3ddb7cdfd9d7bdbb")
+	if _, err = CopyToMsgp(io.Discard, bytes.NewReader(epoch)); err == nil {
+		t.Error("no error for an epoch time that is rounded")
+	}
+	out.Reset()
+	tr.Losses = nil
+	if _, err = tr.ToMsgp(&out, bytes.NewReader(epoch)); err != nil {
+		t.Fatal(err)
+	}
+	if !equalAll(out.Bytes(), msgp.AppendTime(nil, time.Unix(0, 0))) || len(tr.Losses) != 1 {
+		t.Errorf("got % x with losses %v", out.Bytes(), tr.Losses)
+	}
+
+	bad := msgp.AppendString(nil, "\xff")
+	if _, err = CopyFromMsgp(io.Discard, bytes.NewReader(bad)); err == nil {
+		t.Error("no error for a string that is not valid UTF-8")
+	}
+	out.Reset()
+	tr.Losses = nil
+	if _, err = tr.FromMsgp(&out, bytes.NewReader(bad)); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), []byte{0x41, 0xff}) || len(tr.Losses) != 1 {
+		t.Errorf("got % x with losses %v", out.Bytes(), tr.Losses)
+	}
+}
+
+func TestFromMsgp(t *testing.T) {
+	cases := []struct {
+		in   []byte
+		want string
+	}{
+		{msgp.AppendInt64(nil, -1000), "3903e7"},
+		{msgp.AppendUint64(nil, math.MaxUint64), "1bffffffffffffffff"},
+		{msgp.AppendFloat32(nil, 1), "fa3f800000"},
+		{msgp.AppendFloat64(nil, 1.1), "fb3ff199999999999a"},
+		{msgp.AppendString(nil, "IETF"), "6449455446"},
+		{msgp.AppendBytes(nil, []byte{1, 2}), "420102"},
+		{fromHex(t, "82a16101a162920203"), "a26161016162820203"},
+		{msgp.AppendTime(nil, time.Unix(1363896240, 0)), "c11a514b67b0"},
+		{msgp.AppendTime(nil, time.Unix(1363896240, 5)), "d903e9a2011a514b67b02805"},
+		{msgp.AppendBigInt(nil, big.NewInt(-256)), "c341ff"},
+		{mustExt(t, &msgp.RawExtension{Type: 42, Data: []byte{1, 2}}), "da6d73677082182a420102"},
+		{mustExt(t, &msgp.RawExtension{Type: 11, Data: []byte{1, 2}}), "da6d736770820b420102"},
+		{msgp.AppendNil(msgp.AppendBool(nil, true)), "f5f6"},
+	}
+	for _, c := range cases {
+		var out bytes.Buffer
+		if _, err := CopyFromMsgp(&out, bytes.NewReader(c.in)); err != nil {
+			t.Errorf("% x: %v", c.in, err)
+			continue
+		}
+		if got := hex.EncodeToString(out.Bytes()); got != c.want {
+			t.Errorf("% x: got %s; want %s", c.in, got, c.want)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	var m []byte
+	m = msgp.AppendMapHeader(m, 3)
+	m = msgp.AppendString(m, "ints")
+	m = msgp.AppendArrayHeader(m, 4)
+	m = msgp.AppendInt64(m, math.MinInt64)
+	m = msgp.AppendInt64(m, -33)
+	m = msgp.AppendUint64(m, 300)
+	m = msgp.AppendUint64(m, math.MaxUint64)
+	m = msgp.AppendInt64(m, 7)
+	m = msgp.AppendComplex128(m, complex(1, 2))
+	m = msgp.AppendBytes(m, nil)
+	m = msgp.AppendArrayHeader(m, 4)
+	m = msgp.AppendTime(m, time.Unix(-5, 123456789))
+	m = msgp.AppendBigInt(m, new(big.Int).Lsh(big.NewInt(-3), 100))
+	m = msgp.AppendFloat64(m, math.Inf(-1))
+	m = msgp.AppendFloat32(m, float32(math.NaN()))
+	tagged, err := hex.DecodeString("d82076687474703a2f2f7777772e6578616d706c652e636f6d")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var c, back bytes.Buffer
+	if _, err := CopyFromMsgp(&c, bytes.NewReader(m)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CopyToMsgp(&back, bytes.NewReader(c.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if !equalAll(back.Bytes(), m) {
+		t.Errorf("got % x; want % x", back.Bytes(), m)
+	}
+
+	back.Reset()
+	c.Reset()
+	if _, err := CopyToMsgp(&back, bytes.NewReader(tagged)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CopyFromMsgp(&c, bytes.NewReader(back.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(c.Bytes(), tagged) {
+		t.Errorf("got % x; want % x", c.Bytes(), tagged)
+	}
+}
+
+func TestTagExtensionData(t *testing.T) {
+	data := msgp.AppendString(msgp.AppendUint64(nil, 32), "http://www.example.com")
+	for _, bad := range [][]byte{
+		append(data, 0xc0),
+		data[:len(data)-1],
+		msgp.AppendUint64(nil, 32),
+	} {
+		var out bytes.Buffer
+		in := mustExt(t, &msgp.RawExtension{Type: TagExtension, Data: bad})
+		if _, err := CopyFromMsgp(&out, bytes.NewReader(in)); err == nil {
+			t.Errorf("% x: got % x and no error", bad, out.Bytes())
+		}
+	}
+}
@@ -0,0 +1,441 @@
+package cbor
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"time"
+
+	"github.com/dchenk/msgp/msgp"
+)
+
+// errBreak is returned by item for the "break" stop code, which ends an indefinite-length item.
+var errBreak = errors.New("cbor: break")
+
+// decoder converts CBOR read from r to MessagePack written to w.
+type decoder struct {
+	t   *Transcoder
+	r   *bufio.Reader
+	w   *msgp.Writer
+	off int64 // the number of bytes read from r
+}
+
+func (d *decoder) syntax(off int64, msg string) error {
+	return SyntaxError{Offset: off, Msg: msg}
+}
+
+func (d *decoder) readByte() (byte, error) {
+	c, err := d.r.ReadByte()
+	if err == io.EOF {
+		return 0, io.ErrUnexpectedEOF
+	}
+	if err == nil {
+		d.off++
+	}
+	return c, err
+}
+
+// read reads the n bytes of a string.
+func (d *decoder) read(n uint64) ([]byte, error) {
+	if n > math.MaxUint32 {
+		return nil, d.syntax(d.off, "string too long for MessagePack")
+	}
+	var buf bytes.Buffer
+	m, err := io.CopyN(&buf, d.r, int64(n))
+	d.off += m
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return buf.Bytes(), err
+}
+
+// head reads the head of an item: its major type, additional information, and argument.
+// The argument is not set if the additional information is 31 (an indefinite length).
+func (d *decoder) head() (major, info byte, arg uint64, err error) {
+	c, err := d.readByte()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	major, info = c>>5, c&0x1f
+	switch {
+	case info < 24:
+		arg = uint64(info)
+	case info <= 27:
+		for i := 0; i < 1<<(info-24); i++ {
+			if c, err = d.readByte(); err != nil {
+				return 0, 0, 0, err
+			}
+			arg = arg<<8 | uint64(c)
+		}
+	case info != 31:
+		err = d.syntax(d.off-1, fmt.Sprintf("reserved additional information %d", info))
+	}
+	return major, info, arg, err
+}
+
+// value converts an item that may not be a break.
+func (d *decoder) value() error {
+	start := d.off
+	err := d.item()
+	if err == errBreak {
+		return d.syntax(start, "unexpected break")
+	}
+	return err
+}
+
+// item converts an item, returning errBreak if it is the break stop code.
+func (d *decoder) item() error {
+	start := d.off
+	major, info, arg, err := d.head()
+	if err != nil {
+		return err
+	}
+	if info == 31 {
+		switch major {
+		case 2, 3:
+			return d.chunks(start, major)
+		case 4, 5:
+			return d.indefinite(start, major)
+		case 7:
+			return errBreak
+		}
+		return d.syntax(start, fmt.Sprintf("indefinite length for major type %d", major))
+	}
+	switch major {
+	case 0:
+		return d.w.WriteUint64(arg)
+	case 1:
+		if arg <= math.MaxInt64 {
+			return d.w.WriteInt64(-1 - int64(arg))
+		}
+		i := new(big.Int).SetUint64(arg)
+		return d.w.WriteBigInt(i.Neg(i.Add(i, big.NewInt(1))))
+	case 2, 3:
+		b, err := d.read(arg)
+		if err != nil {
+			return err
+		}
+		if major == 2 {
+			return d.w.WriteBytes(b)
+		}
+		return d.w.WriteStringFromBytes(b)
+	case 4, 5:
+		if arg > math.MaxUint32 {
+			return d.syntax(start, "container too long for MessagePack")
+		}
+		n := arg
+		if major == 4 {
+			err = d.w.WriteArrayHeader(uint32(arg))
+		} else {
+			err = d.w.WriteMapHeader(uint32(arg))
+			n *= 2
+		}
+		for i := uint64(0); i < n && err == nil; i++ {
+			err = d.value()
+		}
+		return err
+	case 6:
+		return d.tag(start, arg)
+	}
+	return d.simple(start, info, arg)
+}
+
+// chunks converts an indefinite-length string of the given major type.
+func (d *decoder) chunks(start int64, major byte) error {
+	var s []byte
+	for {
+		off := d.off
+		m, info, arg, err := d.head()
+		if err != nil {
+			return err
+		}
+		if m == 7 && info == 31 {
+			break
+		}
+		if m != major || info == 31 {
+			return d.syntax(off, "invalid chunk of an indefinite-length string")
+		}
+		b, err := d.read(arg)
+		if err != nil {
+			return err
+		}
+		s = append(s, b...)
+	}
+	if len(s) > math.MaxUint32 {
+		return d.syntax(start, "string too long for MessagePack")
+	}
+	if major == 2 {
+		return d.w.WriteBytes(s)
+	}
+	return d.w.WriteStringFromBytes(s)
+}
+
+// indefinite converts an indefinite-length array or map, whose items are buffered until the
+// break so that the MessagePack header can be written first.
+func (d *decoder) indefinite(start int64, major byte) error {
+	var n uint32
+	b, err := d.capture(func() error {
+		for {
+			if err := d.item(); err != nil {
+				if err == errBreak {
+					return nil
+				}
+				return err
+			}
+			n++
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if major == 4 {
+		err = d.w.WriteArrayHeader(n)
+	} else if n%2 != 0 {
+		return d.syntax(start, "map with a key but no value")
+	} else {
+		err = d.w.WriteMapHeader(n / 2)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = d.w.Write(b)
+	return err
+}
+
+// capture returns the MessagePack written by fn instead of writing it to d.w.
+func (d *decoder) capture(fn func() error) ([]byte, error) {
+	w := d.w
+	var buf bytes.Buffer
+	d.w = msgp.NewWriter(&buf)
+	err := fn()
+	if err == nil {
+		err = d.w.Flush()
+	}
+	d.w = w
+	return buf.Bytes(), err
+}
+
+// tag converts the item with tag number num.
+func (d *decoder) tag(start int64, num uint64) error {
+	if num == tagSelfDescribe {
+		return d.value()
+	}
+	content, err := d.capture(d.value)
+	if err != nil {
+		return err
+	}
+	switch num {
+	case tagTimeText:
+		s, _, err := msgp.ReadStringBytes(content)
+		if err != nil {
+			return d.syntax(start, "tag 0 does not hold a text string")
+		}
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return d.syntax(start, "tag 0 does not hold an RFC 3339 time")
+		}
+		if _, offset := t.Zone(); offset != 0 {
+			if err := d.t.lose(fmt.Sprintf("the time zone offset of %q", s), "UTC"); err != nil {
+				return err
+			}
+		}
+		return d.w.WriteTime(t)
+	case tagTimeEpoch:
+		var n msgp.Number
+		if _, err := n.UnmarshalMsg(content); err != nil {
+			return d.syntax(start, "tag 1 does not hold a number")
+		}
+		t, ok, err := d.epochTime(&n)
+		if err != nil {
+			return err
+		}
+		return d.writeTime(t, ok)
+	case tagTimeExt:
+		t, ok, err := d.extendedTime(content)
+		if err != nil {
+			return d.syntax(start, err.Error())
+		}
+		return d.writeTime(t, ok)
+	case tagPosBignum, tagNegBignum:
+		b, _, err := msgp.ReadBytesZC(content)
+		if err != nil {
+			return d.syntax(start, fmt.Sprintf("tag %d does not hold a byte string", num))
+		}
+		i := new(big.Int).SetBytes(b)
+		if num == tagNegBignum {
+			i.Neg(i.Add(i, big.NewInt(1)))
+		}
+		return d.w.WriteBigInt(i)
+	case tagUUID:
+		b, _, err := msgp.ReadBytesZC(content)
+		if err != nil || len(b) != 16 {
+			return d.syntax(start, "tag 37 does not hold a 16-byte string")
+		}
+		var u msgp.UUID
+		copy(u[:], b)
+		return d.w.WriteExtension(&u)
+	case ExtensionTag:
+		e, err := rawExtension(content)
+		if err != nil {
+			return d.syntax(start, "tag ExtensionTag does not hold an extension type and data")
+		}
+		return d.w.WriteExtension(&e)
+	}
+	data := msgp.AppendUint64(nil, num)
+	return d.w.WriteExtension(&msgp.RawExtension{Type: TagExtension, Data: append(data, content...)})
+}
+
+// writeTime writes t if ok is set and nil otherwise.
+func (d *decoder) writeTime(t time.Time, ok bool) error {
+	if ok {
+		return d.w.WriteTime(t)
+	}
+	if err := d.t.lose("a time out of range", "nil"); err != nil {
+		return err
+	}
+	return d.w.WriteNil()
+}
+
+// extendedTime reads the map of tag 1001, of which the base time (key 1) and the milliseconds,
+// microseconds, or nanoseconds (keys -3, -6, and -9) are kept.
+func (d *decoder) extendedTime(content []byte) (time.Time, bool, error) {
+	sz, b, err := msgp.ReadMapHeaderBytes(content)
+	if err != nil {
+		return time.Time{}, false, errors.New("tag 1001 does not hold a map")
+	}
+	t, ok := time.Time{}, false
+	var frac time.Duration
+	for i := uint32(0); i < sz; i++ {
+		var key int64
+		if key, b, err = msgp.ReadInt64BytesLenient(b); err != nil {
+			return t, false, errors.New("tag 1001 holds a map with a key that is not an integer")
+		}
+		switch key {
+		case 1:
+			var n msgp.Number
+			if b, err = n.UnmarshalMsg(b); err != nil {
+				return t, false, errors.New("tag 1001 holds a base time that is not a number")
+			}
+			if t, ok, err = d.epochTime(&n); err != nil {
+				return t, false, err
+			}
+		case -3, -6, -9:
+			var v int64
+			if v, b, err = msgp.ReadInt64BytesLenient(b); err != nil {
+				return t, false, errors.New("tag 1001 holds a fraction that is not an integer")
+			}
+			frac = time.Duration(v) * time.Duration(math.Pow10(int(9+key)))
+		default:
+			if err = d.t.lose(fmt.Sprintf("key %d of tag 1001", key), "nothing"); err != nil {
+				return t, false, err
+			}
+			if b, err = msgp.Skip(b); err != nil {
+				return t, false, err
+			}
+		}
+	}
+	return t.Add(frac), ok, nil
+}
+
+// epochTime returns the time n seconds after the Unix epoch, rounded to the nanosecond. It says
+// false if n is not finite or is too far from the epoch. Rounding that changes the time is a
+// lossy conversion.
+func (d *decoder) epochTime(n *msgp.Number) (time.Time, bool, error) {
+	if i, ok := n.Int(); ok {
+		return time.Unix(i, 0), true, nil
+	}
+	if u, ok := n.Uint(); ok {
+		return time.Unix(int64(u), 0), u <= math.MaxInt64, nil
+	}
+	f, _ := n.Float()
+	if math.IsNaN(f) || math.Abs(f) >= 1<<62 {
+		return time.Time{}, false, nil
+	}
+	sec := math.Floor(f)
+	ns := math.Round((f - sec) * 1e9)
+	if sec+ns/1e9 != f {
+		if err := d.t.lose(fmt.Sprintf("the epoch time %v", f), "a time rounded to the nanosecond"); err != nil {
+			return time.Time{}, false, err
+		}
+	}
+	return time.Unix(int64(sec), int64(ns)), true, nil
+}
+
+// rawExtension reads the array of an extension type and data held by ExtensionTag.
+func rawExtension(b []byte) (msgp.RawExtension, error) {
+	var e msgp.RawExtension
+	sz, b, err := msgp.ReadArrayHeaderBytes(b)
+	if err != nil {
+		return e, err
+	}
+	if sz != 2 {
+		return e, msgp.ArrayError{Wanted: 2, Got: sz}
+	}
+	typ, b, err := msgp.ReadInt64BytesLenient(b)
+	if err != nil {
+		return e, err
+	}
+	if typ < math.MinInt8 || typ > math.MaxInt8 {
+		return e, msgp.IntOverflow{Value: typ, FailedBitsize: 8}
+	}
+	e.Type = int8(typ)
+	e.Data, _, err = msgp.ReadBytesZC(b)
+	return e, err
+}
+
+// simple converts an item of major type 7 other than the break.
+func (d *decoder) simple(start int64, info byte, arg uint64) error {
+	switch info {
+	case 20:
+		return d.w.WriteBool(false)
+	case 21:
+		return d.w.WriteBool(true)
+	case 22:
+		return d.w.WriteNil()
+	case 23:
+		if err := d.t.lose("undefined", "nil"); err != nil {
+			return err
+		}
+		return d.w.WriteNil()
+	case 25:
+		return d.w.WriteFloat32(halfToFloat32(uint16(arg)))
+	case 26:
+		return d.w.WriteFloat32(math.Float32frombits(uint32(arg)))
+	case 27:
+		return d.w.WriteFloat64(math.Float64frombits(arg))
+	}
+	if info == 24 && arg < 32 {
+		return d.syntax(start, fmt.Sprintf("simple value %d in two bytes", arg))
+	}
+	if err := d.t.lose(fmt.Sprintf("simple value %d", arg), "nil"); err != nil {
+		return err
+	}
+	return d.w.WriteNil()
+}
+
+// halfToFloat32 converts the bits of a half-precision float to the float32 of the same value.
+func halfToFloat32(h uint16) float32 {
+	sign := uint32(h&0x8000) << 16
+	exp := uint32(h>>10) & 0x1f
+	frac := uint32(h & 0x3ff)
+	switch exp {
+	case 0:
+		if frac == 0 {
+			return math.Float32frombits(sign)
+		}
+		// Normalize the subnormal number.
+		exp = 127 - 14
+		for frac&0x400 == 0 {
+			frac <<= 1
+			exp--
+		}
+		return math.Float32frombits(sign | exp<<23 | (frac&0x3ff)<<13)
+	case 0x1f:
+		return math.Float32frombits(sign | 0xff<<23 | frac<<13)
+	}
+	return math.Float32frombits(sign | (exp+127-15)<<23 | frac<<13)
+}
@@ -0,0 +1,279 @@
+package cbor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"math/big"
+	"unicode/utf8"
+
+	"github.com/dchenk/msgp/msgp"
+)
+
+// encoder converts MessagePack read from r to CBOR written to w.
+type encoder struct {
+	t       *Transcoder
+	r       *msgp.Reader
+	w       *bufio.Writer
+	scratch []byte
+}
+
+// head writes the head of an item with the given major type and argument.
+func (e *encoder) head(major byte, arg uint64) error {
+	var b [9]byte
+	n := 1
+	switch {
+	case arg < 24:
+		b[0] = major<<5 | byte(arg)
+	case arg <= math.MaxUint8:
+		b[0] = major<<5 | 24
+		b[1] = byte(arg)
+		n = 2
+	case arg <= math.MaxUint16:
+		b[0] = major<<5 | 25
+		binary.BigEndian.PutUint16(b[1:], uint16(arg))
+		n = 3
+	case arg <= math.MaxUint32:
+		b[0] = major<<5 | 26
+		binary.BigEndian.PutUint32(b[1:], uint32(arg))
+		n = 5
+	default:
+		b[0] = major<<5 | 27
+		binary.BigEndian.PutUint64(b[1:], arg)
+		n = 9
+	}
+	_, err := e.w.Write(b[:n])
+	return err
+}
+
+func (e *encoder) int(i int64) error {
+	if i < 0 {
+		return e.head(1, uint64(-1-i))
+	}
+	return e.head(0, uint64(i))
+}
+
+// bytes writes a string of major type 2 or 3.
+func (e *encoder) bytes(major byte, b []byte) error {
+	if err := e.head(major, uint64(len(b))); err != nil {
+		return err
+	}
+	_, err := e.w.Write(b)
+	return err
+}
+
+// inner converts an object inside of another, which must be there.
+func (e *encoder) inner() error {
+	err := e.object()
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// object converts the next object from e.r.
+func (e *encoder) object() error {
+	t, err := e.r.NextType()
+	if err != nil {
+		return err
+	}
+	switch t {
+	case msgp.NilType:
+		if err = e.r.ReadNil(); err != nil {
+			return err
+		}
+		return e.w.WriteByte(0xf6)
+	case msgp.BoolType:
+		v, err := e.r.ReadBool()
+		if err != nil {
+			return err
+		}
+		if v {
+			return e.w.WriteByte(0xf5)
+		}
+		return e.w.WriteByte(0xf4)
+	case msgp.IntType:
+		i, err := e.r.ReadInt64()
+		if err != nil {
+			return err
+		}
+		return e.int(i)
+	case msgp.UintType:
+		u, err := e.r.ReadUint64()
+		if err != nil {
+			return err
+		}
+		return e.head(0, u)
+	case msgp.Float32Type:
+		f, err := e.r.ReadFloat32()
+		if err != nil {
+			return err
+		}
+		var b [5]byte
+		b[0] = 0xfa
+		binary.BigEndian.PutUint32(b[1:], math.Float32bits(f))
+		_, err = e.w.Write(b[:])
+		return err
+	case msgp.Float64Type:
+		f, err := e.r.ReadFloat64()
+		if err != nil {
+			return err
+		}
+		var b [9]byte
+		b[0] = 0xfb
+		binary.BigEndian.PutUint64(b[1:], math.Float64bits(f))
+		_, err = e.w.Write(b[:])
+		return err
+	case msgp.StrType:
+		if e.scratch, err = e.r.ReadStringAsBytes(e.scratch[:0]); err != nil {
+			return err
+		}
+		if utf8.Valid(e.scratch) {
+			return e.bytes(3, e.scratch)
+		}
+		if err = e.t.lose("a string that is not valid UTF-8", "a byte string"); err != nil {
+			return err
+		}
+		return e.bytes(2, e.scratch)
+	case msgp.BinType:
+		if e.scratch, err = e.r.ReadBytes(e.scratch[:0]); err != nil {
+			return err
+		}
+		return e.bytes(2, e.scratch)
+	case msgp.ArrayType, msgp.MapType:
+		var sz uint32
+		n := uint64(0)
+		if t == msgp.ArrayType {
+			if sz, err = e.r.ReadArrayHeader(); err == nil {
+				err = e.head(4, uint64(sz))
+			}
+			n = uint64(sz)
+		} else {
+			if sz, err = e.r.ReadMapHeader(); err == nil {
+				err = e.head(5, uint64(sz))
+			}
+			n = 2 * uint64(sz)
+		}
+		for i := uint64(0); i < n && err == nil; i++ {
+			err = e.inner()
+		}
+		return err
+	case msgp.TimeType:
+		tm, err := e.r.ReadTime()
+		if err != nil {
+			return err
+		}
+		if tm.Nanosecond() == 0 {
+			if err = e.head(6, tagTimeEpoch); err != nil {
+				return err
+			}
+			return e.int(tm.Unix())
+		}
+		// The extended time is the map {1: seconds, -9: nanoseconds}.
+		if err = e.head(6, tagTimeExt); err == nil {
+			err = e.head(5, 2)
+		}
+		for _, i := range []int64{1, tm.Unix(), -9, int64(tm.Nanosecond())} {
+			if err != nil {
+				break
+			}
+			err = e.int(i)
+		}
+		return err
+	case msgp.BigIntType:
+		i, err := e.r.ReadBigInt()
+		if err != nil {
+			return err
+		}
+		if i.Sign() >= 0 {
+			if err = e.head(6, tagPosBignum); err != nil {
+				return err
+			}
+			return e.bytes(2, i.Bytes())
+		}
+		if err = e.head(6, tagNegBignum); err != nil {
+			return err
+		}
+		n := new(big.Int).Neg(i)
+		return e.bytes(2, n.Sub(n, big.NewInt(1)).Bytes())
+	case msgp.UUIDType:
+		var u msgp.UUID
+		if err = e.r.ReadExtension(&u); err != nil {
+			return err
+		}
+		if err = e.head(6, tagUUID); err != nil {
+			return err
+		}
+		return e.bytes(2, u[:])
+	}
+	return e.extension()
+}
+
+var errTagData = errors.New("cbor: tag extension holds more than a tag number and an item")
+
+// extension converts an extension that has no CBOR counterpart but ExtensionTag, unless it is
+// a TagExtension.
+func (e *encoder) extension() error {
+	typ, err := e.extensionType()
+	if err != nil {
+		return err
+	}
+	x := msgp.RawExtension{Type: typ}
+	if err = e.r.ReadExtension(&x); err != nil {
+		return err
+	}
+	if typ == TagExtension {
+		num, rest, err := msgp.ReadUint64Bytes(x.Data)
+		if err != nil {
+			return err
+		}
+		if end, err := msgp.Skip(rest); err != nil {
+			return err
+		} else if len(end) > 0 {
+			return errTagData
+		}
+		if err = e.head(6, num); err != nil {
+			return err
+		}
+		r := e.r
+		e.r = msgp.NewReader(bytes.NewReader(rest))
+		err = e.inner()
+		e.r = r
+		return err
+	}
+	if err = e.head(6, ExtensionTag); err != nil {
+		return err
+	}
+	if err = e.head(4, 2); err != nil {
+		return err
+	}
+	if err = e.int(int64(typ)); err != nil {
+		return err
+	}
+	return e.bytes(2, x.Data)
+}
+
+// extensionType peeks at the type of the next extension.
+func (e *encoder) extensionType() (int8, error) {
+	p, err := e.r.R.Peek(2)
+	if err != nil {
+		return 0, err
+	}
+	// The type follows the size, if there is one, after the prefix.
+	n := 2
+	switch p[0] {
+	case 0xc7: // ext8
+		n = 3
+	case 0xc8: // ext16
+		n = 4
+	case 0xc9: // ext32
+		n = 6
+	}
+	if p, err = e.r.R.Peek(n); err != nil {
+		return 0, err
+	}
+	return int8(p[n-1]), nil
+}
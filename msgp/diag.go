@@ -0,0 +1,709 @@
+package msgp
+
+import (
+	hexenc "encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// FormatDiag returns the objects in raw in diagnostic notation, one per line. Unlike JSON, the
+// notation keeps every detail of the encoding, so ParseDiag turns the text back into the same
+// bytes. It is meant for test fixtures and bug reports:
+//
+//  {"a": 1_u16, "b": h'0aff', "c": ext(5, h'00'), 7: [1.5_f32, -2.0, nil]}
+//
+// The notation is like that of CBOR (RFC 8949, section 8):
+//
+//  - nil, true, and false are themselves.
+//  - Integers that fit in one byte (from -32 to 127) are written plainly; the others have a
+//    suffix for their encoding: _u8, _u16, _u32, _u64, _i8, _i16, _i32, or _i64.
+//  - Floats are float64 unless they have the suffix _f32. They always have a decimal point or
+//    an exponent, or are Infinity, -Infinity, or NaN. A NaN other than the one that math.NaN
+//    returns has its bits in hex, like NaN(h'7ff8000000000002').
+//  - Strings are quoted as in Go, and binary objects are in hex, like h'0aff'.
+//  - Arrays are in brackets and maps in braces; the keys may be of any type.
+//  - Extensions are written as ext(type, h'data').
+//
+// Strings, binary objects, arrays, maps, and extensions have the suffix _8, _16, or _32 if the
+// size in their header does not have the width that the Append functions of this package use
+// (the smallest that fits).
+func FormatDiag(raw []byte) (string, error) {
+	var f diagFormatter
+	for len(raw) > 0 {
+		var err error
+		if raw, err = f.value(raw); err != nil {
+			return f.String(), err
+		}
+		f.WriteByte('\n')
+	}
+	return f.String(), nil
+}
+
+// ParseDiag returns the encoding of the objects written in diagnostic notation in text. See
+// FormatDiag. Integers and floats without suffixes may be of any size; they are encoded as
+// AppendInt64 and AppendFloat64 encode them (or AppendUint64, for integers above
+// math.MaxInt64). The error is a DiagError if the text is not valid.
+func ParseDiag(text string) ([]byte, error) {
+	p := &diagParser{text: text}
+	return p.parse()
+}
+
+// A DiagError is returned by ParseDiag when the text is not valid diagnostic notation.
+type DiagError struct {
+	Offset int // the byte offset of the error in the text
+	Msg    string
+}
+
+// Error implements the error interface.
+func (e DiagError) Error() string {
+	return fmt.Sprintf("msgp: diagnostic notation: %s at offset %d", e.Msg, e.Offset)
+}
+
+// Resumable is always true for DiagErrors.
+func (e DiagError) Resumable() bool { return true }
+
+// diagHeader describes the header forms of a kind of object with a size.
+type diagHeader struct {
+	fix     byte // the prefix of the fix form, if fixMax >= 0
+	fixMax  int
+	w8, w16 byte // w8 is 0 if there is no such form
+	w32     byte
+}
+
+var (
+	diagStr   = diagHeader{fix: mfixstr, fixMax: 31, w8: mstr8, w16: mstr16, w32: mstr32}
+	diagBin   = diagHeader{fixMax: -1, w8: mbin8, w16: mbin16, w32: mbin32}
+	diagArray = diagHeader{fix: mfixarray, fixMax: 15, w16: marray16, w32: marray32}
+	diagMap   = diagHeader{fix: mfixmap, fixMax: 15, w16: mmap16, w32: mmap32}
+	diagExt   = diagHeader{fixMax: -1, w8: mext8, w16: mext16, w32: mext32} // without the fixext forms
+)
+
+// defaultWidth returns the width of the size (0 for the fix form) that the Append functions use.
+func (h *diagHeader) defaultWidth(n int) int {
+	switch {
+	case n <= h.fixMax:
+		return 0
+	case h.w8 != 0 && n <= math.MaxUint8:
+		return 8
+	case n <= math.MaxUint16:
+		return 16
+	}
+	return 32
+}
+
+// read returns the size and the width of the size of the header in b, and the bytes after it.
+func (h *diagHeader) read(b []byte) (n int, width int, rest []byte, err error) {
+	lead := b[0]
+	switch {
+	case h.fixMax >= 0 && lead&^byte(h.fixMax) == h.fix:
+		return int(lead) & h.fixMax, 0, b[1:], nil
+	case h.w8 != 0 && lead == h.w8:
+		if len(b) < 2 {
+			return 0, 0, b, ErrShortBytes
+		}
+		return int(b[1]), 8, b[2:], nil
+	case lead == h.w16:
+		if len(b) < 3 {
+			return 0, 0, b, ErrShortBytes
+		}
+		return int(big.Uint16(b[1:])), 16, b[3:], nil
+	default:
+		if len(b) < 5 {
+			return 0, 0, b, ErrShortBytes
+		}
+		return int(big.Uint32(b[1:])), 32, b[5:], nil
+	}
+}
+
+// append appends a header with the size n in the form with the width and says if it can.
+func (h *diagHeader) append(b []byte, n int, width int) ([]byte, bool) {
+	switch {
+	case width == 0 && n <= h.fixMax:
+		return append(b, h.fix|byte(n)), true
+	case width == 8 && h.w8 != 0 && n <= math.MaxUint8:
+		return append(b, h.w8, byte(n)), true
+	case width == 16 && n <= math.MaxUint16:
+		return append(b, h.w16, byte(n>>8), byte(n)), true
+	case width == 32 && int64(n) <= math.MaxUint32:
+		return append(b, h.w32, byte(n>>24), byte(n>>16), byte(n>>8), byte(n)), true
+	}
+	return b, false
+}
+
+// extDefaultWidth returns the width of the size of an extension with n bytes of data that
+// AppendExtension uses (0 for the fixext forms).
+func extDefaultWidth(n int) int {
+	switch n {
+	case 1, 2, 4, 8, 16:
+		return 0
+	}
+	return diagExt.defaultWidth(n)
+}
+
+var fixextSizes = map[byte]int{mfixext1: 1, mfixext2: 2, mfixext4: 4, mfixext8: 8, mfixext16: 16}
+
+type diagFormatter struct {
+	strings.Builder
+}
+
+func (f *diagFormatter) suffix(width, def int) {
+	if width != def {
+		f.WriteByte('_')
+		f.WriteString(strconv.Itoa(width))
+	}
+}
+
+func (f *diagFormatter) hex(data []byte) {
+	f.WriteString("h'")
+	f.WriteString(hexenc.EncodeToString(data))
+	f.WriteByte('\'')
+}
+
+// value writes the next object in b and returns the bytes after it.
+func (f *diagFormatter) value(b []byte) ([]byte, error) {
+	if len(b) < 1 {
+		return b, ErrShortBytes
+	}
+	lead := b[0]
+	switch {
+	case isfixint(lead):
+		f.WriteString(strconv.Itoa(int(lead)))
+		return b[1:], nil
+	case isnfixint(lead):
+		f.WriteString(strconv.Itoa(int(int8(lead))))
+		return b[1:], nil
+	case isfixstr(lead), lead == mstr8, lead == mstr16, lead == mstr32:
+		n, width, rest, err := diagStr.read(b)
+		if err != nil {
+			return b, err
+		}
+		if len(rest) < n {
+			return b, ErrShortBytes
+		}
+		f.WriteString(strconv.Quote(string(rest[:n])))
+		f.suffix(width, diagStr.defaultWidth(n))
+		return rest[n:], nil
+	case isfixarray(lead), lead == marray16, lead == marray32:
+		n, width, rest, err := diagArray.read(b)
+		if err != nil {
+			return b, err
+		}
+		f.WriteByte('[')
+		for i := 0; i < n; i++ {
+			if i > 0 {
+				f.WriteString(", ")
+			}
+			if rest, err = f.value(rest); err != nil {
+				return b, err
+			}
+		}
+		f.WriteByte(']')
+		f.suffix(width, diagArray.defaultWidth(n))
+		return rest, nil
+	case isfixmap(lead), lead == mmap16, lead == mmap32:
+		n, width, rest, err := diagMap.read(b)
+		if err != nil {
+			return b, err
+		}
+		f.WriteByte('{')
+		for i := 0; i < n; i++ {
+			if i > 0 {
+				f.WriteString(", ")
+			}
+			if rest, err = f.value(rest); err != nil {
+				return b, err
+			}
+			f.WriteString(": ")
+			if rest, err = f.value(rest); err != nil {
+				return b, err
+			}
+		}
+		f.WriteByte('}')
+		f.suffix(width, diagMap.defaultWidth(n))
+		return rest, nil
+	}
+
+	switch lead {
+	case mnil:
+		f.WriteString("nil")
+		return b[1:], nil
+	case mtrue:
+		f.WriteString("true")
+		return b[1:], nil
+	case mfalse:
+		f.WriteString("false")
+		return b[1:], nil
+	case mbin8, mbin16, mbin32:
+		n, width, rest, err := diagBin.read(b)
+		if err != nil {
+			return b, err
+		}
+		if len(rest) < n {
+			return b, ErrShortBytes
+		}
+		f.hex(rest[:n])
+		f.suffix(width, diagBin.defaultWidth(n))
+		return rest[n:], nil
+	case mfloat32:
+		if len(b) < 5 {
+			return b, ErrShortBytes
+		}
+		f.float(uint64(big.Uint32(b[1:])), 32)
+		return b[5:], nil
+	case mfloat64:
+		if len(b) < 9 {
+			return b, ErrShortBytes
+		}
+		f.float(big.Uint64(b[1:]), 64)
+		return b[9:], nil
+	case muint8, muint16, muint32, muint64, mint8, mint16, mint32, mint64:
+		return f.integer(b)
+	case mfixext1, mfixext2, mfixext4, mfixext8, mfixext16, mext8, mext16, mext32:
+		var n, width int
+		var rest []byte
+		if size, ok := fixextSizes[lead]; ok {
+			n, rest = size, b[1:]
+		} else {
+			var err error
+			if n, width, rest, err = diagExt.read(b); err != nil {
+				return b, err
+			}
+		}
+		if len(rest) < n+1 {
+			return b, ErrShortBytes
+		}
+		f.WriteString("ext(")
+		f.WriteString(strconv.Itoa(int(int8(rest[0]))))
+		f.WriteString(", ")
+		f.hex(rest[1 : n+1])
+		f.WriteByte(')')
+		f.suffix(width, extDefaultWidth(n))
+		return rest[n+1:], nil
+	}
+	return b, InvalidPrefixError(lead)
+}
+
+func (f *diagFormatter) integer(b []byte) ([]byte, error) {
+	lead := b[0]
+	size := 1 << ((lead - muint8) % 4) // 1, 2, 4, or 8 bytes
+	if len(b) < 1+size {
+		return b, ErrShortBytes
+	}
+	var u uint64
+	for _, c := range b[1 : 1+size] {
+		u = u<<8 | uint64(c)
+	}
+	if lead >= mint8 {
+		// Sign-extend the value.
+		shift := 64 - 8*uint(size)
+		f.WriteString(strconv.FormatInt(int64(u<<shift)>>shift, 10))
+		f.WriteString("_i")
+	} else {
+		f.WriteString(strconv.FormatUint(u, 10))
+		f.WriteString("_u")
+	}
+	f.WriteString(strconv.Itoa(8 * size))
+	return b[1+size:], nil
+}
+
+func (f *diagFormatter) float(bits uint64, size int) {
+	var v float64
+	var nan bool
+	if size == 32 {
+		v = float64(math.Float32frombits(uint32(bits)))
+		nan = math.IsNaN(v) && uint32(bits) != math.Float32bits(float32(math.NaN()))
+	} else {
+		v = math.Float64frombits(bits)
+		nan = math.IsNaN(v) && bits != math.Float64bits(math.NaN())
+	}
+	switch {
+	case nan:
+		f.WriteString("NaN(")
+		data := make([]byte, size/8)
+		for i := range data {
+			data[i] = byte(bits >> uint(size-8-8*i))
+		}
+		f.hex(data)
+		f.WriteByte(')')
+	case math.IsNaN(v):
+		f.WriteString("NaN")
+	case math.IsInf(v, 1):
+		f.WriteString("Infinity")
+	case math.IsInf(v, -1):
+		f.WriteString("-Infinity")
+	default:
+		s := strconv.FormatFloat(v, 'g', -1, size)
+		if !strings.ContainsAny(s, ".e") {
+			s += ".0"
+		}
+		f.WriteString(s)
+	}
+	if size == 32 {
+		f.WriteString("_f32")
+	}
+}
+
+type diagParser struct {
+	text string
+	pos  int
+	out  []byte
+}
+
+func (p *diagParser) parse() (out []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			de, ok := r.(DiagError)
+			if !ok {
+				panic(r)
+			}
+			err = de
+		}
+	}()
+	for p.space(); p.pos < len(p.text); p.space() {
+		p.value()
+	}
+	return p.out, nil
+}
+
+func (p *diagParser) fail(format string, args ...interface{}) {
+	panic(DiagError{Offset: p.pos, Msg: fmt.Sprintf(format, args...)})
+}
+
+func (p *diagParser) space() {
+	for p.pos < len(p.text) && strings.IndexByte(" \t\r\n", p.text[p.pos]) >= 0 {
+		p.pos++
+	}
+}
+
+func (p *diagParser) peek(c byte) bool {
+	return p.pos < len(p.text) && p.text[p.pos] == c
+}
+
+func (p *diagParser) expect(c byte) {
+	p.space()
+	if !p.peek(c) {
+		p.fail("expected %q", c)
+	}
+	p.pos++
+}
+
+func isDiagWordByte(c byte) bool {
+	return c == '_' || c == '.' || c == '+' || c == '-' ||
+		'0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// word reads a run of letters, digits, and the characters _.+-
+func (p *diagParser) word() string {
+	start := p.pos
+	for p.pos < len(p.text) && isDiagWordByte(p.text[p.pos]) {
+		p.pos++
+	}
+	return p.text[start:p.pos]
+}
+
+// suffix reads the suffix of a value, if it has one.
+func (p *diagParser) suffix() string {
+	if !p.peek('_') {
+		return ""
+	}
+	p.pos++
+	w := p.word()
+	if w == "" {
+		p.pos--
+		p.fail("missing suffix after _")
+	}
+	return w
+}
+
+// width reads the suffix giving the width of a size, or returns def if there is none.
+func (p *diagParser) width(def int) int {
+	start := p.pos
+	switch s := p.suffix(); s {
+	case "":
+		return def
+	case "8", "16", "32":
+		w, _ := strconv.Atoi(s)
+		return w
+	default:
+		p.pos = start
+		p.fail("unknown size suffix _%s", s)
+		return 0
+	}
+}
+
+// header inserts the header of an object with the size n at offset at of the output.
+func (p *diagParser) header(h *diagHeader, at, n int) {
+	start := p.pos
+	width := p.width(h.defaultWidth(n))
+	hdr, ok := h.append(nil, n, width)
+	if !ok {
+		p.pos = start
+		p.fail("size %d does not fit the suffix _%d", n, width)
+	}
+	p.out = append(p.out[:at], append(hdr, p.out[at:]...)...)
+}
+
+func (p *diagParser) value() {
+	p.space()
+	if p.pos >= len(p.text) {
+		p.fail("unexpected end of text")
+	}
+	at := len(p.out)
+	switch c := p.text[p.pos]; {
+	case c == '[':
+		p.pos++
+		n := 0
+		for p.space(); !p.peek(']'); p.space() {
+			if n > 0 {
+				p.expect(',')
+			}
+			p.value()
+			n++
+		}
+		p.pos++
+		p.header(&diagArray, at, n)
+	case c == '{':
+		p.pos++
+		n := 0
+		for p.space(); !p.peek('}'); p.space() {
+			if n > 0 {
+				p.expect(',')
+			}
+			p.value()
+			p.expect(':')
+			p.value()
+			n++
+		}
+		p.pos++
+		p.header(&diagMap, at, n)
+	case c == '"':
+		s := p.quoted()
+		p.out = append(p.out, s...)
+		p.header(&diagStr, at, len(s))
+	case c == 'h' && strings.HasPrefix(p.text[p.pos:], "h'"):
+		data := p.hex()
+		p.out = append(p.out, data...)
+		p.header(&diagBin, at, len(data))
+	default:
+		p.word1()
+	}
+}
+
+// word1 parses the values that start with a word: nil, true, false, ext(...), and numbers.
+func (p *diagParser) word1() {
+	start := p.pos
+	w := p.word()
+	// The suffix is read separately, after the number.
+	if i := strings.IndexByte(w, '_'); i >= 0 {
+		p.pos = start + i
+		w = w[:i]
+	}
+	switch w {
+	case "nil":
+		p.out = AppendNil(p.out)
+	case "true", "false":
+		p.out = AppendBool(p.out, w == "true")
+	case "ext":
+		p.ext()
+	case "NaN", "Infinity", "-Infinity":
+		p.float(w, start)
+	case "":
+		p.fail("unexpected %q", p.text[p.pos])
+	default:
+		if strings.ContainsAny(w, ".eE") {
+			p.float(w, start)
+		} else {
+			p.integer(w, start)
+		}
+	}
+}
+
+func (p *diagParser) integer(w string, start int) {
+	suffix := p.suffix()
+	if suffix == "" {
+		i, err := strconv.ParseInt(w, 10, 64)
+		if err != nil {
+			u, uerr := strconv.ParseUint(w, 10, 64)
+			if uerr != nil {
+				p.pos = start
+				p.fail("bad integer %s", w)
+			}
+			p.out = AppendUint64(p.out, u)
+			return
+		}
+		p.out = AppendInt64(p.out, i)
+		return
+	}
+	if len(suffix) < 2 || (suffix[0] != 'u' && suffix[0] != 'i') {
+		p.fail("unknown integer suffix _%s", suffix)
+	}
+	bits, err := strconv.Atoi(suffix[1:])
+	if err != nil || (bits != 8 && bits != 16 && bits != 32 && bits != 64) {
+		p.fail("unknown integer suffix _%s", suffix)
+	}
+	var u uint64
+	lead := muint8
+	if suffix[0] == 'i' {
+		i, err := strconv.ParseInt(w, 10, bits)
+		if err != nil {
+			p.pos = start
+			p.fail("bad int%d %s", bits, w)
+		}
+		u = uint64(i)
+		lead = mint8
+	} else {
+		if u, err = strconv.ParseUint(w, 10, bits); err != nil {
+			p.pos = start
+			p.fail("bad uint%d %s", bits, w)
+		}
+	}
+	size := bits / 8
+	switch size {
+	case 2:
+		lead++
+	case 4:
+		lead += 2
+	case 8:
+		lead += 3
+	}
+	p.out = append(p.out, lead)
+	for i := size - 1; i >= 0; i-- {
+		p.out = append(p.out, byte(u>>(8*uint(i))))
+	}
+}
+
+func (p *diagParser) float(w string, start int) {
+	var nanBits []byte
+	if w == "NaN" && p.peek('(') {
+		p.pos++
+		p.space()
+		nanBits = p.hex()
+		p.expect(')')
+	}
+	var f32 bool
+	switch s := p.suffix(); s {
+	case "":
+	case "f32":
+		f32 = true
+	default:
+		p.fail("unknown float suffix _%s", s)
+	}
+	var v float64
+	switch w {
+	case "NaN":
+		v = math.NaN()
+	case "Infinity":
+		v = math.Inf(1)
+	case "-Infinity":
+		v = math.Inf(-1)
+	default:
+		bits := 64
+		if f32 {
+			bits = 32
+		}
+		var err error
+		if v, err = strconv.ParseFloat(w, bits); err != nil {
+			p.pos = start
+			p.fail("bad float %s", w)
+		}
+	}
+	switch {
+	case nanBits != nil:
+		if (f32 && len(nanBits) != 4) || (!f32 && len(nanBits) != 8) {
+			p.pos = start
+			p.fail("the NaN has %d bytes", len(nanBits))
+		}
+		if f32 {
+			p.out = append(p.out, mfloat32)
+		} else {
+			p.out = append(p.out, mfloat64)
+		}
+		p.out = append(p.out, nanBits...)
+	case f32:
+		p.out = AppendFloat32(p.out, float32(v))
+	default:
+		p.out = AppendFloat64(p.out, v)
+	}
+}
+
+func (p *diagParser) ext() {
+	p.expect('(')
+	p.space()
+	start := p.pos
+	typ, err := strconv.ParseInt(p.word(), 10, 8)
+	if err != nil {
+		p.pos = start
+		p.fail("bad extension type")
+	}
+	p.expect(',')
+	p.space()
+	if !strings.HasPrefix(p.text[p.pos:], "h'") {
+		p.fail("expected the extension data in hex")
+	}
+	data := p.hex()
+	p.expect(')')
+	start = p.pos
+	width := p.width(extDefaultWidth(len(data)))
+	n := len(data)
+	switch {
+	case width == 0:
+		lead, ok := map[int]byte{1: mfixext1, 2: mfixext2, 4: mfixext4, 8: mfixext8, 16: mfixext16}[n]
+		if !ok {
+			p.pos = start
+			p.fail("no fixext form has %d bytes", n)
+		}
+		p.out = append(p.out, lead)
+	default:
+		hdr, ok := diagExt.append(nil, n, width)
+		if !ok {
+			p.pos = start
+			p.fail("size %d does not fit the suffix _%d", n, width)
+		}
+		p.out = append(p.out, hdr...)
+	}
+	p.out = append(p.out, byte(typ))
+	p.out = append(p.out, data...)
+}
+
+func (p *diagParser) quoted() string {
+	start := p.pos
+	p.pos++
+	for p.pos < len(p.text) && p.text[p.pos] != '"' {
+		if p.text[p.pos] == '\\' {
+			p.pos++
+		}
+		p.pos++
+	}
+	if p.pos >= len(p.text) {
+		p.pos = start
+		p.fail("unterminated string")
+	}
+	p.pos++
+	s, err := strconv.Unquote(p.text[start:p.pos])
+	if err != nil {
+		p.pos = start
+		p.fail("bad string: %v", err)
+	}
+	return s
+}
+
+func (p *diagParser) hex() []byte {
+	start := p.pos
+	if !strings.HasPrefix(p.text[p.pos:], "h'") {
+		p.fail("expected h'")
+	}
+	p.pos += 2
+	end := strings.IndexByte(p.text[p.pos:], '\'')
+	if end < 0 {
+		p.pos = start
+		p.fail("unterminated hex")
+	}
+	data, err := hexenc.DecodeString(p.text[p.pos : p.pos+end])
+	if err != nil {
+		p.fail("bad hex: %v", err)
+	}
+	p.pos += end + 1
+	return data
+}
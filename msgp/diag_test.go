@@ -0,0 +1,95 @@
+package msgp
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestDiagRoundTrip(t *testing.T) {
+	var b []byte
+	b = AppendMapHeader(b, 4)
+	b = AppendString(b, "a")
+	b = append(b, muint16, 0, 1)
+	b = AppendString(b, "b")
+	b = AppendBytes(b, []byte{0x0a, 0xff})
+	b = AppendString(b, "c")
+	b, _ = AppendExtension(b, &RawExtension{Type: 5, Data: []byte{0}})
+	b = AppendInt(b, 7)
+	b = AppendArrayHeader(b, 3)
+	b = AppendFloat32(b, 1.5)
+	b = AppendFloat64(b, -2)
+	b = AppendNil(b)
+
+	text, err := FormatDiag(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const want = `{"a": 1_u16, "b": h'0aff', "c": ext(5, h'00'), 7: [1.5_f32, -2.0, nil]}` + "\n"
+	if text != want {
+		t.Errorf("formatted as\n%s\nwant\n%s", text, want)
+	}
+
+	// Encodings that the Append functions do not use are kept.
+	var odd []byte
+	odd = append(odd, marray32, 0, 0, 0, 2)
+	odd = append(odd, mstr8, 2, 'h', 'i')
+	odd = append(odd, mint64, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xfe)
+	odd = append(odd, mext8, 1, 0xfb, 9)
+	odd = append(odd, mfloat64, 0x7f, 0xf8, 0, 0, 0, 0, 0, 2)
+	odd = append(odd, mfloat32, 0x80, 0, 0, 0)
+	odd = append(odd, mmap16, 0, 1, mtrue, mbin16, 0, 0)
+	odd = AppendFloat64(odd, math.Inf(-1))
+	odd = AppendString(odd, "tab\t\xff")
+
+	for _, raw := range [][]byte{b, odd} {
+		text, err := FormatDiag(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		back, err := ParseDiag(text)
+		if err != nil {
+			t.Fatalf("%s: %v", text, err)
+		}
+		if !bytes.Equal(back, raw) {
+			t.Errorf("%s parsed as %x; want %x", text, back, raw)
+		}
+	}
+	if text, _ := FormatDiag(odd); !strings.Contains(text, "NaN(h'7ff8000000000002')") || !strings.Contains(text, `"hi"_8`) {
+		t.Errorf("formatted as %s", text)
+	}
+}
+
+func TestParseDiag(t *testing.T) {
+	tests := []struct {
+		text string
+		want []byte
+	}{
+		{"300", AppendInt(nil, 300)},
+		{"-1_i8", []byte{mint8, 0xff}},
+		{"1e3", AppendFloat64(nil, 1000)},
+		{"NaN_f32", AppendFloat32(nil, float32(math.NaN()))},
+		{`[] {} "" h''`, []byte{mfixarray, mfixmap, mfixstr, mbin8, 0}},
+		{"ext(-1, h'0102')_16", []byte{mext16, 0, 2, 0xff, 1, 2}},
+		{" [ 1 , [ true ] ] ", []byte{mfixarray | 2, 1, mfixarray | 1, mtrue}},
+	}
+	for _, tt := range tests {
+		got, err := ParseDiag(tt.text)
+		if err != nil {
+			t.Errorf("%s: %v", tt.text, err)
+			continue
+		}
+		if !bytes.Equal(got, tt.want) {
+			t.Errorf("%s = %x; want %x", tt.text, got, tt.want)
+		}
+	}
+
+	for _, text := range []string{"[1 2]", "{1}", "256_u8", "1_x", "1_", "1.5_", "[]_", "\"open", "h'0'", "ext(5, h'00')_0", "[]_8", "@", "NaN(h'00')"} {
+		if _, err := ParseDiag(text); err == nil {
+			t.Errorf("%s: no error", text)
+		} else if _, ok := err.(DiagError); !ok {
+			t.Errorf("%s: %v is not a DiagError", text, err)
+		}
+	}
+}
@@ -7,7 +7,7 @@ import (
 // Locate returns a []byte pointing to the field in a MessagePack map with the
 // provided key. (The returned []byte points to a sub-slice of 'raw'; Locate does
 // no allocations.) If the key doesn't exist in the map, a zero-length []byte
-// will be returned.
+// will be returned. To find objects deeper within the data, use Query.
 func Locate(key string, raw []byte) []byte {
 	s, n := locate(raw, key)
 	return raw[s:n]
@@ -68,6 +68,99 @@ func HasKey(key string, raw []byte) bool {
 	return false
 }
 
+// MergePatch applies the merge patch in patch to the object in base as in JSON Merge Patch
+// (RFC 7386) and returns the result, which does not share memory with base or patch. If the patch
+// is a map, its entries are merged into base (which is first made an empty map if it is not a
+// map): an entry with a nil value removes the key, an entry with a map value is merged into the
+// value of the key in the same way, and any other entry sets the key. A patch that is not a map
+// replaces base. Keys are matched by their canonical encodings, so they may be of any type.
+func MergePatch(base, patch []byte) ([]byte, error) {
+	b, _, err := nextRaw(base)
+	if err != nil {
+		return nil, err
+	}
+	p, _, err := nextRaw(patch)
+	if err != nil {
+		return nil, err
+	}
+	return appendMergePatch(nil, b, p)
+}
+
+// appendMergePatch appends the result of applying the merge patch p to the object b, which
+// may be nil if there is no object, to out.
+func appendMergePatch(out []byte, b, p Raw) ([]byte, error) {
+	if NextType(p) != MapType {
+		return append(out, p...), nil
+	}
+	if NextType(b) != MapType {
+		b = AppendMapHeader(nil, 0)
+	}
+
+	// The entries of the patch by canonical key, and their keys in the order of the patch.
+	type entry struct {
+		key, val Raw
+		used     bool
+	}
+	entries := make(map[string]*entry)
+	var order []*entry
+	err := eachChild(p, func(_ int, key, val Raw) error {
+		ck, err := Canonicalize(key)
+		if err != nil {
+			return err
+		}
+		if _, ok := entries[string(ck)]; !ok {
+			e := &entry{key: key, val: val}
+			entries[string(ck)] = e
+			order = append(order, e)
+		}
+		return nil
+	})
+	if err != nil {
+		return out, err
+	}
+
+	var body []byte
+	var n uint32
+	err = eachChild(b, func(_ int, key, val Raw) error {
+		ck, err := Canonicalize(key)
+		if err != nil {
+			return err
+		}
+		e, ok := entries[string(ck)]
+		switch {
+		case !ok:
+			body = append(append(body, key...), val...)
+		case e.used || IsNil(e.val):
+			// The key is removed (and any later duplicates of it with it).
+			e.used = true
+			return nil
+		default:
+			e.used = true
+			body = append(body, key...)
+			if body, err = appendMergePatch(body, val, e.val); err != nil {
+				return err
+			}
+		}
+		n++
+		return nil
+	})
+	if err != nil {
+		return out, err
+	}
+	for _, e := range order {
+		if e.used || IsNil(e.val) {
+			continue
+		}
+		body = append(body, e.key...)
+		if body, err = appendMergePatch(body, nil, e.val); err != nil {
+			return out, err
+		}
+		n++
+	}
+	out = AppendMapHeader(out, n)
+	return append(out, body...), nil
+}
+
 func replace(raw []byte, start int, end int, val []byte, inplace bool) []byte {
 	ll := end - start // length of segment to replace
 	lv := len(val)
@@ -205,3 +205,46 @@ func BenchmarkLocate(b *testing.B) {
 		Locate("thing_three", raw)
 	}
 }
+
+func TestMergePatch(t *testing.T) {
+	enc := func(v interface{}) []byte {
+		b, err := AppendIntf(nil, v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	type m = map[string]interface{}
+	tests := []struct {
+		base, patch, want interface{}
+	}{
+		{m{"a": "b"}, m{"a": "c"}, m{"a": "c"}},
+		{m{"a": "b"}, m{"b": "c"}, m{"a": "b", "b": "c"}},
+		{m{"a": "b"}, m{"a": nil}, m{}},
+		{m{"a": "b", "b": "c"}, m{"a": nil}, m{"b": "c"}},
+		{m{"a": []interface{}{"b"}}, m{"a": "c"}, m{"a": "c"}},
+		{m{"a": "c"}, m{"a": []interface{}{"b"}}, m{"a": []interface{}{"b"}}},
+		{m{"a": m{"b": "c"}}, m{"a": m{"b": "d", "c": nil}}, m{"a": m{"b": "d"}}},
+		{m{"a": []interface{}{m{"b": "c"}}}, m{"a": []interface{}{int64(1)}}, m{"a": []interface{}{int64(1)}}},
+		{[]interface{}{"a", "b"}, []interface{}{"c", "d"}, []interface{}{"c", "d"}},
+		{m{"a": "b"}, []interface{}{"c"}, []interface{}{"c"}},
+		{m{"a": "foo"}, nil, nil},
+		{m{"e": nil}, m{"a": int64(1)}, m{"e": nil, "a": int64(1)}},
+		{[]interface{}{int64(1), int64(2)}, m{"a": "b", "c": nil}, m{"a": "b"}},
+		{m{}, m{"a": m{"bb": m{"ccc": nil}}}, m{"a": m{"bb": m{}}}},
+	}
+	for i, tt := range tests {
+		got, err := MergePatch(enc(tt.base), enc(tt.patch))
+		if err != nil {
+			t.Errorf("%d: %v", i, err)
+			continue
+		}
+		if !Equal(got, enc(tt.want), nil) {
+			v, _, _ := ReadIntfBytes(got)
+			t.Errorf("%d: got %v; want %v", i, v, tt.want)
+		}
+	}
+	if _, err := MergePatch(enc(m{}), []byte{mmap16}); err == nil {
+		t.Error("no error for a bad patch")
+	}
+}
@@ -73,6 +73,51 @@ func (u UintOverflow) Error() string {
 // Resumable is always true for overflows.
 func (u UintOverflow) Resumable() bool { return true }
 
+// A ConversionError is returned by lenient decoding when the value on the wire cannot be
+// converted to the requested type without losing information.
+type ConversionError struct {
+	Value interface{} // the value decoded
+	Want  string      // the Go type that the value could not be converted to
+}
+
+// Error implements the error interface.
+func (c ConversionError) Error() string {
+	return fmt.Sprintf("msgp: %v cannot be converted to %s without loss", c.Value, c.Want)
+}
+
+// Resumable is always true for ConversionErrors.
+func (c ConversionError) Resumable() bool { return true }
+
+// An EnumError is returned by generated code when a value of an enum type (see the msgp:enum
+// directive) is not one of the type's named constants.
+type EnumError struct {
+	Type  string      // the enum type
+	Value interface{} // the value that is not recognized
+}
+
+// Error implements the error interface.
+func (e EnumError) Error() string {
+	return fmt.Sprintf("msgp: %v is not a valid %s", e.Value, e.Type)
+}
+
+// Resumable is always true for EnumErrors.
+func (e EnumError) Resumable() bool { return true }
+
+// An ExtensionDataError is returned when the data of one of the extension types built into
+// this package is malformed.
+type ExtensionDataError struct {
+	Type   int8   // the extension type
+	Reason string // what is wrong with the data
+}
+
+// Error implements the error interface.
+func (e ExtensionDataError) Error() string {
+	return fmt.Sprintf("msgp: invalid data for extension type %d: %s", e.Type, e.Reason)
+}
+
+// Resumable is always true for ExtensionDataErrors.
+func (e ExtensionDataError) Resumable() bool { return true }
+
 // A TypeError is returned when a particular
 // decoding method is unsuitable for decoding
 // a particular MessagePack value.
@@ -3,6 +3,7 @@ package msgp
 import (
 	"fmt"
 	"math"
+	"sync"
 )
 
 const (
@@ -15,31 +16,145 @@ const (
 	// TimeExtension represents an extension for timestamps. This is not the timestamp format
 	// defined in the MessagePack specification.
 	TimeExtension = 5
+
+	// BigIntExtension represents an extension for *big.Int values. The data is a sign byte
+	// (0 for non-negative numbers and 1 for negative numbers) followed by the big-endian
+	// bytes of the absolute value.
+	BigIntExtension = -127
+
+	// BigFloatExtension represents an extension for *big.Float values. The data is the
+	// output of (*big.Float).GobEncode, which preserves the precision and rounding mode.
+	BigFloatExtension = -126
+
+	// BigRatExtension represents an extension for *big.Rat values. The data is a sign byte,
+	// the length of the numerator as a big-endian uint32, the big-endian bytes of the absolute
+	// value of the numerator, and then the big-endian bytes of the denominator.
+	BigRatExtension = -125
+
+	// IPExtension represents an extension for IP addresses (net.IP and netip.Addr). The data
+	// is the 4-byte form of an IPv4 address or the 16-byte form of an IPv6 address.
+	IPExtension = -124
+
+	// UUIDExtension represents an extension for UUIDs. The data is the 16 bytes of the UUID.
+	UUIDExtension = -123
 )
 
-// extensionReg contains registered extensions.
-var extensionReg = make(map[int8]func() Extension)
+// The extension types from -127 through -112 are reserved for the packages of this module.
+// They lie in the range that MessagePack reserves for itself, so they cannot collide with
+// application-defined types, and they are taken from the end farthest from the types that
+// the specification defines (the timestamp type is -1). Besides the types above, package cbor
+// uses -122 for CBOR tags.
 
-// RegisterExtension registers extensions so that they can be initialized and returned
-// by methods that decode `interface{}` values. This should only be called during
+// isReservedExtension says if typ is one of the extension types that cannot be registered:
+// the types 3 through 5 and the range reserved for the packages of this module.
+func isReservedExtension(typ int8) bool {
+	return typ >= Complex64Extension && typ <= TimeExtension || typ >= -127 && typ <= -112
+}
+
+// builtinExtType returns the Type of the built-in extension typ, or ExtensionType if typ
+// is not one of the extensions built into this package.
+func builtinExtType(typ int8) Type {
+	switch typ {
+	case Complex64Extension:
+		return Complex64Type
+	case Complex128Extension:
+		return Complex128Type
+	case TimeExtension:
+		return TimeType
+	case BigIntExtension:
+		return BigIntType
+	case BigFloatExtension:
+		return BigFloatType
+	case BigRatExtension:
+		return BigRatType
+	case IPExtension:
+		return IPType
+	case UUIDExtension:
+		return UUIDType
+	default:
+		return ExtensionType
+	}
+}
+
+// An ExtensionRegistry maps extension types to functions that return a newly-initialized
+// zero value of the extension. The methods that decode `interface{}` values use a registry
+// to decide what to return for an extension. A registry may have a parent, which is consulted
+// for the extension types not registered in the registry itself, so a registry can add to or
+// override the types registered in DefaultExtensions without affecting other users of it.
+// An ExtensionRegistry is safe for concurrent use.
+type ExtensionRegistry struct {
+	parent *ExtensionRegistry
+	mu     sync.RWMutex
+	types  map[int8]func() Extension
+}
+
+// NewExtensionRegistry returns an empty registry layered over parent, which may be nil.
+// To add to the globally registered extensions, pass DefaultExtensions as the parent.
+func NewExtensionRegistry(parent *ExtensionRegistry) *ExtensionRegistry {
+	return &ExtensionRegistry{parent: parent, types: make(map[int8]func() Extension)}
+}
+
+// DefaultExtensions is the registry used when no other registry is given. RegisterExtension
+// adds extensions to it.
+var DefaultExtensions = NewExtensionRegistry(nil)
+
+// Register registers the extension type typ in the registry. Func f should return a
+// newly-initialized zero value of the extension. An error is returned if typ is reserved
+// (see RegisterExtension) or if it is already registered in this registry; a type registered
+// in a parent registry may be overridden.
+func (r *ExtensionRegistry) Register(typ int8, f func() Extension) error {
+	if isReservedExtension(typ) {
+		return fmt.Errorf("msgp: forbidden extension type: %d", typ)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.types[typ]; ok {
+		return fmt.Errorf("msgp: extension type %d registered more than once", typ)
+	}
+	r.types[typ] = f
+	return nil
+}
+
+// Unregister removes the extension type typ from the registry. Types registered in a parent
+// registry are not affected.
+func (r *ExtensionRegistry) Unregister(typ int8) {
+	r.mu.Lock()
+	delete(r.types, typ)
+	r.mu.Unlock()
+}
+
+// Lookup returns the function registered for typ in the registry or one of its parents.
+func (r *ExtensionRegistry) Lookup(typ int8) (func() Extension, bool) {
+	for ; r != nil; r = r.parent {
+		r.mu.RLock()
+		f, ok := r.types[typ]
+		r.mu.RUnlock()
+		if ok {
+			return f, true
+		}
+	}
+	return nil, false
+}
+
+// RegisterExtension registers extensions in DefaultExtensions so that they can be initialized
+// and returned by methods that decode `interface{}` values. This should only be called during
 // initialization. Func f should return a newly-initialized zero value of the extension.
 // Keep in mind that extensions 3, 4, and 5 are reserved for complex64, complex128, and
 // time.Time, respectively, and that MessagePack reserves extension types from -127 to -1.
+// The other extensions built into this package use types from that range, and the types
+// from -127 through -112 cannot be registered.
 //
 // For example, if you wanted to register a user-defined struct:
 //
 //  msgp.RegisterExtension(10, func() msgp.Extension { &MyExtension{} })
 //
 // RegisterExtension will panic if you call it multiple times with the same 'typ' argument
-// or if you use a reserved type (3, 4, or 5).
+// or if you use a reserved type (3, 4, or 5). Use an ExtensionRegistry to register
+// extensions for only some readers or calls.
 func RegisterExtension(typ int8, f func() Extension) {
-	if typ == Complex64Extension || typ == Complex128Extension || typ == TimeExtension {
-		panic(fmt.Sprint("msgp: forbidden extension type:", typ))
-	}
-	if _, ok := extensionReg[typ]; ok {
-		panic(fmt.Sprint("msgp: RegisterExtension() called with typ", typ, "more than once"))
+	if err := DefaultExtensions.Register(typ, f); err != nil {
+		panic(err.Error())
 	}
-	extensionReg[typ] = f
 }
 
 // ExtensionTypeError is an error type returned when there is a mis-match between an extension
@@ -156,7 +271,7 @@ func (mw *Writer) WriteExtension(e Extension) error {
 		mw.buf[i+1] = byte(e.ExtensionType())
 	default:
 		switch {
-		case l < math.MaxUint8:
+		case l <= math.MaxUint8:
 			i, err := mw.require(3)
 			if err != nil {
 				return err
@@ -164,7 +279,7 @@ func (mw *Writer) WriteExtension(e Extension) error {
 			mw.buf[i] = mext8
 			mw.buf[i+1] = byte(uint8(l))
 			mw.buf[i+2] = byte(e.ExtensionType())
-		case l < math.MaxUint16:
+		case l <= math.MaxUint16:
 			i, err := mw.require(4)
 			if err != nil {
 				return err
@@ -414,26 +529,27 @@ func AppendExtension(b []byte, e Extension) ([]byte, error) {
 		b[n] = mfixext16
 		b[n+1] = byte(e.ExtensionType())
 		n += 2
-	}
-	switch {
-	case l < math.MaxUint8:
-		b, n = ensure(b, l+3)
-		b[n] = mext8
-		b[n+1] = byte(uint8(l))
-		b[n+2] = byte(e.ExtensionType())
-		n += 3
-	case l < math.MaxUint16:
-		b, n = ensure(b, l+4)
-		b[n] = mext16
-		big.PutUint16(b[n+1:], uint16(l))
-		b[n+3] = byte(e.ExtensionType())
-		n += 4
 	default:
-		b, n = ensure(b, l+6)
-		b[n] = mext32
-		big.PutUint32(b[n+1:], uint32(l))
-		b[n+5] = byte(e.ExtensionType())
-		n += 6
+		switch {
+		case l <= math.MaxUint8:
+			b, n = ensure(b, l+3)
+			b[n] = mext8
+			b[n+1] = byte(uint8(l))
+			b[n+2] = byte(e.ExtensionType())
+			n += 3
+		case l <= math.MaxUint16:
+			b, n = ensure(b, l+4)
+			b[n] = mext16
+			big.PutUint16(b[n+1:], uint16(l))
+			b[n+3] = byte(e.ExtensionType())
+			n += 4
+		default:
+			b, n = ensure(b, l+6)
+			b[n] = mext32
+			big.PutUint32(b[n+1:], uint32(l))
+			b[n+5] = byte(e.ExtensionType())
+			n += 6
+		}
 	}
 	return b, e.MarshalBinaryTo(b[n:])
 }
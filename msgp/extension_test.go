@@ -47,3 +47,172 @@ func TestReadWriteExtensionBytes(t *testing.T) {
 		}
 	}
 }
+
+func TestAppendExtensionMatchesWriter(t *testing.T) {
+	var buf bytes.Buffer
+	en := NewWriter(&buf)
+	for _, size := range extSizes {
+		buf.Reset()
+		e := RawExtension{Type: 42, Data: RandBytes(size)}
+		if err := en.WriteExtension(&e); err != nil {
+			t.Fatal(err)
+		}
+		en.Flush()
+		bts, err := AppendExtension(nil, &e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(bts, buf.Bytes()) {
+			t.Errorf("extension of length %d: AppendExtension gave %d bytes; WriteExtension gave %d", size, len(bts), buf.Len())
+		}
+		if got := NextType(bts); got != ExtensionType {
+			t.Errorf("extension of length %d: got type %s", size, got)
+		}
+	}
+}
+
+// regExt is an extension type used to test registries.
+type regExt struct {
+	Data []byte
+}
+
+func (r *regExt) ExtensionType() int8 { return 50 }
+
+func (r *regExt) Len() int { return len(r.Data) }
+
+func (r *regExt) MarshalBinaryTo(b []byte) error {
+	copy(b, r.Data)
+	return nil
+}
+
+func (r *regExt) UnmarshalBinary(b []byte) error {
+	r.Data = append(r.Data[:0], b...)
+	return nil
+}
+
+func TestExtensionRegistry(t *testing.T) {
+	reg := NewExtensionRegistry(DefaultExtensions)
+	newRegExt := func() Extension { return new(regExt) }
+	if err := reg.Register(50, newRegExt); err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.Register(50, newRegExt); err == nil {
+		t.Error("expected an error registering a type twice")
+	}
+	for _, typ := range []int8{Complex64Extension, TimeExtension, BigIntExtension, -122, -112} {
+		if err := reg.Register(typ, newRegExt); err == nil {
+			t.Errorf("expected an error registering the reserved type %d", typ)
+		}
+	}
+	if err := reg.Register(-111, newRegExt); err != nil {
+		t.Error(err)
+	}
+	if _, ok := DefaultExtensions.Lookup(50); ok {
+		t.Error("registering in a child registry changed DefaultExtensions")
+	}
+
+	bts, err := AppendExtension(nil, &regExt{Data: []byte("abc")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, _, err := ReadIntfBytes(bts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := out.(*RawExtension); !ok {
+		t.Errorf("ReadIntfBytes: expected a *RawExtension; got %T", out)
+	}
+	out, _, err = reg.ReadIntfBytes(bts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, ok := out.(*regExt); !ok || string(e.Data) != "abc" {
+		t.Errorf("(*ExtensionRegistry).ReadIntfBytes: got %#v", out)
+	}
+
+	rd := NewReader(bytes.NewReader(bts))
+	rd.Extensions = reg
+	out, err = rd.ReadIntf()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := out.(*regExt); !ok {
+		t.Errorf("ReadIntf: expected a *regExt; got %T", out)
+	}
+
+	var js bytes.Buffer
+	if _, err = reg.UnmarshalAsJSON(&js, bts); err != nil {
+		t.Fatal(err)
+	}
+	if js.String() != `{"Data":"YWJj"}` {
+		t.Errorf("UnmarshalAsJSON: got %s", js.String())
+	}
+	js.Reset()
+	rd = NewReader(bytes.NewReader(bts))
+	rd.Extensions = reg
+	if _, err = rd.WriteToJSON(&js); err != nil {
+		t.Fatal(err)
+	}
+	if js.String() != `{"Data":"YWJj"}` {
+		t.Errorf("WriteToJSON: got %s", js.String())
+	}
+}
+
+func TestExtensionRegistryLayers(t *testing.T) {
+	parent := NewExtensionRegistry(nil)
+	child := NewExtensionRegistry(parent)
+	parent.Register(60, func() Extension { return &RawExtension{Type: 60} })
+	child.Register(60, func() Extension { return new(regExt) })
+
+	f, ok := child.Lookup(60)
+	if !ok {
+		t.Fatal("type 60 not found in child")
+	}
+	if _, ok := f().(*regExt); !ok {
+		t.Error("the child registry did not override its parent")
+	}
+
+	child.Unregister(60)
+	f, ok = child.Lookup(60)
+	if !ok {
+		t.Fatal("type 60 not found in parent")
+	}
+	if _, ok := f().(*RawExtension); !ok {
+		t.Error("lookup did not fall through to the parent registry")
+	}
+
+	// Lookups are safe while other goroutines register types.
+	done := make(chan struct{})
+	go func() {
+		for i := int8(11); i < 40; i++ {
+			child.Register(i, func() Extension { return new(regExt) })
+		}
+		close(done)
+	}()
+	for i := int8(11); i < 40; i++ {
+		child.Lookup(i)
+	}
+	<-done
+}
+
+func TestUserExtensionTypes(t *testing.T) {
+	// Types outside 3 through 5 belong to applications, even the small ones next to them.
+	for typ := int8(6); typ <= 11; typ++ {
+		r := NewExtensionRegistry(nil)
+		if err := r.Register(typ, func() Extension { return new(RawExtension) }); err != nil {
+			t.Errorf("type %d: %v", typ, err)
+		}
+		bts, err := AppendExtension(nil, &RawExtension{Type: typ, Data: []byte{1, 2, 3}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := NextType(bts); got != ExtensionType {
+			t.Errorf("type %d: got type %s", typ, got)
+		}
+		v, _, err := ReadIntfBytes(bts)
+		if e, ok := v.(*RawExtension); err != nil || !ok || e.Type != typ {
+			t.Errorf("type %d: read %#v, %v", typ, v, err)
+		}
+	}
+}
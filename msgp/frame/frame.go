@@ -0,0 +1,288 @@
+// Package frame sends MessagePack objects over unreliable byte streams in checksummed frames.
+//
+// A msgp.Reader assumes a clean stream: one corrupt byte can make it misread everything that
+// follows. A frame holds one payload (usually one object) and checks both its own length and the
+// payload, so a Reader can report a corrupt frame, find the start of the next one, and go on:
+//
+//  magic "\xc1F" | length (uint32) | CRC-32C of the magic and length | payload | CRC-32C of payload
+//
+// The integers are big-endian. The magic starts with 0xc1, which is never a MessagePack prefix.
+package frame
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/dchenk/msgp/msgp"
+)
+
+// DefaultMaxSize is the default maximum size of a frame's payload.
+const DefaultMaxSize = 16 << 20
+
+const (
+	magic      = "\xc1F"
+	headerSize = len(magic) + 8
+	crcSize    = 4
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// ErrTooLarge is returned by a Writer for a payload longer than its MaxSize.
+var ErrTooLarge = errors.New("frame: payload too large")
+
+// A SkipError reports a frame that a Reader skipped. The Reader can go on reading after it.
+type SkipError struct {
+	Offset int64 // the offset of the frame in the stream
+	Reason string
+}
+
+// Error implements the error interface.
+func (e SkipError) Error() string {
+	return fmt.Sprintf("frame: %s at offset %d", e.Reason, e.Offset)
+}
+
+// Resumable is always true for SkipErrors.
+func (e SkipError) Resumable() bool { return true }
+
+// A Writer writes frames to an io.Writer, each with one call to Write.
+type Writer struct {
+	// MaxSize is the maximum size of a payload. NewWriter sets it to DefaultMaxSize.
+	MaxSize int
+
+	w   io.Writer
+	buf []byte       // the frame being written
+	msg []byte       // the payload for Marshal
+	enc bytes.Buffer // the payload for Encode
+	mw  *msgp.Writer
+}
+
+// NewWriter returns a Writer that writes frames to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{MaxSize: DefaultMaxSize, w: w}
+}
+
+// WriteFrame writes a frame holding payload.
+func (w *Writer) WriteFrame(payload []byte) error {
+	if len(payload) > w.MaxSize {
+		return ErrTooLarge
+	}
+	b := append(w.buf[:0], magic...)
+	b = appendUint32(b, uint32(len(payload)))
+	b = appendUint32(b, crc32.Checksum(b, castagnoli))
+	b = append(b, payload...)
+	b = appendUint32(b, crc32.Checksum(payload, castagnoli))
+	w.buf = b
+	_, err := w.w.Write(b)
+	return err
+}
+
+// Marshal writes a frame holding the encoding of m.
+func (w *Writer) Marshal(m msgp.Marshaler) error {
+	b, err := m.MarshalMsg(w.msg[:0])
+	if err != nil {
+		return err
+	}
+	w.msg = b
+	return w.WriteFrame(b)
+}
+
+// Encode writes a frame holding the encoding of e.
+func (w *Writer) Encode(e msgp.Encoder) error {
+	w.enc.Reset()
+	if w.mw == nil {
+		w.mw = msgp.NewWriter(&w.enc)
+	} else {
+		w.mw.Reset(&w.enc)
+	}
+	if err := e.EncodeMsg(w.mw); err != nil {
+		return err
+	}
+	if err := w.mw.Flush(); err != nil {
+		return err
+	}
+	return w.WriteFrame(w.enc.Bytes())
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	var p [4]byte
+	binary.BigEndian.PutUint32(p[:], v)
+	return append(b, p[:]...)
+}
+
+// A Reader reads frames from an io.Reader. When a frame is corrupt or too large, a Reader
+// returns a SkipError and skips to the next frame.
+type Reader struct {
+	// MaxSize is the maximum size of a payload; longer frames are skipped. NewReader sets it to
+	// DefaultMaxSize.
+	MaxSize int
+
+	src replayReader
+	r   *bufio.Reader // reads src
+	off int64         // the offset of the next byte of r
+	buf []byte
+	br  bytes.Reader
+	mr  *msgp.Reader
+}
+
+// A replayReader reads pend before r, so that the bytes of a corrupt frame can be read again.
+type replayReader struct {
+	pend []byte
+	r    io.Reader
+}
+
+func (p *replayReader) Read(b []byte) (int, error) {
+	if len(p.pend) > 0 {
+		n := copy(b, p.pend)
+		p.pend = p.pend[n:]
+		return n, nil
+	}
+	return p.r.Read(b)
+}
+
+// NewReader returns a Reader that reads frames from r.
+func NewReader(r io.Reader) *Reader {
+	rd := &Reader{MaxSize: DefaultMaxSize}
+	rd.src.r = r
+	rd.r = bufio.NewReader(&rd.src)
+	return rd
+}
+
+// ReadFrame returns the payload of the next frame, which is valid until the next call. It returns
+// io.EOF at the end of the stream, io.ErrUnexpectedEOF if the stream ends inside of a frame, and
+// a SkipError if the frame is skipped.
+func (r *Reader) ReadFrame() ([]byte, error) {
+	start := r.off
+	hdr, err := r.r.Peek(headerSize)
+	if err != nil {
+		if err == io.EOF && len(hdr) > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	if !validHeader(hdr) {
+		n, err := r.resync()
+		if err != nil {
+			return nil, err
+		}
+		return nil, SkipError{Offset: start, Reason: fmt.Sprintf("corrupt header (skipped %d bytes)", n)}
+	}
+	var h [headerSize]byte
+	copy(h[:], hdr)
+	size := binary.BigEndian.Uint32(hdr[len(magic):])
+	r.discard(headerSize)
+	if int64(size) > int64(r.MaxSize) {
+		if n, _ := r.r.Discard(int(size) + crcSize); n < int(size)+crcSize {
+			r.off += int64(n)
+			return nil, io.ErrUnexpectedEOF
+		}
+		r.off += int64(size) + crcSize
+		return nil, SkipError{Offset: start, Reason: fmt.Sprintf("payload of %d bytes is too large", size)}
+	}
+	n := int(size) + crcSize
+	if cap(r.buf) < n {
+		r.buf = make([]byte, n)
+	}
+	b := r.buf[:n]
+	m, err := io.ReadFull(r.r, b)
+	r.off += int64(m)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		// Bytes may have been lost inside of the frame, so the frames after it may be among
+		// those read.
+		if err = r.rescan(h[:], b[:m]); err != nil {
+			return nil, err
+		}
+		if _, err = r.r.Peek(1); err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, SkipError{Offset: start, Reason: "truncated payload"}
+	} else if err != nil {
+		return nil, err
+	}
+	payload := b[:size]
+	if crc32.Checksum(payload, castagnoli) != binary.BigEndian.Uint32(b[size:]) {
+		// Bytes lost or inserted inside of the payload may have shifted the next frame into
+		// the bytes read.
+		if err = r.rescan(h[:], b); err != nil {
+			return nil, err
+		}
+		return nil, SkipError{Offset: start, Reason: "payload checksum mismatch"}
+	}
+	return payload, nil
+}
+
+// rescan skips to the first valid frame header after the start of the corrupt frame whose
+// header and following bytes, which have been read, are hdr and body.
+func (r *Reader) rescan(hdr, body []byte) error {
+	buffered, _ := r.r.Peek(r.r.Buffered())
+	pend := make([]byte, 0, len(hdr)+len(body)+len(buffered)+len(r.src.pend))
+	pend = append(append(append(append(pend, hdr...), body...), buffered...), r.src.pend...)
+	r.src.pend = pend
+	r.r.Reset(&r.src)
+	r.off -= int64(len(hdr) + len(body))
+	_, err := r.resync()
+	return err
+}
+
+// validHeader says if hdr is a frame header with the right magic and checksum.
+func validHeader(hdr []byte) bool {
+	return string(hdr[:len(magic)]) == magic &&
+		crc32.Checksum(hdr[:len(magic)+4], castagnoli) == binary.BigEndian.Uint32(hdr[len(magic)+4:])
+}
+
+// resync skips bytes up to the next valid frame header, or to the end of the stream, and returns
+// the number of bytes skipped.
+func (r *Reader) resync() (int, error) {
+	skipped := 0
+	for {
+		r.discard(1)
+		skipped++
+		hdr, err := r.r.Peek(headerSize)
+		if err == io.EOF {
+			n, _ := r.r.Discard(len(hdr))
+			r.off += int64(n)
+			return skipped + n, nil
+		} else if err != nil {
+			return skipped, err
+		}
+		if hdr[0] == magic[0] && validHeader(hdr) {
+			return skipped, nil
+		}
+	}
+}
+
+// discard discards n bytes that have been peeked.
+func (r *Reader) discard(n int) {
+	n, _ = r.r.Discard(n)
+	r.off += int64(n)
+}
+
+// Unmarshal reads the next frame and decodes u from its payload.
+func (r *Reader) Unmarshal(u msgp.Unmarshaler) error {
+	p, err := r.ReadFrame()
+	if err != nil {
+		return err
+	}
+	_, err = u.UnmarshalMsg(p)
+	return err
+}
+
+// Decode reads the next frame and decodes d from its payload. An error in decoding the payload
+// does not affect the frames after it.
+func (r *Reader) Decode(d msgp.Decoder) error {
+	p, err := r.ReadFrame()
+	if err != nil {
+		return err
+	}
+	r.br.Reset(p)
+	if r.mr == nil {
+		r.mr = msgp.NewReader(&r.br)
+	} else {
+		r.mr.Reset(&r.br)
+	}
+	return d.DecodeMsg(r.mr)
+}
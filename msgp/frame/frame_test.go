@@ -0,0 +1,172 @@
+package frame
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/dchenk/msgp/msgp"
+)
+
+// frames writes the objects as frames, alternating Marshal and Encode, and returns the stream
+// and the offset of each frame in it.
+func frames(t *testing.T, objs ...msgp.Raw) ([]byte, []int) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	var offsets []int
+	for i, o := range objs {
+		offsets = append(offsets, buf.Len())
+		var err error
+		if i%2 == 0 {
+			err = w.Marshal(o)
+		} else {
+			err = w.Encode(o)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes(), offsets
+}
+
+func objects() []msgp.Raw {
+	return []msgp.Raw{
+		msgp.AppendString(nil, "first"),
+		msgp.AppendInt64(nil, -2),
+		msgp.AppendBytes(nil, bytes.Repeat([]byte{0xc1}, 100)),
+		msgp.AppendMapHeader(nil, 0),
+	}
+}
+
+// readAll reads frames until EOF and returns the objects and the number of SkipErrors.
+func readAll(t *testing.T, r *Reader) ([]msgp.Raw, int) {
+	var got []msgp.Raw
+	skipped := 0
+	for i := 0; ; i++ {
+		var o msgp.Raw
+		var err error
+		if i%2 == 0 {
+			err = r.Decode(&o)
+		} else {
+			err = r.Unmarshal(&o)
+		}
+		if err == io.EOF {
+			return got, skipped
+		}
+		if _, ok := err.(SkipError); ok {
+			skipped++
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, o)
+	}
+}
+
+func equalObjects(a, b []msgp.Raw) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestRoundTrip(t *testing.T) {
+	objs := objects()
+	stream, _ := frames(t, objs...)
+	got, skipped := readAll(t, NewReader(bytes.NewReader(stream)))
+	if skipped != 0 || !equalObjects(got, objs) {
+		t.Errorf("got %v with %d skipped; want %v", got, skipped, objs)
+	}
+}
+
+func TestCorruption(t *testing.T) {
+	objs := objects()
+	stream, offsets := frames(t, objs...)
+	cases := map[string]struct {
+		edit func([]byte) []byte
+		want []msgp.Raw
+	}{
+		"payload": {
+			edit: func(b []byte) []byte { b[offsets[1]+headerSize] ^= 0xff; return b },
+			want: []msgp.Raw{objs[0], objs[2], objs[3]},
+		},
+		"length": {
+			edit: func(b []byte) []byte { b[offsets[2]+3] ^= 0x10; return b },
+			want: []msgp.Raw{objs[0], objs[1], objs[3]},
+		},
+		"dropped bytes": {
+			edit: func(b []byte) []byte { return append(b[:offsets[1]+1], b[offsets[1]+4:]...) },
+			want: []msgp.Raw{objs[0], objs[2], objs[3]},
+		},
+		"dropped payload byte": {
+			edit: func(b []byte) []byte { return append(b[:offsets[1]+headerSize], b[offsets[1]+headerSize+1:]...) },
+			want: []msgp.Raw{objs[0], objs[2], objs[3]},
+		},
+		"inserted payload byte": {
+			edit: func(b []byte) []byte {
+				i := offsets[2] + headerSize + 5
+				return append(b[:i], append([]byte{0xc1}, b[i:]...)...)
+			},
+			want: []msgp.Raw{objs[0], objs[1], objs[3]},
+		},
+		"dropped bytes before the last frame": {
+			edit: func(b []byte) []byte { return append(b[:offsets[2]+headerSize], b[offsets[2]+headerSize+20:]...) },
+			want: []msgp.Raw{objs[0], objs[1], objs[3]},
+		},
+		"garbage between frames": {
+			edit: func(b []byte) []byte {
+				g := append([]byte("\xc1F garbage"), b[offsets[3]:]...)
+				return append(b[:offsets[3]], g...)
+			},
+			want: objs,
+		},
+		"garbage at the start": {
+			edit: func(b []byte) []byte { return append([]byte("\xc1F\x00\x00 more garbage"), b...) },
+			want: objs,
+		},
+	}
+	for name, c := range cases {
+		b := c.edit(append([]byte(nil), stream...))
+		got, skipped := readAll(t, NewReader(bytes.NewReader(b)))
+		if skipped != 1 || !equalObjects(got, c.want) {
+			t.Errorf("%s: got %v with %d skipped; want %v with 1 skipped", name, got, skipped, c.want)
+		}
+	}
+}
+
+func TestMaxSize(t *testing.T) {
+	objs := objects()
+	stream, _ := frames(t, objs...)
+	r := NewReader(bytes.NewReader(stream))
+	r.MaxSize = 50
+	got, skipped := readAll(t, r)
+	if want := []msgp.Raw{objs[0], objs[1], objs[3]}; skipped != 1 || !equalObjects(got, want) {
+		t.Errorf("got %v with %d skipped; want %v with 1 skipped", got, skipped, want)
+	}
+
+	w := NewWriter(io.Discard)
+	w.MaxSize = 50
+	if err := w.Marshal(objs[2]); err != ErrTooLarge {
+		t.Errorf("got error %v for a large payload; want ErrTooLarge", err)
+	}
+}
+
+func TestTruncated(t *testing.T) {
+	stream, _ := frames(t, objects()...)
+	for _, n := range []int{5, headerSize + 2, len(stream) - 1} {
+		r := NewReader(bytes.NewReader(stream[:n]))
+		var err error
+		for err == nil {
+			_, err = r.ReadFrame()
+		}
+		if err != io.ErrUnexpectedEOF {
+			t.Errorf("stream cut to %d bytes: got error %v; want io.ErrUnexpectedEOF", n, err)
+		}
+	}
+}
@@ -91,6 +91,8 @@ func rwNext(w jsWriter, src *Reader) (int, error) {
 		return rwExtension(w, src)
 	case TimeType:
 		return rwTime(w, src)
+	case BigIntType, BigFloatType, BigRatType, IPType, UUIDType:
+		return rwStd(w, src)
 	default:
 		return 0, err
 	}
@@ -257,6 +259,15 @@ func rwTime(dst jsWriter, src *Reader) (int, error) {
 	return dst.Write(bts)
 }
 
+func rwStd(dst jsWriter, src *Reader) (int, error) {
+	v, err := src.ReadIntf()
+	if err != nil {
+		return 0, err
+	}
+	src.scratch = appendStdJSON(src.scratch[:0], v)
+	return dst.Write(src.scratch)
+}
+
 func rwExtension(dst jsWriter, src *Reader) (int, error) {
 
 	et, err := src.peekExtensionType()
@@ -265,7 +276,7 @@ func rwExtension(dst jsWriter, src *Reader) (int, error) {
 	}
 
 	// Registered extensions can override the JSON encoding.
-	if j, ok := extensionReg[et]; ok {
+	if j, ok := src.extensions().Lookup(et); ok {
 		e := j()
 		err = src.ReadExtension(e)
 		if err != nil {
@@ -12,6 +12,16 @@ import (
 // If an error is returned, the bytes not unmarshalled will also be returned.
 // If no errors are encountered, the length of the returned slice will be zero.
 func UnmarshalAsJSON(w io.Writer, msg []byte) ([]byte, error) {
+	return unmarshalAsJSON(w, msg, DefaultExtensions)
+}
+
+// UnmarshalAsJSON is like the UnmarshalAsJSON function but decodes extensions using the
+// registry r.
+func (r *ExtensionRegistry) UnmarshalAsJSON(w io.Writer, msg []byte) ([]byte, error) {
+	return unmarshalAsJSON(w, msg, r)
+}
+
+func unmarshalAsJSON(w io.Writer, msg []byte, reg *ExtensionRegistry) ([]byte, error) {
 	var cast bool
 	var dst jsWriter
 	if jsw, ok := w.(jsWriter); ok {
@@ -21,8 +31,8 @@ func UnmarshalAsJSON(w io.Writer, msg []byte) ([]byte, error) {
 		dst = bufio.NewWriterSize(w, 512)
 	}
 	var err error
-	for len(msg) > 0 {
-		msg, _, err = writeNext(dst, msg, nil)
+	for len(msg) > 0 && err == nil {
+		msg, _, err = writeNext(dst, msg, nil, reg)
 	}
 	if !cast && err == nil {
 		err = dst.(*bufio.Writer).Flush()
@@ -30,20 +40,18 @@ func UnmarshalAsJSON(w io.Writer, msg []byte) ([]byte, error) {
 	return msg, err
 }
 
-func writeNext(w jsWriter, msg []byte, scratch []byte) ([]byte, []byte, error) {
+func writeNext(w jsWriter, msg []byte, scratch []byte, reg *ExtensionRegistry) ([]byte, []byte, error) {
 	if len(msg) == 0 {
 		return msg, scratch, ErrShortBytes
 	}
 	t := getType(msg[0])
 	if t == ExtensionType {
-		// The TimeExtension type is encoded the time.MarshalJSON way.
+		// Most of the built-in extension types have their own JSON form.
 		et, err := peekExtension(msg)
 		if err != nil {
 			return nil, scratch, err
 		}
-		if et == TimeExtension {
-			t = TimeType
-		}
+		t = builtinExtType(et)
 	}
 	switch t {
 	case InvalidType:
@@ -53,9 +61,9 @@ func writeNext(w jsWriter, msg []byte, scratch []byte) ([]byte, []byte, error) {
 	case BinType:
 		return rwBytesBytes(w, msg, scratch)
 	case MapType:
-		return rwMapBytes(w, msg, scratch)
+		return rwMapBytes(w, msg, scratch, reg)
 	case ArrayType:
-		return rwArrayBytes(w, msg, scratch)
+		return rwArrayBytes(w, msg, scratch, reg)
 	case Float64Type:
 		return rwFloat64Bytes(w, msg, scratch)
 	case Float32Type:
@@ -69,15 +77,17 @@ func writeNext(w jsWriter, msg []byte, scratch []byte) ([]byte, []byte, error) {
 	case NilType:
 		return rwNullBytes(w, msg, scratch)
 	case ExtensionType, Complex64Type, Complex128Type:
-		return rwExtensionBytes(w, msg, scratch)
+		return rwExtensionBytes(w, msg, scratch, reg)
 	case TimeType:
 		return rwTimeBytes(w, msg, scratch)
+	case BigIntType, BigFloatType, BigRatType, IPType, UUIDType:
+		return rwStdBytes(w, msg, scratch, reg)
 	default:
 		return nil, msg, InvalidPrefixError(msg[0])
 	}
 }
 
-func rwArrayBytes(w jsWriter, msg []byte, scratch []byte) ([]byte, []byte, error) {
+func rwArrayBytes(w jsWriter, msg []byte, scratch []byte, reg *ExtensionRegistry) ([]byte, []byte, error) {
 	sz, msg, err := ReadArrayHeaderBytes(msg)
 	if err != nil {
 		return msg, scratch, err
@@ -93,7 +103,7 @@ func rwArrayBytes(w jsWriter, msg []byte, scratch []byte) ([]byte, []byte, error
 				return msg, scratch, err
 			}
 		}
-		msg, scratch, err = writeNext(w, msg, scratch)
+		msg, scratch, err = writeNext(w, msg, scratch, reg)
 		if err != nil {
 			return msg, scratch, err
 		}
@@ -102,7 +112,7 @@ func rwArrayBytes(w jsWriter, msg []byte, scratch []byte) ([]byte, []byte, error
 	return msg, scratch, err
 }
 
-func rwMapBytes(w jsWriter, msg []byte, scratch []byte) ([]byte, []byte, error) {
+func rwMapBytes(w jsWriter, msg []byte, scratch []byte, reg *ExtensionRegistry) ([]byte, []byte, error) {
 	sz, msg, err := ReadMapHeaderBytes(msg)
 	if err != nil {
 		return msg, scratch, err
@@ -126,7 +136,7 @@ func rwMapBytes(w jsWriter, msg []byte, scratch []byte) ([]byte, []byte, error)
 		if err != nil {
 			return msg, scratch, err
 		}
-		msg, scratch, err = writeNext(w, msg, scratch)
+		msg, scratch, err = writeNext(w, msg, scratch, reg)
 		if err != nil {
 			return msg, scratch, err
 		}
@@ -240,6 +250,16 @@ func rwFloat64Bytes(w jsWriter, msg []byte, scratch []byte) ([]byte, []byte, err
 	return msg, scratch, err
 }
 
+func rwStdBytes(w jsWriter, msg []byte, scratch []byte, reg *ExtensionRegistry) ([]byte, []byte, error) {
+	v, msg, err := readIntfBytes(msg, reg)
+	if err != nil {
+		return msg, scratch, err
+	}
+	scratch = appendStdJSON(scratch[:0], v)
+	_, err = w.Write(scratch)
+	return msg, scratch, err
+}
+
 func rwTimeBytes(w jsWriter, msg []byte, scratch []byte) ([]byte, []byte, error) {
 	t, msg, err := ReadTimeBytes(msg)
 	if err != nil {
@@ -254,7 +274,7 @@ func rwTimeBytes(w jsWriter, msg []byte, scratch []byte) ([]byte, []byte, error)
 }
 
 // rwExtensionBytes writes out an extension. Values of type time.Time should be handled by rwTimeBytes.
-func rwExtensionBytes(w jsWriter, msg []byte, scratch []byte) ([]byte, []byte, error) {
+func rwExtensionBytes(w jsWriter, msg []byte, scratch []byte, reg *ExtensionRegistry) ([]byte, []byte, error) {
 
 	et, err := peekExtension(msg)
 	if err != nil {
@@ -262,7 +282,7 @@ func rwExtensionBytes(w jsWriter, msg []byte, scratch []byte) ([]byte, []byte, e
 	}
 
 	// If the extension is registered, use its canonical JSON form.
-	if f, ok := extensionReg[et]; ok {
+	if f, ok := reg.Lookup(et); ok {
 		e := f()
 		msg, err = ReadExtensionBytes(msg, e)
 		if err != nil {
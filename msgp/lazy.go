@@ -0,0 +1,120 @@
+package msgp
+
+// Lazy holds an encoded object that is decoded only when it is needed. It implements Marshaler,
+// Unmarshaler, Encoder, Decoder, and Sizer.
+//
+// Unmarshaling or decoding a Lazy keeps the bytes of the next object without interpreting them,
+// and marshaling or encoding it writes the same bytes again. Once the object is decoded with
+// Decode or replaced with Set, the value is encoded instead, so changes made to it are kept.
+//
+// Lazy is meant for struct fields holding large values that are seldom read. The "lazy" tag
+// option names the type that such a field holds, and the code generator gives the struct a
+// method that returns the field decoded into that type, named after the field:
+//
+//  type Envelope struct {
+//      ID      string    `msgp:"id"`
+//      Payload msgp.Lazy `msgp:"payload,lazy=Payload"`
+//  }
+//
+//  func (z *Envelope) PayloadValue() (*Payload, error)
+//
+// The zero Lazy holds nil.
+type Lazy struct {
+	raw Raw
+	val Marshaler // the decoded or set value, if any
+}
+
+// Decode decodes the object into v. The first call unmarshals the bytes; after that, v is the
+// value of l, and calling Decode with it again does nothing. If l holds nil, v is left unchanged.
+func (l *Lazy) Decode(v Unmarshaler) error {
+	if l.val != nil {
+		if interface{}(l.val) == interface{}(v) {
+			return nil
+		}
+		// The value was decoded into something else or set, so decode it from its encoding.
+		b, err := l.val.MarshalMsg(nil)
+		if err != nil {
+			return err
+		}
+		_, err = v.UnmarshalMsg(b)
+		return err
+	}
+	if len(l.raw) == 0 || l.raw[0] == mnil {
+		return nil
+	}
+	if _, err := v.UnmarshalMsg(l.raw); err != nil {
+		return err
+	}
+	if m, ok := v.(Marshaler); ok {
+		l.val = m
+		l.raw = l.raw[:0]
+	}
+	return nil
+}
+
+// Set replaces the object with v.
+func (l *Lazy) Set(v Marshaler) {
+	l.val = v
+	l.raw = l.raw[:0]
+}
+
+// Decoded says if the object is held as a value given to Decode or Set rather than as bytes.
+func (l *Lazy) Decoded() bool { return l.val != nil }
+
+// Value returns the value given to Decode or Set, or nil if the object is held as bytes.
+func (l *Lazy) Value() Marshaler { return l.val }
+
+// Raw returns the bytes of the object if it is not decoded. The bytes must not be modified.
+func (l *Lazy) Raw() Raw {
+	if l.val != nil {
+		return nil
+	}
+	return l.raw
+}
+
+// MarshalMsg implements Marshaler.
+func (l *Lazy) MarshalMsg(b []byte) ([]byte, error) {
+	if l.val != nil {
+		return l.val.MarshalMsg(b)
+	}
+	return l.raw.MarshalMsg(b)
+}
+
+// UnmarshalMsg implements Unmarshaler. It keeps the bytes of the next object in b.
+func (l *Lazy) UnmarshalMsg(b []byte) ([]byte, error) {
+	l.val = nil
+	return l.raw.UnmarshalMsg(b)
+}
+
+// EncodeMsg implements Encoder.
+func (l *Lazy) EncodeMsg(w *Writer) error {
+	if l.val == nil {
+		return l.raw.EncodeMsg(w)
+	}
+	if e, ok := l.val.(Encoder); ok {
+		return e.EncodeMsg(w)
+	}
+	b, err := l.val.MarshalMsg(nil)
+	if err != nil {
+		return err
+	}
+	return Raw(b).EncodeMsg(w)
+}
+
+// DecodeMsg implements Decoder. It keeps the bytes of the next object on the wire.
+func (l *Lazy) DecodeMsg(r *Reader) error {
+	l.val = nil
+	return l.raw.DecodeMsg(r)
+}
+
+// Msgsize implements Sizer.
+func (l *Lazy) Msgsize() int {
+	if l.val == nil {
+		return l.raw.Msgsize()
+	}
+	if s, ok := l.val.(Sizer); ok {
+		return s.Msgsize()
+	}
+	b, _ := l.val.MarshalMsg(nil)
+	return len(b)
+}
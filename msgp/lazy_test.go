@@ -0,0 +1,69 @@
+package msgp
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestLazy(t *testing.T) {
+	obj := AppendMapHeader(nil, 1)
+	obj = AppendString(obj, "a")
+	obj = AppendInt(obj, 1)
+	in := append(append([]byte{}, obj...), AppendBool(nil, true)...)
+
+	var l Lazy
+	var _ allifaces = &l
+	rest, err := l.UnmarshalMsg(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rest) != 1 || !bytes.Equal(l.Raw(), obj) || l.Decoded() {
+		t.Fatalf("UnmarshalMsg kept %x, leaving %x", l.Raw(), rest)
+	}
+	if out, _ := l.MarshalMsg(nil); !bytes.Equal(out, obj) || l.Msgsize() != len(obj) {
+		t.Errorf("MarshalMsg wrote %x", out)
+	}
+
+	var r Raw
+	if err = l.Decode(&r); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(r, obj) || !l.Decoded() || l.Raw() != nil {
+		t.Errorf("Decode set %x", r)
+	}
+	// Changes to the decoded value are encoded.
+	r = AppendString(r[:0], "changed")
+	if out, _ := l.MarshalMsg(nil); !bytes.Equal(out, r) {
+		t.Errorf("after a change, MarshalMsg wrote %x", out)
+	}
+	var other Raw
+	if err = l.Decode(&other); err != nil || !bytes.Equal(other, r) {
+		t.Errorf("decoding again into another value: %x, %v", other, err)
+	}
+
+	l.Set(Raw(AppendInt(nil, 5)))
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	if err = l.EncodeMsg(w); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	var dl Lazy
+	if err = dl.DecodeMsg(NewReader(&buf)); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(dl.Raw(), AppendInt(nil, 5)) {
+		t.Errorf("DecodeMsg kept %x", dl.Raw())
+	}
+
+	var zero Lazy
+	if out, _ := zero.MarshalMsg(nil); !bytes.Equal(out, []byte{mnil}) {
+		t.Errorf("the zero Lazy marshaled to %x", out)
+	}
+	r = Raw{1}
+	if err = zero.Decode(&r); err != nil || !bytes.Equal(r, Raw{1}) || zero.Decoded() {
+		t.Errorf("decoding the zero Lazy: %x, %v", r, err)
+	}
+}
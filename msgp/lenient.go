@@ -0,0 +1,404 @@
+package msgp
+
+import "math"
+
+// Lenient decoding
+//
+// By default, each decoding method accepts only the MessagePack types that correspond to the
+// type being read. (Integers are the exception: signed and unsigned integers are both accepted
+// by the methods that read signed integers.) Encoders for other languages are often less
+// particular about types, so lenient decoding also performs the following conversions, each of
+// which must be exact:
+//
+//  - a signed integer is read from a float holding a whole number or from an unsigned integer
+//  - an unsigned integer is read from a float holding a non-negative whole number or from a
+//    non-negative signed integer
+//  - a float is read from an integer that the float type represents exactly, and a float32 is
+//    read from a float64 that converts to a float32 without rounding
+//  - a string is read from 'bin' data, and 'bin' data is read from a string
+//
+// A value that cannot be converted exactly results in a ConversionError, IntOverflow, or
+// UintOverflow error. Lenient decoding is enabled for everything a Reader or a BytesSource reads
+// with its Lenient field, for single values read by a Reader with its methods named Read*Lenient,
+// and for byte slices with the functions named Read*BytesLenient.
+
+// numberInt64 converts n to an int64 without loss.
+func numberInt64(n *Number) (int64, error) {
+	switch n.Type() {
+	case IntType:
+		i, _ := n.Int()
+		return i, nil
+	case UintType:
+		u, _ := n.Uint()
+		if u > math.MaxInt64 {
+			return 0, UintOverflow{Value: u, FailedBitsize: 64}
+		}
+		return int64(u), nil
+	default:
+		f, _ := n.Float()
+		if f != math.Trunc(f) || f < -(1<<63) || f >= 1<<63 {
+			return 0, ConversionError{Value: f, Want: "int64"}
+		}
+		return int64(f), nil
+	}
+}
+
+// numberUint64 converts n to a uint64 without loss.
+func numberUint64(n *Number) (uint64, error) {
+	switch n.Type() {
+	case IntType:
+		i, _ := n.Int()
+		if i < 0 {
+			return 0, ConversionError{Value: i, Want: "uint64"}
+		}
+		return uint64(i), nil
+	case UintType:
+		u, _ := n.Uint()
+		return u, nil
+	default:
+		f, _ := n.Float()
+		if f != math.Trunc(f) || f < 0 || f >= 1<<64 {
+			return 0, ConversionError{Value: f, Want: "uint64"}
+		}
+		return uint64(f), nil
+	}
+}
+
+// numberFloat converts n to a float with the given bit size (32 or 64) without loss.
+func numberFloat(n *Number, bits int) (float64, error) {
+	want := "float64"
+	if bits == 32 {
+		want = "float32"
+	}
+	switch n.Type() {
+	case IntType:
+		i, _ := n.Int()
+		f := roundFloat(float64(i), bits)
+		if f >= 1<<63 || int64(f) != i {
+			return 0, ConversionError{Value: i, Want: want}
+		}
+		return f, nil
+	case UintType:
+		u, _ := n.Uint()
+		f := roundFloat(float64(u), bits)
+		if f >= 1<<64 || uint64(f) != u {
+			return 0, ConversionError{Value: u, Want: want}
+		}
+		return f, nil
+	default:
+		f, _ := n.Float()
+		if bits == 32 && !math.IsNaN(f) && float64(float32(f)) != f {
+			return 0, ConversionError{Value: f, Want: want}
+		}
+		return f, nil
+	}
+}
+
+// roundFloat rounds f to a float32 if bits is 32.
+func roundFloat(f float64, bits int) float64 {
+	if bits == 32 {
+		return float64(float32(f))
+	}
+	return f
+}
+
+// checkInt returns an IntOverflow error if i does not fit into bits bits.
+func checkInt(i int64, bits int) error {
+	if bits < 64 && (i > 1<<(bits-1)-1 || i < -1<<(bits-1)) {
+		return IntOverflow{Value: i, FailedBitsize: bits}
+	}
+	return nil
+}
+
+// checkUint returns a UintOverflow error if u does not fit into bits bits.
+func checkUint(u uint64, bits int) error {
+	if bits < 64 && u > 1<<bits-1 {
+		return UintOverflow{Value: u, FailedBitsize: bits}
+	}
+	return nil
+}
+
+func (m *Reader) readInt64Lenient() (int64, error) {
+	var n Number
+	if err := n.DecodeMsg(m); err != nil {
+		return 0, err
+	}
+	return numberInt64(&n)
+}
+
+func (m *Reader) readUint64Lenient() (uint64, error) {
+	var n Number
+	if err := n.DecodeMsg(m); err != nil {
+		return 0, err
+	}
+	return numberUint64(&n)
+}
+
+func (m *Reader) readFloatLenient(bits int) (float64, error) {
+	var n Number
+	if err := n.DecodeMsg(m); err != nil {
+		return 0, err
+	}
+	return numberFloat(&n, bits)
+}
+
+// isLenientType says if lenient decoding is on and the lead byte in p has type t.
+func (m *Reader) isLenientType(p []byte, t Type) bool {
+	return m.Lenient && len(p) > 0 && getType(p[0]) == t
+}
+
+// lenient turns on lenient decoding for one read. It returns the old setting of Lenient,
+// which the caller restores with a deferred call to restoreLenient.
+func (m *Reader) lenient() bool {
+	old := m.Lenient
+	m.Lenient = true
+	return old
+}
+
+func (m *Reader) restoreLenient(old bool) { m.Lenient = old }
+
+// ReadInt64Lenient is like ReadInt64 but decodes leniently whatever the Lenient field says.
+func (m *Reader) ReadInt64Lenient() (int64, error) {
+	defer m.restoreLenient(m.lenient())
+	return m.ReadInt64()
+}
+
+// ReadInt32Lenient is like ReadInt32 but decodes leniently whatever the Lenient field says.
+func (m *Reader) ReadInt32Lenient() (int32, error) {
+	defer m.restoreLenient(m.lenient())
+	return m.ReadInt32()
+}
+
+// ReadInt16Lenient is like ReadInt16 but decodes leniently whatever the Lenient field says.
+func (m *Reader) ReadInt16Lenient() (int16, error) {
+	defer m.restoreLenient(m.lenient())
+	return m.ReadInt16()
+}
+
+// ReadInt8Lenient is like ReadInt8 but decodes leniently whatever the Lenient field says.
+func (m *Reader) ReadInt8Lenient() (int8, error) {
+	defer m.restoreLenient(m.lenient())
+	return m.ReadInt8()
+}
+
+// ReadIntLenient is like ReadInt but decodes leniently whatever the Lenient field says.
+func (m *Reader) ReadIntLenient() (int, error) {
+	defer m.restoreLenient(m.lenient())
+	return m.ReadInt()
+}
+
+// ReadUint64Lenient is like ReadUint64 but decodes leniently whatever the Lenient field says.
+func (m *Reader) ReadUint64Lenient() (uint64, error) {
+	defer m.restoreLenient(m.lenient())
+	return m.ReadUint64()
+}
+
+// ReadUint32Lenient is like ReadUint32 but decodes leniently whatever the Lenient field says.
+func (m *Reader) ReadUint32Lenient() (uint32, error) {
+	defer m.restoreLenient(m.lenient())
+	return m.ReadUint32()
+}
+
+// ReadUint16Lenient is like ReadUint16 but decodes leniently whatever the Lenient field says.
+func (m *Reader) ReadUint16Lenient() (uint16, error) {
+	defer m.restoreLenient(m.lenient())
+	return m.ReadUint16()
+}
+
+// ReadUint8Lenient is like ReadUint8 but decodes leniently whatever the Lenient field says.
+func (m *Reader) ReadUint8Lenient() (uint8, error) {
+	defer m.restoreLenient(m.lenient())
+	return m.ReadUint8()
+}
+
+// ReadUintLenient is like ReadUint but decodes leniently whatever the Lenient field says.
+func (m *Reader) ReadUintLenient() (uint, error) {
+	defer m.restoreLenient(m.lenient())
+	return m.ReadUint()
+}
+
+// ReadByteLenient is like ReadByte but decodes leniently whatever the Lenient field says.
+func (m *Reader) ReadByteLenient() (byte, error) {
+	defer m.restoreLenient(m.lenient())
+	return m.ReadByte()
+}
+
+// ReadFloat64Lenient is like ReadFloat64 but decodes leniently whatever the Lenient field says.
+func (m *Reader) ReadFloat64Lenient() (float64, error) {
+	defer m.restoreLenient(m.lenient())
+	return m.ReadFloat64()
+}
+
+// ReadFloat32Lenient is like ReadFloat32 but decodes leniently whatever the Lenient field says.
+func (m *Reader) ReadFloat32Lenient() (float32, error) {
+	defer m.restoreLenient(m.lenient())
+	return m.ReadFloat32()
+}
+
+// ReadStringLenient is like ReadString but also reads 'bin' data whatever the Lenient field says.
+func (m *Reader) ReadStringLenient() (string, error) {
+	defer m.restoreLenient(m.lenient())
+	return m.ReadString()
+}
+
+// ReadBytesLenient is like ReadBytes but also reads strings whatever the Lenient field says.
+func (m *Reader) ReadBytesLenient(scratch []byte) ([]byte, error) {
+	defer m.restoreLenient(m.lenient())
+	return m.ReadBytes(scratch)
+}
+
+// ReadInt64BytesLenient is like ReadInt64Bytes but decodes leniently.
+func ReadInt64BytesLenient(b []byte) (int64, []byte, error) {
+	i, o, err := ReadInt64Bytes(b)
+	if _, ok := err.(TypeError); !ok {
+		return i, o, err
+	}
+	var n Number
+	o, err = n.UnmarshalMsg(b)
+	if err != nil {
+		return 0, b, err
+	}
+	if i, err = numberInt64(&n); err != nil {
+		return 0, b, err
+	}
+	return i, o, nil
+}
+
+func readIntBytesLenient(b []byte, bits int) (int64, []byte, error) {
+	i, o, err := ReadInt64BytesLenient(b)
+	if err == nil {
+		if err = checkInt(i, bits); err != nil {
+			return 0, b, err
+		}
+	}
+	return i, o, err
+}
+
+// ReadInt32BytesLenient is like ReadInt32Bytes but decodes leniently.
+func ReadInt32BytesLenient(b []byte) (int32, []byte, error) {
+	i, o, err := readIntBytesLenient(b, 32)
+	return int32(i), o, err
+}
+
+// ReadInt16BytesLenient is like ReadInt16Bytes but decodes leniently.
+func ReadInt16BytesLenient(b []byte) (int16, []byte, error) {
+	i, o, err := readIntBytesLenient(b, 16)
+	return int16(i), o, err
+}
+
+// ReadInt8BytesLenient is like ReadInt8Bytes but decodes leniently.
+func ReadInt8BytesLenient(b []byte) (int8, []byte, error) {
+	i, o, err := readIntBytesLenient(b, 8)
+	return int8(i), o, err
+}
+
+// ReadIntBytesLenient is like ReadIntBytes but decodes leniently.
+func ReadIntBytesLenient(b []byte) (int, []byte, error) {
+	if smallint {
+		i, o, err := readIntBytesLenient(b, 32)
+		return int(i), o, err
+	}
+	i, o, err := ReadInt64BytesLenient(b)
+	return int(i), o, err
+}
+
+// ReadUint64BytesLenient is like ReadUint64Bytes but decodes leniently.
+func ReadUint64BytesLenient(b []byte) (uint64, []byte, error) {
+	u, o, err := ReadUint64Bytes(b)
+	if _, ok := err.(TypeError); !ok {
+		return u, o, err
+	}
+	var n Number
+	o, err = n.UnmarshalMsg(b)
+	if err != nil {
+		return 0, b, err
+	}
+	if u, err = numberUint64(&n); err != nil {
+		return 0, b, err
+	}
+	return u, o, nil
+}
+
+func readUintBytesLenient(b []byte, bits int) (uint64, []byte, error) {
+	u, o, err := ReadUint64BytesLenient(b)
+	if err == nil {
+		if err = checkUint(u, bits); err != nil {
+			return 0, b, err
+		}
+	}
+	return u, o, err
+}
+
+// ReadUint32BytesLenient is like ReadUint32Bytes but decodes leniently.
+func ReadUint32BytesLenient(b []byte) (uint32, []byte, error) {
+	u, o, err := readUintBytesLenient(b, 32)
+	return uint32(u), o, err
+}
+
+// ReadUint16BytesLenient is like ReadUint16Bytes but decodes leniently.
+func ReadUint16BytesLenient(b []byte) (uint16, []byte, error) {
+	u, o, err := readUintBytesLenient(b, 16)
+	return uint16(u), o, err
+}
+
+// ReadUint8BytesLenient is like ReadUint8Bytes but decodes leniently.
+func ReadUint8BytesLenient(b []byte) (uint8, []byte, error) {
+	u, o, err := readUintBytesLenient(b, 8)
+	return uint8(u), o, err
+}
+
+// ReadByteBytesLenient is analogous to ReadUint8BytesLenient.
+func ReadByteBytesLenient(b []byte) (byte, []byte, error) {
+	return ReadUint8BytesLenient(b)
+}
+
+// ReadUintBytesLenient is like ReadUintBytes but decodes leniently.
+func ReadUintBytesLenient(b []byte) (uint, []byte, error) {
+	if smallint {
+		u, o, err := readUintBytesLenient(b, 32)
+		return uint(u), o, err
+	}
+	u, o, err := ReadUint64BytesLenient(b)
+	return uint(u), o, err
+}
+
+func readFloatBytesLenient(b []byte, bits int) (float64, []byte, error) {
+	var n Number
+	o, err := n.UnmarshalMsg(b)
+	if err != nil {
+		return 0, b, err
+	}
+	f, err := numberFloat(&n, bits)
+	if err != nil {
+		return 0, b, err
+	}
+	return f, o, nil
+}
+
+// ReadFloat64BytesLenient is like ReadFloat64Bytes but decodes leniently.
+func ReadFloat64BytesLenient(b []byte) (float64, []byte, error) {
+	return readFloatBytesLenient(b, 64)
+}
+
+// ReadFloat32BytesLenient is like ReadFloat32Bytes but decodes leniently.
+func ReadFloat32BytesLenient(b []byte) (float32, []byte, error) {
+	f, o, err := readFloatBytesLenient(b, 32)
+	return float32(f), o, err
+}
+
+// ReadStringBytesLenient is like ReadStringBytes but also reads 'bin' data.
+func ReadStringBytesLenient(b []byte) (string, []byte, error) {
+	if NextType(b) == BinType {
+		v, o, err := ReadBytesZC(b)
+		return string(v), o, err
+	}
+	return ReadStringBytes(b)
+}
+
+// ReadBytesBytesLenient is like ReadBytesBytes but also reads strings.
+func ReadBytesBytesLenient(b []byte, scratch []byte) ([]byte, []byte, error) {
+	if NextType(b) == StrType {
+		return ReadStringAsBytes(b, scratch)
+	}
+	return ReadBytesBytes(b, scratch)
+}
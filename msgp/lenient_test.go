@@ -0,0 +1,166 @@
+package msgp
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestLenientInts(t *testing.T) {
+	cases := []struct {
+		in   []byte
+		want int64
+		ok   bool
+	}{
+		{AppendFloat64(nil, 42), 42, true},
+		{AppendFloat32(nil, -7), -7, true},
+		{AppendFloat64(nil, 1.5), 0, false},
+		{AppendFloat64(nil, math.Inf(1)), 0, false},
+		{AppendFloat64(nil, math.NaN()), 0, false},
+		{AppendFloat64(nil, 1e19), 0, false},
+		{AppendUint64(nil, math.MaxUint32+1), math.MaxUint32 + 1, true},
+		{AppendString(nil, "1"), 0, false},
+	}
+	for i, c := range cases {
+		if _, _, err := ReadInt64Bytes(c.in); err == nil && NextType(c.in) != UintType {
+			t.Errorf("case %d: expected an error from strict decoding", i)
+		}
+
+		v, o, err := ReadInt64BytesLenient(c.in)
+		if c.ok && (err != nil || v != c.want || len(o) != 0) {
+			t.Errorf("case %d: got %d, %d bytes left, %v", i, v, len(o), err)
+		} else if !c.ok && err == nil {
+			t.Errorf("case %d: expected an error; got %d", i, v)
+		}
+
+		rd := NewReader(bytes.NewReader(c.in))
+		rd.Lenient = true
+		v, err = rd.ReadInt64()
+		if c.ok && (err != nil || v != c.want) {
+			t.Errorf("case %d: Reader got %d, %v", i, v, err)
+		} else if !c.ok && err == nil {
+			t.Errorf("case %d: Reader expected an error; got %d", i, v)
+		}
+	}
+
+	// Conversions are checked against the size of the type read.
+	_, _, err := ReadInt8BytesLenient(AppendFloat64(nil, 300))
+	if _, ok := err.(IntOverflow); !ok {
+		t.Errorf("expected an IntOverflow; got %v", err)
+	}
+	rd := NewReader(bytes.NewReader(AppendFloat64(nil, 300)))
+	rd.Lenient = true
+	if _, err = rd.ReadInt8(); err == nil {
+		t.Error("expected an error reading 300 as an int8")
+	}
+}
+
+func TestLenientUints(t *testing.T) {
+	cases := []struct {
+		in   []byte
+		want uint64
+		ok   bool
+	}{
+		{AppendInt64(nil, 5), 5, true},
+		{AppendInt8(nil, 100), 100, true},
+		{AppendInt64(nil, -1), 0, false},
+		{AppendFloat64(nil, 1e19), 1e19, true},
+		{AppendFloat64(nil, -1), 0, false},
+		{AppendFloat32(nil, 0.25), 0, false},
+	}
+	for i, c := range cases {
+		v, _, err := ReadUint64BytesLenient(c.in)
+		if c.ok && (err != nil || v != c.want) {
+			t.Errorf("case %d: got %d, %v", i, v, err)
+		} else if !c.ok && err == nil {
+			t.Errorf("case %d: expected an error; got %d", i, v)
+		}
+
+		rd := NewReader(bytes.NewReader(c.in))
+		rd.Lenient = true
+		v, err = rd.ReadUint64()
+		if c.ok && (err != nil || v != c.want) {
+			t.Errorf("case %d: Reader got %d, %v", i, v, err)
+		} else if !c.ok && err == nil {
+			t.Errorf("case %d: Reader expected an error; got %d", i, v)
+		}
+	}
+
+	_, _, err := ReadUint16BytesLenient(AppendInt64(nil, 70000))
+	if _, ok := err.(UintOverflow); !ok {
+		t.Errorf("expected a UintOverflow; got %v", err)
+	}
+}
+
+func TestLenientFloats(t *testing.T) {
+	f, _, err := ReadFloat64BytesLenient(AppendInt64(nil, -3))
+	if err != nil || f != -3 {
+		t.Errorf("got %v, %v", f, err)
+	}
+	if _, _, err = ReadFloat64BytesLenient(AppendInt64(nil, 1<<53+1)); err == nil {
+		t.Error("expected an error for an integer that a float64 can't hold")
+	}
+	if _, _, err = ReadFloat64BytesLenient(AppendUint64(nil, math.MaxUint64)); err == nil {
+		t.Error("expected an error for an integer that a float64 can't hold")
+	}
+	f32, _, err := ReadFloat32BytesLenient(AppendFloat64(nil, 0.5))
+	if err != nil || f32 != 0.5 {
+		t.Errorf("got %v, %v", f32, err)
+	}
+	if _, _, err = ReadFloat32BytesLenient(AppendFloat64(nil, 0.1)); err == nil {
+		t.Error("expected an error for a float64 that a float32 can't hold")
+	}
+	if _, _, err = ReadFloat32BytesLenient(AppendInt64(nil, 1<<24+1)); err == nil {
+		t.Error("expected an error for an integer that a float32 can't hold")
+	}
+
+	// A single-byte integer at the end of a stream.
+	rd := NewReader(bytes.NewReader(AppendInt64(nil, 7)))
+	rd.Lenient = true
+	f, err = rd.ReadFloat64()
+	if err != nil || f != 7 {
+		t.Errorf("Reader got %v, %v", f, err)
+	}
+	rd = NewReader(bytes.NewReader(AppendInt64(nil, 7)))
+	rd.Lenient = true
+	f32, err = rd.ReadFloat32()
+	if err != nil || f32 != 7 {
+		t.Errorf("Reader got %v, %v", f32, err)
+	}
+}
+
+func TestLenientStrings(t *testing.T) {
+	bin := AppendBytes(nil, []byte("hello"))
+	str := AppendString(nil, "hello")
+
+	if _, _, err := ReadStringBytes(bin); err == nil {
+		t.Error("expected an error from strict decoding")
+	}
+	s, _, err := ReadStringBytesLenient(bin)
+	if err != nil || s != "hello" {
+		t.Errorf("got %q, %v", s, err)
+	}
+	b, _, err := ReadBytesBytesLenient(str, nil)
+	if err != nil || string(b) != "hello" {
+		t.Errorf("got %q, %v", b, err)
+	}
+
+	rd := NewReader(bytes.NewReader(append(append([]byte{}, bin...), str...)))
+	rd.Lenient = true
+	s, err = rd.ReadString()
+	if err != nil || s != "hello" {
+		t.Errorf("Reader got %q, %v", s, err)
+	}
+	b, err = rd.ReadBytes(nil)
+	if err != nil || string(b) != "hello" {
+		t.Errorf("Reader got %q, %v", b, err)
+	}
+
+	// An empty string at the end of a stream.
+	rd = NewReader(bytes.NewReader(AppendString(nil, "")))
+	rd.Lenient = true
+	b, err = rd.ReadBytes(nil)
+	if err != nil || len(b) != 0 {
+		t.Errorf("Reader got %q, %v", b, err)
+	}
+}
@@ -0,0 +1,85 @@
+package msgp
+
+// A FieldMask selects the fields of a struct to decode with UnmarshalMsgFields or DecodeMsgFields.
+// The code generator writes these methods for the structs named in a //msgp:fieldmask directive,
+// along with a constant for the bit of each field, named after the type and the field:
+//
+//  //msgp:fieldmask Record
+//
+//  type Record struct {
+//      ID    string `msgp:"id"`
+//      Owner User   `msgp:"owner"`
+//      Body  []byte `msgp:"body"`
+//  }
+//
+//  // Decode the ID and the name of the owner, skipping everything else.
+//  mask := msgp.Fields(RecordFieldID).With(RecordFieldOwner, msgp.Fields(UserFieldName))
+//  _, err := rec.UnmarshalMsgFields(b, mask)
+//
+// The fields that are not selected are skipped and keep the values they had. Only the first 64
+// fields of a struct have bits; the others are always decoded.
+//
+// Nested holds the masks for the structs in the selected fields, whether they are the fields'
+// values or are held in pointers, slices, arrays, or maps. A struct in a field with no nested
+// mask is decoded completely.
+type FieldMask struct {
+	Fields uint64
+	Nested map[uint64]FieldMask
+}
+
+// AllFields selects every field.
+var AllFields = FieldMask{Fields: 1<<64 - 1}
+
+// Fields returns a mask that selects the fields whose bits are set in bits.
+func Fields(bits uint64) FieldMask { return FieldMask{Fields: bits} }
+
+// Has says if the field with the bit is selected.
+func (m FieldMask) Has(bit uint64) bool { return m.Fields&bit != 0 }
+
+// Sub returns the mask for the structs in the field with the bit. If the field has no
+// nested mask, it is AllFields.
+func (m FieldMask) Sub(bit uint64) FieldMask {
+	if n, ok := m.Nested[bit]; ok {
+		return n
+	}
+	return AllFields
+}
+
+// With returns a copy of m that selects the field with the bit and decodes the structs
+// in it with the mask nested.
+func (m FieldMask) With(bit uint64, nested FieldMask) FieldMask {
+	n := make(map[uint64]FieldMask, len(m.Nested)+1)
+	for b, sub := range m.Nested {
+		n[b] = sub
+	}
+	n[bit] = nested
+	return FieldMask{Fields: m.Fields | bit, Nested: n}
+}
+
+// FieldsUnmarshaler is implemented by types that can unmarshal some of their fields.
+type FieldsUnmarshaler interface {
+	UnmarshalMsgFields(b []byte, mask FieldMask) ([]byte, error)
+}
+
+// FieldsDecoder is implemented by types that can decode some of their fields.
+type FieldsDecoder interface {
+	DecodeMsgFields(r *Reader, mask FieldMask) error
+}
+
+// UnmarshalFields unmarshals the fields of u selected by mask if u implements FieldsUnmarshaler.
+// Otherwise it unmarshals all of u.
+func UnmarshalFields(b []byte, u Unmarshaler, mask FieldMask) ([]byte, error) {
+	if fu, ok := u.(FieldsUnmarshaler); ok {
+		return fu.UnmarshalMsgFields(b, mask)
+	}
+	return u.UnmarshalMsg(b)
+}
+
+// DecodeFields decodes the fields of d selected by mask if d implements FieldsDecoder.
+// Otherwise it decodes all of d.
+func DecodeFields(r *Reader, d Decoder, mask FieldMask) error {
+	if fd, ok := d.(FieldsDecoder); ok {
+		return fd.DecodeMsgFields(r, mask)
+	}
+	return d.DecodeMsg(r)
+}
@@ -0,0 +1,46 @@
+package msgp
+
+import "testing"
+
+func TestFieldMask(t *testing.T) {
+	const a, b, c = 1 << 0, 1 << 1, 1 << 2
+	m := Fields(a)
+	inner := Fields(c)
+	n := m.With(b, inner)
+	if !n.Has(a) || !n.Has(b) || n.Has(c) {
+		t.Errorf("n selects %b", n.Fields)
+	}
+	if m.Has(b) || m.Nested != nil {
+		t.Error("With changed its receiver")
+	}
+	if sub := n.Sub(b); sub.Fields != c {
+		t.Errorf("Sub(b) = %b; want %b", sub.Fields, c)
+	}
+	if sub := n.Sub(a); sub.Fields != AllFields.Fields {
+		t.Errorf("Sub(a) = %b; want all fields", sub.Fields)
+	}
+	if o := n.With(c, AllFields); len(n.Nested) != 1 || len(o.Nested) != 2 {
+		t.Error("With shared the nested masks")
+	}
+}
+
+type maskTestObj struct{ fields bool }
+
+func (o *maskTestObj) UnmarshalMsg(b []byte) ([]byte, error) { return Skip(b) }
+
+func (o *maskTestObj) UnmarshalMsgFields(b []byte, _ FieldMask) ([]byte, error) {
+	o.fields = true
+	return Skip(b)
+}
+
+func TestUnmarshalFields(t *testing.T) {
+	b := AppendNil(nil)
+	var o maskTestObj
+	if _, err := UnmarshalFields(b, &o, AllFields); err != nil || !o.fields {
+		t.Errorf("UnmarshalMsgFields was not called (err: %v)", err)
+	}
+	var r Raw
+	if _, err := UnmarshalFields(b, &r, AllFields); err != nil || len(r) != 1 {
+		t.Errorf("UnmarshalMsg gave %x, %v", []byte(r), err)
+	}
+}
@@ -0,0 +1,435 @@
+package msgp
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The operations of a PatchOp.
+const (
+	PatchAdd     = "add"     // add the value at the path, or replace the value of an existing map key
+	PatchRemove  = "remove"  // remove the object at the path
+	PatchReplace = "replace" // replace the object at the path with the value
+	PatchTest    = "test"    // check that the object at the path is equal to the value (as with Equal)
+)
+
+// A PatchOp is an operation of a Patch, as in JSON Patch (RFC 6902).
+//
+// Path is a JSON Pointer (RFC 6901) such as /items/0/name, whose tokens are map keys (which must be
+// strings) and array indexes; the path "" is the whole document. To add to the end of an array,
+// the last token may be the array's length or "-".
+type PatchOp struct {
+	Op    string
+	Path  string
+	Value Raw // the value of add, replace, and test operations
+}
+
+// A Patch is a list of changes to an encoded document, made by Diff and applied by ApplyPatch.
+// It is encoded as an array of maps with the keys "op", "path", and "value", which MarshalJSON
+// converts to a JSON Patch document.
+type Patch []PatchOp
+
+// A PatchError is returned when an operation of a Patch cannot be applied to a document.
+type PatchError struct {
+	Index int    // the index of the operation in the patch
+	Path  string // the path of the operation
+	Msg   string
+}
+
+// Error implements the error interface.
+func (e PatchError) Error() string {
+	return fmt.Sprintf("msgp: patch operation %d at %q: %s", e.Index, e.Path, e.Msg)
+}
+
+// Resumable is always true for PatchErrors.
+func (e PatchError) Resumable() bool { return true }
+
+// Diff returns a patch that changes the first object in old into the first object in new. Objects
+// that are equal as with Equal (with no options) are left as they are. Maps with keys that are not
+// strings are replaced as a whole if they differ, since their keys cannot be written in paths.
+func Diff(old, new []byte) (Patch, error) {
+	o, _, err := nextRaw(old)
+	if err != nil {
+		return nil, err
+	}
+	n, _, err := nextRaw(new)
+	if err != nil {
+		return nil, err
+	}
+	return diffObjects(nil, "", o, n)
+}
+
+func diffObjects(p Patch, path string, old, new Raw) (Patch, error) {
+	if Equal(old, new, nil) {
+		return p, nil
+	}
+	switch {
+	case NextType(old) == MapType && NextType(new) == MapType:
+		oks, ovs, okeys, err := patchMapEntries(old)
+		if err != nil {
+			return p, err
+		}
+		nks, nvs, nkeys, err := patchMapEntries(new)
+		if err != nil {
+			return p, err
+		}
+		if okeys && nkeys {
+			return diffMaps(p, path, oks, ovs, nks, nvs)
+		}
+	case NextType(old) == ArrayType && NextType(new) == ArrayType:
+		return diffArrays(p, path, old, new)
+	}
+	return append(p, PatchOp{Op: PatchReplace, Path: path, Value: new}), nil
+}
+
+// patchMapEntries returns the keys and values of the map m and says if all the keys are strings.
+func patchMapEntries(m Raw) (keys []string, vals []Raw, strKeys bool, err error) {
+	err = eachChild(m, func(_ int, key, val Raw) error {
+		k, _, err := ReadMapKeyZC(key)
+		if err != nil {
+			return nil
+		}
+		keys = append(keys, string(k))
+		vals = append(vals, val)
+		return nil
+	})
+	sz, _, _ := ReadMapHeaderBytes(m)
+	return keys, vals, len(keys) == int(sz), err
+}
+
+func diffMaps(p Patch, path string, oks []string, ovs []Raw, nks []string, nvs []Raw) (Patch, error) {
+	newVals := make(map[string]Raw, len(nks))
+	for i, k := range nks {
+		if _, ok := newVals[k]; !ok {
+			newVals[k] = nvs[i]
+		}
+	}
+	inOld := make(map[string]bool, len(oks))
+	var err error
+	for i, k := range oks {
+		if inOld[k] {
+			continue
+		}
+		inOld[k] = true
+		kpath := path + "/" + escapePointer(k)
+		n, ok := newVals[k]
+		if !ok {
+			p = append(p, PatchOp{Op: PatchRemove, Path: kpath})
+			continue
+		}
+		if p, err = diffObjects(p, kpath, ovs[i], n); err != nil {
+			return p, err
+		}
+	}
+	for _, k := range nks {
+		if !inOld[k] {
+			inOld[k] = true
+			p = append(p, PatchOp{Op: PatchAdd, Path: path + "/" + escapePointer(k), Value: newVals[k]})
+		}
+	}
+	return p, nil
+}
+
+func diffArrays(p Patch, path string, old, new Raw) (Patch, error) {
+	var oes, nes []Raw
+	if err := eachChild(old, func(_ int, _, val Raw) error { oes = append(oes, val); return nil }); err != nil {
+		return p, err
+	}
+	if err := eachChild(new, func(_ int, _, val Raw) error { nes = append(nes, val); return nil }); err != nil {
+		return p, err
+	}
+	var err error
+	for i := 0; i < len(oes) && i < len(nes); i++ {
+		if p, err = diffObjects(p, path+"/"+strconv.Itoa(i), oes[i], nes[i]); err != nil {
+			return p, err
+		}
+	}
+	for i := len(oes); i < len(nes); i++ {
+		p = append(p, PatchOp{Op: PatchAdd, Path: path + "/" + strconv.Itoa(i), Value: nes[i]})
+	}
+	// Elements are removed from the end so that the indexes of the others do not change.
+	for i := len(oes) - 1; i >= len(nes); i-- {
+		p = append(p, PatchOp{Op: PatchRemove, Path: path + "/" + strconv.Itoa(i)})
+	}
+	return p, nil
+}
+
+var pointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+func escapePointer(key string) string { return pointerEscaper.Replace(key) }
+
+var pointerUnescaper = strings.NewReplacer("~1", "/", "~0", "~")
+
+// ApplyPatch applies the operations of the patch in turn to the first object in doc and returns
+// the changed document, which does not share memory with doc. The error is a PatchError if an
+// operation cannot be applied, or an error from decoding doc.
+func ApplyPatch(doc []byte, patch Patch) ([]byte, error) {
+	root, _, err := nextRaw(doc)
+	if err != nil {
+		return nil, err
+	}
+	out := append([]byte(nil), root...)
+	for i := range patch {
+		if out, err = patch[i].apply(out); err != nil {
+			if pe, ok := err.(PatchError); ok {
+				pe.Index = i
+				return nil, pe
+			}
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// patchTarget is the location in a document of the object at a path.
+type patchTarget struct {
+	parent     int  // the offset of the map or array holding the object, or -1 for the root
+	isMap      bool // the parent is a map
+	key        string
+	found      bool // the object exists; otherwise start and end are where an element would go
+	keyStart   int  // the offset of the object's key, if the parent is a map
+	start, end int  // the object
+}
+
+func (op *PatchOp) fail(format string, args ...interface{}) error {
+	return PatchError{Path: op.Path, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (op *PatchOp) apply(doc []byte) ([]byte, error) {
+	t, err := op.locate(doc)
+	if err != nil {
+		return nil, err
+	}
+	val := []byte(op.Value)
+	if len(val) == 0 {
+		val = AppendNil(nil)
+	} else if _, err = Skip(val); err != nil {
+		return nil, op.fail("bad value: %v", err)
+	}
+
+	switch op.Op {
+	case PatchTest:
+		if !t.found || !Equal(doc[t.start:t.end], val, nil) {
+			return nil, op.fail("test failed")
+		}
+		return doc, nil
+	case PatchReplace:
+		if !t.found {
+			return nil, op.fail("no object to replace")
+		}
+		return replace(doc, t.start, t.end, val, false), nil
+	case PatchRemove:
+		if !t.found || t.parent < 0 {
+			return nil, op.fail("no object to remove")
+		}
+		start := t.start
+		if t.isMap {
+			start = t.keyStart
+		}
+		doc = replace(doc, start, t.end, nil, false)
+		return resizeContainer(doc, t.parent, -1)
+	case PatchAdd:
+		if t.found && (t.isMap || t.parent < 0) {
+			return replace(doc, t.start, t.end, val, false), nil
+		}
+		ins := val
+		if t.isMap {
+			ins = append(AppendString(nil, t.key), val...)
+		}
+		doc = replace(doc, t.start, t.start, ins, false)
+		return resizeContainer(doc, t.parent, 1)
+	}
+	return nil, op.fail("unknown operation %q", op.Op)
+}
+
+// locate finds the object at the path of op. If it is missing, its parent must exist, so that
+// it can be added.
+func (op *PatchOp) locate(doc []byte) (patchTarget, error) {
+	t := patchTarget{parent: -1, found: true, end: len(doc)}
+	if op.Path == "" {
+		return t, nil
+	}
+	if op.Path[0] != '/' {
+		return t, op.fail("the path does not start with /")
+	}
+	tokens := strings.Split(op.Path[1:], "/")
+	for i, tok := range tokens {
+		if !t.found {
+			return t, op.fail("no object at %s", strings.Join(tokens[:i], "/"))
+		}
+		tok = pointerUnescaper.Replace(tok)
+		obj := doc[t.start:t.end]
+		next := patchTarget{parent: t.start, key: tok}
+		index := -1
+		switch NextType(obj) {
+		case MapType:
+			next.isMap = true
+		case ArrayType:
+			sz, _, _ := ReadArrayHeaderBytes(obj)
+			if tok == "-" {
+				index = int(sz)
+			} else if n, err := strconv.Atoi(tok); err == nil && n >= 0 && n <= int(sz) && (n == 0 || tok[0] != '0') {
+				index = n
+			} else {
+				return t, op.fail("bad array index %q", tok)
+			}
+		default:
+			return t, op.fail("cannot index a %s", NextType(obj))
+		}
+		// By default, the object would go at the end of its parent.
+		next.start, next.end = t.end, t.end
+		err := eachChild(obj, func(j int, key, val Raw) error {
+			if next.found {
+				return nil
+			}
+			if next.isMap {
+				if k, _, err := ReadMapKeyZC(key); err != nil || string(k) != tok {
+					return nil
+				}
+			} else if j != index {
+				return nil
+			}
+			next.found = true
+			// The children are sub-slices of doc, so their offsets follow from their capacities.
+			next.start = cap(doc) - cap(val)
+			next.end = next.start + len(val)
+			next.keyStart = cap(doc) - cap(key)
+			return nil
+		})
+		if err != nil {
+			return t, err
+		}
+		t = next
+	}
+	return t, nil
+}
+
+// resizeContainer adds delta to the size of the map or array at offset at in doc.
+func resizeContainer(doc []byte, at int, delta int) ([]byte, error) {
+	var hdr []byte
+	var rest []byte
+	if NextType(doc[at:]) == MapType {
+		sz, r, err := ReadMapHeaderBytes(doc[at:])
+		if err != nil {
+			return nil, err
+		}
+		hdr, rest = AppendMapHeader(nil, uint32(int(sz)+delta)), r
+	} else {
+		sz, r, err := ReadArrayHeaderBytes(doc[at:])
+		if err != nil {
+			return nil, err
+		}
+		hdr, rest = AppendArrayHeader(nil, uint32(int(sz)+delta)), r
+	}
+	return replace(doc, at, len(doc)-len(rest), hdr, false), nil
+}
+
+// MarshalMsg implements Marshaler.
+func (p Patch) MarshalMsg(b []byte) ([]byte, error) {
+	b = AppendArrayHeader(b, uint32(len(p)))
+	for i := range p {
+		op := &p[i]
+		hasValue := op.Op != PatchRemove
+		if hasValue {
+			b = AppendMapHeader(b, 3)
+		} else {
+			b = AppendMapHeader(b, 2)
+		}
+		b = AppendString(b, "op")
+		b = AppendString(b, op.Op)
+		b = AppendString(b, "path")
+		b = AppendString(b, op.Path)
+		if hasValue {
+			b = AppendString(b, "value")
+			b, _ = op.Value.MarshalMsg(b)
+		}
+	}
+	return b, nil
+}
+
+// UnmarshalMsg implements Unmarshaler.
+func (p *Patch) UnmarshalMsg(b []byte) ([]byte, error) {
+	sz, b, err := ReadArrayHeaderBytes(b)
+	if err != nil {
+		return b, err
+	}
+	ops := make(Patch, 0, minInt(int(sz), len(b)))
+	for i := uint32(0); i < sz; i++ {
+		var op PatchOp
+		var fields uint32
+		if fields, b, err = ReadMapHeaderBytes(b); err != nil {
+			return b, err
+		}
+		for ; fields > 0; fields-- {
+			var key []byte
+			if key, b, err = ReadMapKeyZC(b); err != nil {
+				return b, err
+			}
+			switch string(key) {
+			case "op":
+				op.Op, b, err = ReadStringBytes(b)
+			case "path":
+				op.Path, b, err = ReadStringBytes(b)
+			case "value":
+				b, err = op.Value.UnmarshalMsg(b)
+			default:
+				b, err = Skip(b)
+			}
+			if err != nil {
+				return b, err
+			}
+		}
+		ops = append(ops, op)
+	}
+	*p = ops
+	return b, nil
+}
+
+// EncodeMsg implements Encoder.
+func (p Patch) EncodeMsg(w *Writer) error {
+	b, _ := p.MarshalMsg(nil)
+	_, err := w.Write(b)
+	return err
+}
+
+// DecodeMsg implements Decoder.
+func (p *Patch) DecodeMsg(r *Reader) error {
+	var raw Raw
+	if err := raw.DecodeMsg(r); err != nil {
+		return err
+	}
+	_, err := p.UnmarshalMsg(raw)
+	return err
+}
+
+// Msgsize implements Sizer.
+func (p Patch) Msgsize() int {
+	s := ArrayHeaderSize
+	for i := range p {
+		s += MapHeaderSize + 3*StringPrefixSize + len("oppathvalue") + len(p[i].Op) + len(p[i].Path) + p[i].Value.Msgsize()
+	}
+	return s
+}
+
+// MarshalJSON renders the patch as a JSON Patch document. It returns an error if a value in
+// the patch cannot be written as JSON, such as a map with keys that are not strings.
+func (p Patch) MarshalJSON() ([]byte, error) {
+	b, err := p.MarshalMsg(nil)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if _, err := UnmarshalAsJSON(&buf, b); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
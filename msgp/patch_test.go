@@ -0,0 +1,136 @@
+package msgp
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func patchTestDoc(t *testing.T, v interface{}) []byte {
+	t.Helper()
+	b, err := AppendIntf(nil, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestDiffApplyPatch(t *testing.T) {
+	tests := []struct {
+		old, new interface{}
+	}{
+		{
+			map[string]interface{}{"a": int64(1), "b": "x", "c": []interface{}{int64(1), int64(2)}},
+			map[string]interface{}{"a": int64(2), "c": []interface{}{int64(1), int64(3), int64(4)}, "d/e~": true},
+		},
+		{
+			map[string]interface{}{"list": []interface{}{"a", "b", "c", "d"}},
+			map[string]interface{}{"list": []interface{}{"a"}, "n": map[string]interface{}{"deep": nil}},
+		},
+		{[]interface{}{"a"}, "not an array"},
+		{"same", "same"},
+	}
+	for i, tt := range tests {
+		old, new := patchTestDoc(t, tt.old), patchTestDoc(t, tt.new)
+		p, err := Diff(old, new)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		got, err := ApplyPatch(old, p)
+		if err != nil {
+			t.Fatalf("%d: applying %v: %v", i, p, err)
+		}
+		if !Equal(got, new, nil) {
+			gv, _, _ := ReadIntfBytes(got)
+			t.Errorf("%d: patched to %v; want %v", i, gv, tt.new)
+		}
+
+		// The patch round-trips through its encoding.
+		b, err := p.MarshalMsg(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var dec Patch
+		if _, err = dec.UnmarshalMsg(b); err != nil {
+			t.Fatal(err)
+		}
+		if len(p) > 0 && !reflect.DeepEqual(dec, p) {
+			t.Errorf("%d: decoded %v; want %v", i, dec, p)
+		}
+	}
+}
+
+func TestApplyPatchOps(t *testing.T) {
+	doc := patchTestDoc(t, map[string]interface{}{"items": []interface{}{"a", "c"}})
+	p := Patch{
+		{Op: PatchAdd, Path: "/items/1", Value: AppendString(nil, "b")},
+		{Op: PatchAdd, Path: "/items/-", Value: AppendString(nil, "d")},
+		{Op: PatchTest, Path: "/items/3", Value: AppendString(nil, "d")},
+		{Op: PatchRemove, Path: "/items/0"},
+		{Op: PatchAdd, Path: "/count", Value: AppendInt(nil, 3)},
+	}
+	got, err := ApplyPatch(doc, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := patchTestDoc(t, map[string]interface{}{"items": []interface{}{"b", "c", "d"}, "count": int64(3)})
+	if !Equal(got, want, nil) {
+		v, _, _ := ReadIntfBytes(got)
+		t.Errorf("got %v", v)
+	}
+
+	bad := []PatchOp{
+		{Op: PatchRemove, Path: "/missing"},
+		{Op: PatchReplace, Path: "/items/5", Value: AppendNil(nil)},
+		{Op: PatchAdd, Path: "/a/b", Value: AppendNil(nil)},
+		{Op: PatchTest, Path: "/items/0", Value: AppendString(nil, "z")},
+		{Op: "move", Path: "/items"},
+		{Op: PatchAdd, Path: "items"},
+	}
+	for _, op := range bad {
+		_, err := ApplyPatch(doc, Patch{{Op: PatchTest, Path: "/items/1", Value: AppendString(nil, "c")}, op})
+		if pe, ok := err.(PatchError); !ok || pe.Index != 1 {
+			t.Errorf("%v: got error %v", op, err)
+		}
+	}
+}
+
+func TestPatchJSON(t *testing.T) {
+	p := Patch{
+		{Op: PatchReplace, Path: "/a", Value: AppendInt(nil, 2)},
+		{Op: PatchRemove, Path: "/b"},
+	}
+	b, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ops []map[string]interface{}
+	if err = json.Unmarshal(b, &ops); err != nil {
+		t.Fatalf("%s: %v", b, err)
+	}
+	want := []map[string]interface{}{
+		{"op": "replace", "path": "/a", "value": float64(2)},
+		{"op": "remove", "path": "/b"},
+	}
+	if !reflect.DeepEqual(ops, want) {
+		t.Errorf("got %s", b)
+	}
+}
+
+func TestPatchJSONNonStringKeys(t *testing.T) {
+	old := AppendInt(AppendInt(AppendMapHeader(nil, 1), 5), 1)
+	new := AppendInt(AppendInt(AppendMapHeader(nil, 1), 5), 2)
+	p, err := Diff(old, new)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p) != 1 || p[0].Op != PatchReplace || p[0].Path != "" {
+		t.Fatalf("got patch %v", p)
+	}
+	if b, err := p.MarshalJSON(); err == nil {
+		t.Errorf("got %s and no error for a map with an integer key", b)
+	}
+	if b, err := json.Marshal(p); err == nil {
+		t.Errorf("json.Marshal gave %s and no error for a map with an integer key", b)
+	}
+}
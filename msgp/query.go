@@ -0,0 +1,542 @@
+package msgp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// A Path is a compiled path expression. See Query for the syntax.
+type Path struct {
+	expr  string
+	steps []pathStep
+}
+
+// A PathError is returned when a path expression cannot be compiled.
+type PathError struct {
+	Expr   string // the expression
+	Offset int    // the byte offset of the error in the expression
+	Msg    string
+}
+
+// Error implements the error interface.
+func (e PathError) Error() string {
+	return fmt.Sprintf("msgp: path %q: %s at offset %d", e.Expr, e.Msg, e.Offset)
+}
+
+// Resumable is always true for PathErrors.
+func (e PathError) Resumable() bool { return true }
+
+// Query returns the objects in the first object in raw that match the path expression expr.
+// The results are sub-slices of raw in the order in which they appear; no data is copied.
+// (Objects matched by several paths, as with $..*..*, are repeated.)
+//
+// The syntax is a subset of JSONPath. An expression starts with $, the object in raw, followed
+// by any of these steps:
+//
+//  .key or ['key']     the value of the map key (the quotes may be single or double)
+//  [n]                 the nth element of an array (counting back from the end if n < 0),
+//                      or the value of the integer map key n
+//  .* or [*]           all of the elements of an array or values of a map
+//  ..key, ..*, ..[…]   the step applied to the object and to all of the objects within it
+//  [?(@.path == lit)]  the elements or values for which the relative path has a value equal
+//                      to lit, which is a quoted string, a number, true, false, or null
+//
+// Filters can also compare with !=, and their paths consist of keys and indexes; @ alone is
+// the element or value itself. For example, $.items[?(@.kind == 'book')].price is the price
+// of each item whose kind is "book", and ..id is every value of an id key. Numbers compare
+// equal if they have the same value, whatever their encoding.
+//
+// The error is a PathError if expr is not valid or an error from decoding raw.
+func Query(raw []byte, expr string) ([]Raw, error) {
+	p, err := CompilePath(expr)
+	if err != nil {
+		return nil, err
+	}
+	return p.Query(raw)
+}
+
+// QueryReader reads the next object from r and returns the objects in it that match the path
+// expression expr, which are sub-slices of a copy of the object. See Query.
+func QueryReader(r *Reader, expr string) ([]Raw, error) {
+	p, err := CompilePath(expr)
+	if err != nil {
+		return nil, err
+	}
+	return p.QueryReader(r)
+}
+
+// CompilePath parses a path expression so that it can be used to query many objects.
+func CompilePath(expr string) (*Path, error) {
+	p := &pathParser{expr: expr}
+	steps, err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+	return &Path{expr: expr, steps: steps}, nil
+}
+
+// String returns the expression that p was compiled from.
+func (p *Path) String() string { return p.expr }
+
+// Query returns the objects in the first object in raw that match p. See the function Query.
+func (p *Path) Query(raw []byte) ([]Raw, error) {
+	rest, err := Skip(raw)
+	if err != nil {
+		return nil, err
+	}
+	nodes := []Raw{Raw(raw[:len(raw)-len(rest)])}
+	for i := range p.steps {
+		var next []Raw
+		for _, n := range nodes {
+			if next, err = p.steps[i].apply(n, next); err != nil {
+				return nil, err
+			}
+		}
+		nodes = next
+	}
+	return nodes, nil
+}
+
+// QueryReader reads the next object from r and returns the objects in it that match p.
+// See the function QueryReader.
+func (p *Path) QueryReader(r *Reader) ([]Raw, error) {
+	var raw Raw
+	if err := raw.DecodeMsg(r); err != nil {
+		return nil, err
+	}
+	return p.Query(raw)
+}
+
+type stepKind uint8
+
+const (
+	stepKey stepKind = iota
+	stepIndex
+	stepWildcard
+	stepFilter
+)
+
+type pathStep struct {
+	kind      stepKind
+	recursive bool // the step is applied to all the objects within as well
+	key       string
+	index     int64
+	filter    *pathFilter
+}
+
+// A pathFilter selects the objects with a value at path that is equal or not equal to a literal.
+type pathFilter struct {
+	path  []pathStep // keys and indexes only
+	equal bool       // the operator is == rather than !=
+	value pathValue
+}
+
+// pathValue is a literal in a filter.
+type pathValue struct {
+	typ Type // StrType, IntType (for all numbers), BoolType, or NilType
+	str string
+	num Number
+	b   bool
+}
+
+// apply appends the objects in n matching the step to out. The objects within them are
+// visited after them if the step is recursive, so the objects are in the order of the data.
+func (s *pathStep) apply(n Raw, out []Raw) ([]Raw, error) {
+	index := s.index
+	if s.kind == stepIndex && index < 0 && NextType(n) == ArrayType {
+		sz, _, err := ReadArrayHeaderBytes(n)
+		if err != nil {
+			return out, err
+		}
+		index += int64(sz)
+	}
+	err := eachChild(n, func(i int, key, val Raw) error {
+		ok, err := s.selects(i, key, val, index)
+		if err != nil {
+			return err
+		}
+		if ok {
+			out = append(out, val)
+		}
+		if s.recursive {
+			out, err = s.apply(val, out)
+		}
+		return err
+	})
+	return out, err
+}
+
+// selects says if the step selects the child val of an object, which is the ith element of
+// an array or the value of the map key. For indexes, index is the index counted from the start.
+func (s *pathStep) selects(i int, key, val Raw, index int64) (bool, error) {
+	switch s.kind {
+	case stepKey:
+		if key == nil {
+			return false, nil
+		}
+		// Keys that are not strings do not match.
+		k, _, err := ReadMapKeyZC(key)
+		return err == nil && string(k) == s.key, nil
+	case stepIndex:
+		if key == nil {
+			return int64(i) == index, nil
+		}
+		if !isNumber(key) {
+			return false, nil
+		}
+		var num Number
+		num.AsInt(index)
+		return numberEqual(key, &num)
+	case stepFilter:
+		return s.filter.test(val)
+	}
+	return true, nil // stepWildcard
+}
+
+// test says if n passes the filter.
+func (f *pathFilter) test(n Raw) (bool, error) {
+	nodes := []Raw{n}
+	for i := range f.path {
+		var next []Raw
+		for _, n := range nodes {
+			var err error
+			if next, err = f.path[i].apply(n, next); err != nil {
+				return false, err
+			}
+		}
+		nodes = next
+	}
+	for _, n := range nodes {
+		eq, err := f.value.equal(n)
+		if err != nil {
+			return false, err
+		}
+		if eq == f.equal {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// equal says if the object n is a scalar equal to v.
+func (v *pathValue) equal(n Raw) (bool, error) {
+	switch NextType(n) {
+	case StrType, BinType:
+		if v.typ != StrType {
+			return false, nil
+		}
+		s, _, err := ReadMapKeyZC(n)
+		return string(s) == v.str, err
+	case IntType, UintType, Float32Type, Float64Type:
+		if v.typ != IntType {
+			return false, nil
+		}
+		return numberEqual(n, &v.num)
+	case BoolType:
+		b, _, err := ReadBoolBytes(n)
+		return v.typ == BoolType && b == v.b, err
+	case NilType:
+		return v.typ == NilType, nil
+	}
+	return false, nil
+}
+
+func isNumber(n Raw) bool {
+	switch NextType(n) {
+	case IntType, UintType, Float32Type, Float64Type:
+		return true
+	}
+	return false
+}
+
+// numberEqual says if the number n has the value of num.
+func numberEqual(n Raw, num *Number) (bool, error) {
+	var a Number
+	if _, err := a.UnmarshalMsg(n); err != nil {
+		return false, err
+	}
+	_, af := a.Float()
+	_, bf := num.Float()
+	if af || bf {
+		return numberAsFloat(&a) == numberAsFloat(num), nil
+	}
+	ai, aInt := a.Int()
+	bi, bInt := num.Int()
+	au, bu := uint64(ai), uint64(bi)
+	switch {
+	case aInt && bInt:
+		return ai == bi, nil
+	case aInt:
+		return ai >= 0 && au == bu, nil
+	case bInt:
+		return bi >= 0 && au == bu, nil
+	}
+	return au == bu, nil
+}
+
+func numberAsFloat(n *Number) float64 {
+	if f, ok := n.Float(); ok {
+		return f
+	}
+	if i, ok := n.Int(); ok {
+		return float64(i)
+	}
+	u, _ := n.Uint()
+	return float64(u)
+}
+
+// eachChild calls fn with the elements of the array or the keys and values of the map n,
+// along with their positions. The key is nil for array elements. Other objects have no
+// children.
+func eachChild(n Raw, fn func(i int, key, val Raw) error) error {
+	var sz uint32
+	var b []byte
+	var err error
+	isMap := false
+	switch NextType(n) {
+	case ArrayType:
+		sz, b, err = ReadArrayHeaderBytes(n)
+	case MapType:
+		sz, b, err = ReadMapHeaderBytes(n)
+		isMap = true
+	default:
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for i := 0; i < int(sz); i++ {
+		var key, val Raw
+		if isMap {
+			if key, b, err = nextRaw(b); err != nil {
+				return err
+			}
+		}
+		if val, b, err = nextRaw(b); err != nil {
+			return err
+		}
+		if err = fn(i, key, val); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nextRaw splits the next object in b from the rest.
+func nextRaw(b []byte) (Raw, []byte, error) {
+	rest, err := Skip(b)
+	if err != nil {
+		return nil, b, err
+	}
+	return Raw(b[:len(b)-len(rest)]), rest, nil
+}
+
+type pathParser struct {
+	expr string
+	pos  int
+}
+
+func (p *pathParser) parse() (steps []pathStep, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			pe, ok := r.(PathError)
+			if !ok {
+				panic(r)
+			}
+			err = pe
+		}
+	}()
+	if p.peek('$') {
+		p.pos++
+	} else if name := p.name(); name != "" {
+		// A leading key may be written without the $.
+		steps = append(steps, pathStep{kind: stepKey, key: name})
+	}
+	for p.pos < len(p.expr) {
+		switch p.expr[p.pos] {
+		case '.':
+			p.pos++
+			recursive := p.peek('.')
+			if recursive {
+				p.pos++
+			}
+			var s pathStep
+			switch {
+			case recursive && p.peek('['):
+				s = p.bracket(true)
+			case p.peek('*'):
+				p.pos++
+				s = pathStep{kind: stepWildcard}
+			default:
+				s = pathStep{kind: stepKey, key: p.name()}
+				if s.key == "" {
+					p.fail("expected a key")
+				}
+			}
+			s.recursive = recursive
+			steps = append(steps, s)
+		case '[':
+			steps = append(steps, p.bracket(true))
+		default:
+			p.fail("unexpected %q", p.expr[p.pos])
+		}
+	}
+	return steps, nil
+}
+
+func (p *pathParser) fail(format string, args ...interface{}) {
+	panic(PathError{Expr: p.expr, Offset: p.pos, Msg: fmt.Sprintf(format, args...)})
+}
+
+func (p *pathParser) peek(c byte) bool {
+	return p.pos < len(p.expr) && p.expr[p.pos] == c
+}
+
+func (p *pathParser) expect(c byte) {
+	p.space()
+	if !p.peek(c) {
+		p.fail("expected %q", c)
+	}
+	p.pos++
+}
+
+func (p *pathParser) space() {
+	for p.peek(' ') || p.peek('\t') {
+		p.pos++
+	}
+}
+
+func isPathNameRune(r rune) bool {
+	return r == '_' || r == '-' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func (p *pathParser) name() string {
+	start := p.pos
+	for p.pos < len(p.expr) {
+		r, size := utf8.DecodeRuneInString(p.expr[p.pos:])
+		if !isPathNameRune(r) {
+			break
+		}
+		p.pos += size
+	}
+	return p.expr[start:p.pos]
+}
+
+// bracket parses a step in brackets. Wildcards and filters are allowed if all is set.
+func (p *pathParser) bracket(all bool) pathStep {
+	p.pos++ // [
+	p.space()
+	var s pathStep
+	switch {
+	case all && p.peek('*'):
+		p.pos++
+		s = pathStep{kind: stepWildcard}
+	case all && p.peek('?'):
+		p.pos++
+		p.expect('(')
+		s = pathStep{kind: stepFilter, filter: p.filter()}
+		p.expect(')')
+	case p.peek('\'') || p.peek('"'):
+		s = pathStep{kind: stepKey, key: p.quoted()}
+	default:
+		start := p.pos
+		if p.peek('-') {
+			p.pos++
+		}
+		for p.pos < len(p.expr) && p.expr[p.pos] >= '0' && p.expr[p.pos] <= '9' {
+			p.pos++
+		}
+		n, err := strconv.ParseInt(p.expr[start:p.pos], 10, 64)
+		if err != nil {
+			p.pos = start
+			p.fail("expected an index, a quoted key, * or a filter")
+		}
+		s = pathStep{kind: stepIndex, index: n}
+	}
+	p.expect(']')
+	return s
+}
+
+func (p *pathParser) filter() *pathFilter {
+	p.expect('@')
+	f := new(pathFilter)
+	for {
+		if p.peek('.') {
+			p.pos++
+			key := p.name()
+			if key == "" {
+				p.fail("expected a key")
+			}
+			f.path = append(f.path, pathStep{kind: stepKey, key: key})
+		} else if p.peek('[') {
+			f.path = append(f.path, p.bracket(false))
+		} else {
+			break
+		}
+	}
+	p.space()
+	switch {
+	case strings.HasPrefix(p.expr[p.pos:], "=="):
+		f.equal = true
+	case strings.HasPrefix(p.expr[p.pos:], "!="):
+	default:
+		p.fail("expected == or !=")
+	}
+	p.pos += 2
+	p.space()
+	f.value = p.literal()
+	return f
+}
+
+func (p *pathParser) quoted() string {
+	quote := p.expr[p.pos]
+	p.pos++
+	var b strings.Builder
+	for p.pos < len(p.expr) {
+		c := p.expr[p.pos]
+		p.pos++
+		switch {
+		case c == quote:
+			return b.String()
+		case c == '\\' && p.pos < len(p.expr):
+			b.WriteByte(p.expr[p.pos])
+			p.pos++
+		default:
+			b.WriteByte(c)
+		}
+	}
+	p.fail("unterminated string")
+	return ""
+}
+
+func (p *pathParser) literal() pathValue {
+	if p.peek('\'') || p.peek('"') {
+		return pathValue{typ: StrType, str: p.quoted()}
+	}
+	start := p.pos
+	for p.pos < len(p.expr) && strings.IndexByte("+-.0123456789eEtrufalsn", p.expr[p.pos]) >= 0 {
+		p.pos++
+	}
+	lit := p.expr[start:p.pos]
+	v := pathValue{typ: IntType}
+	switch lit {
+	case "true", "false":
+		return pathValue{typ: BoolType, b: lit == "true"}
+	case "null":
+		return pathValue{typ: NilType}
+	}
+	if i, err := strconv.ParseInt(lit, 10, 64); err == nil {
+		v.num.AsInt(i)
+	} else if u, err := strconv.ParseUint(lit, 10, 64); err == nil {
+		v.num.AsUint(u)
+	} else if f, err := strconv.ParseFloat(lit, 64); err == nil {
+		v.num.AsFloat64(f)
+	} else {
+		p.pos = start
+		p.fail("expected a string, number, true, false, or null")
+	}
+	return v
+}
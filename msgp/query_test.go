@@ -0,0 +1,118 @@
+package msgp
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// queryTestDoc encodes:
+//  {"store": {"items": [{"kind": "book", "price": 8, "id": 1},
+//                       {"kind": "pen", "price": 1.5, "id": 2},
+//                       {"kind": "book", "price": 12, "id": 3}]},
+//   "id": "root", 7: "seven"}
+func queryTestDoc() []byte {
+	item := func(b []byte, kind string, id int64, appendPrice func([]byte) []byte) []byte {
+		b = AppendMapHeader(b, 3)
+		b = AppendString(b, "kind")
+		b = AppendString(b, kind)
+		b = AppendString(b, "price")
+		b = appendPrice(b)
+		b = AppendString(b, "id")
+		return AppendInt64(b, id)
+	}
+	b := AppendMapHeader(nil, 3)
+	b = AppendString(b, "store")
+	b = AppendMapHeader(b, 1)
+	b = AppendString(b, "items")
+	b = AppendArrayHeader(b, 3)
+	b = item(b, "book", 1, func(b []byte) []byte { return AppendInt(b, 8) })
+	b = item(b, "pen", 2, func(b []byte) []byte { return AppendFloat64(b, 1.5) })
+	b = item(b, "book", 3, func(b []byte) []byte { return AppendUint(b, 12) })
+	b = AppendString(b, "id")
+	b = AppendString(b, "root")
+	b = AppendInt(b, 7)
+	return AppendString(b, "seven")
+}
+
+// queryValues decodes the results of a query.
+func queryValues(t *testing.T, res []Raw) []interface{} {
+	t.Helper()
+	vals := make([]interface{}, len(res))
+	for i, r := range res {
+		v, _, err := ReadIntfBytes(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		vals[i] = v
+	}
+	return vals
+}
+
+func TestQuery(t *testing.T) {
+	doc := queryTestDoc()
+	tests := []struct {
+		expr string
+		want []interface{}
+	}{
+		{"$.id", []interface{}{"root"}},
+		{"id", []interface{}{"root"}},
+		{"$['id']", []interface{}{"root"}},
+		{"$[7]", []interface{}{"seven"}},
+		{"$.store.items[*].price", []interface{}{int64(8), 1.5, int64(12)}},
+		{"$.store.items[1].kind", []interface{}{"pen"}},
+		{"$.store.items[-1].id", []interface{}{int64(3)}},
+		{"$..id", []interface{}{int64(1), int64(2), int64(3), "root"}},
+		{"$..*.kind", []interface{}{"book", "pen", "book"}},
+		{"$.store.items[?(@.kind == 'book')].id", []interface{}{int64(1), int64(3)}},
+		{`$.store.items[?(@.kind != "book")].id`, []interface{}{int64(2)}},
+		{"$.store.items[?(@.price == 12)].id", []interface{}{int64(3)}},
+		{"$.store.items[?(@.price == 1.5)].id", []interface{}{int64(2)}},
+		{"$..items[*].id[?(@ == 2)]", nil},
+		{"$..[?(@ == 'root')]", []interface{}{"root"}},
+		{"$.missing", nil},
+		{"$.id.deeper", nil},
+	}
+	for _, tt := range tests {
+		res, err := Query(doc, tt.expr)
+		if err != nil {
+			t.Errorf("%s: %v", tt.expr, err)
+			continue
+		}
+		if got := queryValues(t, res); !reflect.DeepEqual(got, tt.want) && (len(got) != 0 || len(tt.want) != 0) {
+			t.Errorf("%s = %v; want %v", tt.expr, got, tt.want)
+		}
+	}
+
+	// The results point into the input.
+	res, err := Query(doc, "$.id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i := bytes.Index(doc, res[0]); i < 0 || &doc[i] != &res[0][0] {
+		t.Error("the result was copied")
+	}
+}
+
+func TestQueryReader(t *testing.T) {
+	doc := queryTestDoc()
+	r := NewReader(bytes.NewReader(append(append([]byte{}, doc...), doc...)))
+	for i := 0; i < 2; i++ {
+		res, err := QueryReader(r, "$.store.items[?(@.kind == 'pen')].price")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := queryValues(t, res); !reflect.DeepEqual(got, []interface{}{1.5}) {
+			t.Errorf("got %v", got)
+		}
+	}
+}
+
+func TestCompilePathErrors(t *testing.T) {
+	for _, expr := range []string{"$.", "$[", "$[x]", "$['a", "$.a b", "$[?(@.a = 1)]", "$[?(@.a == nope)]", "$[?(@.a == 1]"} {
+		_, err := CompilePath(expr)
+		if _, ok := err.(PathError); !ok {
+			t.Errorf("CompilePath(%q) returned %v", expr, err)
+		}
+	}
+}
@@ -36,6 +36,11 @@ const (
 	Complex64Type
 	Complex128Type
 	TimeType
+	BigIntType
+	BigFloatType
+	BigRatType
+	IPType
+	UUIDType
 )
 
 // String implements fmt.Stringer
@@ -63,6 +68,22 @@ func (t Type) String() string {
 		return "ext"
 	case NilType:
 		return "nil"
+	case Complex64Type:
+		return "complex64"
+	case Complex128Type:
+		return "complex128"
+	case TimeType:
+		return "time"
+	case BigIntType:
+		return "bigint"
+	case BigFloatType:
+		return "bigfloat"
+	case BigRatType:
+		return "bigrat"
+	case IPType:
+		return "ip"
+	case UUIDType:
+		return "uuid"
 	default:
 		return "<invalid>"
 	}
@@ -101,10 +122,29 @@ func NewReaderSize(r io.Reader, sz int) *Reader {
 // Readers are buffered.
 type Reader struct {
 	// R is the buffered reader used to decode MessagePack. Don't use it directly.
-	R       *fwd.Reader
+	R *fwd.Reader
+
+	// Extensions is the registry used to decode extensions in ReadIntf and when translating
+	// to JSON. If it is nil, DefaultExtensions is used.
+	Extensions *ExtensionRegistry
+
+	// Lenient says to convert between numeric types, and between strings and 'bin' data,
+	// when the type read doesn't match the type on the wire. It applies to everything read
+	// with the Reader, including the fields of types whose DecodeMsg is given the Reader. See
+	// the "Lenient decoding" section of lenient.go for the conversions done.
+	Lenient bool
+
 	scratch []byte
 }
 
+// extensions returns the registry used by the reader.
+func (m *Reader) extensions() *ExtensionRegistry {
+	if m.Extensions != nil {
+		return m.Extensions
+	}
+	return DefaultExtensions
+}
+
 // Read implements io.Reader.
 func (m *Reader) Read(p []byte) (int, error) {
 	return m.R.Read(p)
@@ -187,14 +227,7 @@ func (m *Reader) NextType() (Type, error) {
 		if err != nil {
 			return InvalidType, err
 		}
-		switch v {
-		case Complex64Extension:
-			return Complex64Type, nil
-		case Complex128Extension:
-			return Complex128Type, nil
-		case TimeExtension:
-			return TimeType, nil
-		}
+		return builtinExtType(v), nil
 	}
 	return t, nil
 }
@@ -428,6 +461,9 @@ func (m *Reader) ReadFloat64() (float64, error) {
 			ef, err := m.ReadFloat32()
 			return float64(ef), err
 		}
+		if err == io.EOF && m.Lenient && len(p) > 0 {
+			return m.readFloatLenient(64)
+		}
 		return 0, err
 	}
 	if p[0] != mfloat64 {
@@ -435,6 +471,9 @@ func (m *Reader) ReadFloat64() (float64, error) {
 			ef, err := m.ReadFloat32()
 			return float64(ef), err
 		}
+		if m.Lenient {
+			return m.readFloatLenient(64)
+		}
 		return 0, badPrefix(Float64Type, p[0])
 	}
 	_, err = m.R.Skip(9)
@@ -445,9 +484,17 @@ func (m *Reader) ReadFloat64() (float64, error) {
 func (m *Reader) ReadFloat32() (float32, error) {
 	p, err := m.R.Peek(5)
 	if err != nil {
+		if err == io.EOF && m.Lenient && len(p) > 0 {
+			f, err := m.readFloatLenient(32)
+			return float32(f), err
+		}
 		return 0, err
 	}
 	if p[0] != mfloat32 {
+		if m.Lenient {
+			f, err := m.readFloatLenient(32)
+			return float32(f), err
+		}
 		return 0, badPrefix(Float32Type, p[0])
 	}
 	_, err = m.R.Skip(5)
@@ -544,6 +591,9 @@ func (m *Reader) ReadInt64() (int64, error) {
 		return int64(num), nil
 	}
 
+	if m.Lenient {
+		return m.readInt64Lenient()
+	}
 	return 0, badPrefix(IntType, lead)
 
 }
@@ -628,6 +678,9 @@ func (m *Reader) ReadUint64() (uint64, error) {
 		}
 		return getMuint64(p), nil
 	default:
+		if m.Lenient {
+			return m.readUint64Lenient()
+		}
 		return 0, badPrefix(UintType, lead)
 	}
 
@@ -684,6 +737,9 @@ func (m *Reader) ReadByte() (byte, error) {
 // The scratch slice will be used for storage if it is not nil and large enough.
 func (m *Reader) ReadBytes(scratch []byte) ([]byte, error) {
 	p, err := m.R.Peek(2)
+	if m.isLenientType(p, StrType) {
+		return m.ReadStringAsBytes(scratch)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -826,6 +882,9 @@ func (m *Reader) ReadStringAsBytes(scratch []byte) ([]byte, error) {
 			}
 			read = int64(big.Uint32(p[1:]))
 		default:
+			if m.isLenientType(p, BinType) {
+				return m.ReadBytes(scratch)
+			}
 			return scratch, badPrefix(StrType, lead)
 		}
 	}
@@ -920,6 +979,10 @@ func (m *Reader) ReadString() (string, error) {
 			}
 			read = big.Uint32(p[1:])
 		default:
+			if m.isLenientType(p, BinType) {
+				b, err := m.ReadBytes(nil)
+				return string(b), err
+			}
 			return "", badPrefix(StrType, lead)
 		}
 	}
@@ -1036,12 +1099,22 @@ func (m *Reader) ReadIntf() (interface{}, error) {
 		return m.ReadComplex128()
 	case TimeType:
 		return m.ReadTime()
+	case BigIntType:
+		return m.ReadBigInt()
+	case BigFloatType:
+		return m.ReadBigFloat()
+	case BigRatType:
+		return m.ReadBigRat()
+	case IPType:
+		return m.ReadIP()
+	case UUIDType:
+		return m.ReadUUID()
 	case ExtensionType:
 		tt, err := m.peekExtensionType()
 		if err != nil {
 			return nil, err
 		}
-		f, ok := extensionReg[tt]
+		f, ok := m.extensions().Lookup(tt)
 		if ok {
 			e := f()
 			err = m.ReadExtension(e)
@@ -17,23 +17,14 @@ func NextType(b []byte) Type {
 	}
 	spec := sizes[b[0]]
 	t := spec.typ
-	if t == ExtensionType && len(b) > int(spec.size) {
+	if t == ExtensionType && len(b) >= int(spec.size) {
 		var tp int8
 		if spec.extra == constsize {
 			tp = int8(b[1])
 		} else {
 			tp = int8(b[spec.size-1])
 		}
-		switch tp {
-		case TimeExtension:
-			return TimeType
-		case Complex128Extension:
-			return Complex128Type
-		case Complex64Extension:
-			return Complex64Type
-		default:
-			return ExtensionType
-		}
+		return builtinExtType(tp)
 	}
 	return t
 }
@@ -294,7 +285,7 @@ func ReadInt64Bytes(b []byte) (int64, []byte, error) {
 		if lead == mint32 {
 			return int64(getMint32(b)), b[5:], nil
 		}
-		return int64(getMint32(b)), b[5:], nil
+		return int64(getMuint32(b)), b[5:], nil
 	case mint64, muint64:
 		if l < 9 {
 			return 0, b, ErrShortBytes
@@ -710,6 +701,10 @@ func ReadTimeBytes(b []byte) (time.Time, []byte, error) {
 // ReadMapStrIntfBytes reads a map[string]interface{} out of b and returns the map and any remaining bytes.
 // If map old is not nil, it will be cleared and used so that a map does not need to be created.
 func ReadMapStrIntfBytes(b []byte, old map[string]interface{}) (map[string]interface{}, []byte, error) {
+	return readMapStrIntfBytes(b, old, DefaultExtensions)
+}
+
+func readMapStrIntfBytes(b []byte, old map[string]interface{}, reg *ExtensionRegistry) (map[string]interface{}, []byte, error) {
 
 	sz, o, err := ReadMapHeaderBytes(b)
 	if err != nil {
@@ -734,7 +729,7 @@ func ReadMapStrIntfBytes(b []byte, old map[string]interface{}) (map[string]inter
 			return old, o, err
 		}
 		var val interface{}
-		val, o, err = ReadIntfBytes(o)
+		val, o, err = readIntfBytes(o, reg)
 		if err != nil {
 			return old, o, err
 		}
@@ -746,7 +741,17 @@ func ReadMapStrIntfBytes(b []byte, old map[string]interface{}) (map[string]inter
 }
 
 // ReadIntfBytes reads the next object out of b as a raw interface{} and returns any remaining bytes.
+// Extensions are decoded using DefaultExtensions.
 func ReadIntfBytes(b []byte) (interface{}, []byte, error) {
+	return readIntfBytes(b, DefaultExtensions)
+}
+
+// ReadIntfBytes is like the ReadIntfBytes function but decodes extensions using the registry r.
+func (r *ExtensionRegistry) ReadIntfBytes(b []byte) (interface{}, []byte, error) {
+	return readIntfBytes(b, r)
+}
+
+func readIntfBytes(b []byte, reg *ExtensionRegistry) (interface{}, []byte, error) {
 
 	if len(b) < 1 {
 		return nil, b, ErrShortBytes
@@ -756,7 +761,7 @@ func ReadIntfBytes(b []byte) (interface{}, []byte, error) {
 
 	switch k {
 	case MapType:
-		return ReadMapStrIntfBytes(b, nil)
+		return readMapStrIntfBytes(b, nil, reg)
 	case ArrayType:
 		sz, o, err := ReadArrayHeaderBytes(b)
 		if err != nil {
@@ -764,7 +769,7 @@ func ReadIntfBytes(b []byte) (interface{}, []byte, error) {
 		}
 		i := make([]interface{}, int(sz))
 		for d := range i {
-			i[d], o, err = ReadIntfBytes(o)
+			i[d], o, err = readIntfBytes(o, reg)
 			if err != nil {
 				return i, o, err
 			}
@@ -786,13 +791,23 @@ func ReadIntfBytes(b []byte) (interface{}, []byte, error) {
 		return ReadComplex64Bytes(b)
 	case Complex128Type:
 		return ReadComplex128Bytes(b)
+	case BigIntType:
+		return ReadBigIntBytes(b)
+	case BigFloatType:
+		return ReadBigFloatBytes(b)
+	case BigRatType:
+		return ReadBigRatBytes(b)
+	case IPType:
+		return ReadIPBytes(b)
+	case UUIDType:
+		return ReadUUIDBytes(b)
 	case ExtensionType:
 		t, err := peekExtension(b)
 		if err != nil {
 			return nil, b, err
 		}
 		// Use a user-defined extension if it's been registered.
-		f, ok := extensionReg[t]
+		f, ok := reg.Lookup(t)
 		if ok {
 			e := f()
 			o, err := ReadExtensionBytes(b, e)
@@ -0,0 +1,135 @@
+package recfile
+
+import (
+	"encoding/binary"
+	"io"
+	"sort"
+)
+
+// A Reader reads the records of a record file at random. Its methods may be called concurrently
+// if those of the underlying io.ReaderAt may.
+type Reader struct {
+	r       io.ReaderAt
+	offsets []int64 // the offsets of the records
+	end     int64   // the offset of the end of the last record
+	keys    map[string]int64
+}
+
+// Open reads the header and the footer of the record file of the given size in r and returns a
+// Reader of its records. It returns ErrNoIndex if the file has no footer and ErrBadIndex if the
+// footer is corrupt.
+func Open(r io.ReaderAt, size int64) (*Reader, error) {
+	if err := checkHeader(r, size); err != nil {
+		return nil, err
+	}
+	if size < int64(headerSize+trailerSize) {
+		return nil, ErrNoIndex
+	}
+	var t [trailerSize]byte
+	if _, err := r.ReadAt(t[:], size-trailerSize); err != nil {
+		return nil, err
+	}
+	if string(t[8:]) != trailerMagic {
+		return nil, ErrNoIndex
+	}
+	end := int64(binary.BigEndian.Uint64(t[:8]))
+	if end < int64(headerSize) || end+6 > size-trailerSize {
+		return nil, ErrBadIndex
+	}
+	index := make([]byte, size-trailerSize-end)
+	if _, err := r.ReadAt(index, end); err != nil {
+		return nil, err
+	}
+	if index[0] != 0xc9 || !isIndex(index) || int64(binary.BigEndian.Uint32(index[1:]))+6 != int64(len(index)) {
+		return nil, ErrBadIndex
+	}
+	offsets, keys, err := readIndex(index[6:])
+	if err != nil {
+		return nil, ErrBadIndex
+	}
+	for i, off := range offsets {
+		if off < int64(headerSize) || off >= end || i > 0 && off <= offsets[i-1] {
+			return nil, ErrBadIndex
+		}
+	}
+	return &Reader{r: r, offsets: offsets, end: end, keys: keys}, nil
+}
+
+// checkHeader says if the file of the given size in r starts with the header of a record file.
+func checkHeader(r io.ReaderAt, size int64) error {
+	if size < int64(headerSize) {
+		return ErrNotRecfile
+	}
+	var h [headerSize]byte
+	if _, err := r.ReadAt(h[:], 0); err != nil {
+		return err
+	}
+	if string(h[:]) != fileMagic {
+		return ErrNotRecfile
+	}
+	return nil
+}
+
+// Len returns the number of records.
+func (r *Reader) Len() int { return len(r.offsets) }
+
+// bounds returns the offsets of the start and the end of record i.
+func (r *Reader) bounds(i int) (int64, int64) {
+	if i+1 < len(r.offsets) {
+		return r.offsets[i], r.offsets[i+1]
+	}
+	return r.offsets[i], r.end
+}
+
+// Get returns record i. It panics if i is out of range.
+func (r *Reader) Get(i int) ([]byte, error) {
+	start, end := r.bounds(i)
+	rec := make([]byte, end-start)
+	_, err := r.r.ReadAt(rec, start)
+	return rec, err
+}
+
+// Lookup returns the record with key, or ErrNotFound.
+func (r *Reader) Lookup(key string) ([]byte, error) {
+	i, ok := r.Index(key)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return r.Get(i)
+}
+
+// Index returns the number of the record with key and says if there is one.
+func (r *Reader) Index(key string) (int, bool) {
+	off, ok := r.keys[key]
+	if !ok {
+		return 0, false
+	}
+	i := sort.Search(len(r.offsets), func(i int) bool { return r.offsets[i] >= off })
+	return i, i < len(r.offsets) && r.offsets[i] == off
+}
+
+// Range calls fn with the records from number from up to but not including number to, in order,
+// reading them with one read. It stops at the first error that fn returns and returns it. The
+// slice passed to fn is valid only until fn returns. ErrRange is returned if from is negative,
+// to is greater than Len, or from is greater than to.
+func (r *Reader) Range(from, to int, fn func(i int, rec []byte) error) error {
+	if from < 0 || to > len(r.offsets) || from > to {
+		return ErrRange
+	}
+	if from == to {
+		return nil
+	}
+	start, _ := r.bounds(from)
+	_, end := r.bounds(to - 1)
+	buf := make([]byte, end-start)
+	if _, err := r.r.ReadAt(buf, start); err != nil {
+		return err
+	}
+	for i := from; i < to; i++ {
+		s, e := r.bounds(i)
+		if err := fn(i, buf[s-start:e-start]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
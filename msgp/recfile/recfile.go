@@ -0,0 +1,231 @@
+// Package recfile stores MessagePack records in files that can be read at random.
+//
+// A record file is a header, the records one after the other, and a footer:
+//
+//  "MSGPREC\x01" record record ... index offset "MSGPIDX\x01"
+//
+// Each record is a single MessagePack object, so the records can also be scanned with
+// msgp.Reader.Skip. The index is an extension of type IndexExtension that holds the offsets of
+// the records and the offsets of the records with keys, and it is followed by its own offset as
+// a big-endian uint64 and a magic string. A Writer writes the footer when it is closed.
+//
+// A file that was not closed, say because the program crashed, has no footer and may end with a
+// partial record. Recover truncates the partial record, rebuilds the index by skipping over the
+// records, and returns a Writer that appends to the file.
+package recfile
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"sort"
+
+	"github.com/dchenk/msgp/msgp"
+)
+
+// IndexExtension is the extension type of the index of a record file. Records may not be
+// extensions of this type.
+const IndexExtension = 127
+
+const (
+	fileMagic    = "MSGPREC\x01"
+	trailerMagic = "MSGPIDX\x01"
+	headerSize   = 8  // the file magic
+	trailerSize  = 16 // the offset of the index and the trailer magic
+)
+
+var (
+	// ErrNotRecfile is returned when a file does not start with the header of a record file.
+	ErrNotRecfile = errors.New("recfile: not a record file")
+
+	// ErrNoIndex is returned by Open when a file has no footer. Such a file was not closed
+	// and must be recovered with Recover.
+	ErrNoIndex = errors.New("recfile: no index (the file must be recovered)")
+
+	// ErrBadIndex is returned by Open when the footer of a file is corrupt. Such a file must be
+	// recovered with Recover, which rebuilds the index.
+	ErrBadIndex = errors.New("recfile: corrupt index (the file must be recovered)")
+
+	// ErrRange is returned by Range when the record numbers are out of range.
+	ErrRange = errors.New("recfile: record numbers out of range")
+
+	// ErrNotFound is returned when no record has a key.
+	ErrNotFound = errors.New("recfile: key not found")
+
+	// ErrClosed is returned when appending to a closed Writer.
+	ErrClosed = errors.New("recfile: writer closed")
+
+	// ErrBadRecord is returned when appending a record that is not a single MessagePack object
+	// or is an extension of type IndexExtension.
+	ErrBadRecord = errors.New("recfile: record is not a single object of a permitted type")
+)
+
+// A Writer appends records to a record file.
+type Writer struct {
+	w       io.Writer
+	off     int64   // the offset of the end of the file
+	offsets []int64 // the offsets of the records
+	keys    map[string]int64
+	err     error
+}
+
+// NewWriter writes the header of a record file to w, which must be at the start of the file,
+// and returns a Writer that appends records to it.
+func NewWriter(w io.Writer) (*Writer, error) {
+	if _, err := io.WriteString(w, fileMagic); err != nil {
+		return nil, err
+	}
+	return &Writer{w: w, off: int64(headerSize), keys: make(map[string]int64)}, nil
+}
+
+// Len returns the number of records in the file.
+func (w *Writer) Len() int { return len(w.offsets) }
+
+// Append appends the record rec, which must be a single MessagePack object, and returns its
+// number. The first record is number 0.
+func (w *Writer) Append(rec []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	if !validRecord(rec) {
+		return 0, ErrBadRecord
+	}
+	n, err := w.w.Write(rec)
+	if err != nil {
+		// The file now ends with a partial record; only Recover can repair it.
+		w.err = err
+		return 0, err
+	}
+	w.offsets = append(w.offsets, w.off)
+	w.off += int64(n)
+	return len(w.offsets) - 1, nil
+}
+
+// AppendKeyed appends the record rec as Append does and indexes it under key. If another record
+// has the same key, the key refers to the new record from now on.
+func (w *Writer) AppendKeyed(key string, rec []byte) (int, error) {
+	i, err := w.Append(rec)
+	if err == nil {
+		w.keys[key] = w.offsets[i]
+	}
+	return i, err
+}
+
+// Close writes the footer of the file. It does not close the underlying writer.
+func (w *Writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	b := appendIndex(nil, w.offsets, w.keys)
+	var off [8]byte
+	binary.BigEndian.PutUint64(off[:], uint64(w.off))
+	b = append(b, off[:]...)
+	b = append(b, trailerMagic...)
+	_, err := w.w.Write(b)
+	w.err = ErrClosed
+	return err
+}
+
+// validRecord says if rec is a single object that is not an extension of type IndexExtension.
+func validRecord(rec []byte) bool {
+	rest, err := msgp.Skip(rec)
+	return err == nil && len(rest) == 0 && !isIndex(rec)
+}
+
+// isIndex says if b starts with an extension of type IndexExtension.
+func isIndex(b []byte) bool {
+	if len(b) < 2 {
+		return false
+	}
+	i := 1 // the index of the type, after the prefix and the size
+	switch b[0] {
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8: // fixext
+	case 0xc7: // ext8
+		i = 2
+	case 0xc8: // ext16
+		i = 3
+	case 0xc9: // ext32
+		i = 5
+	default:
+		return false
+	}
+	return len(b) > i && int8(b[i]) == IndexExtension
+}
+
+// appendIndex appends the index extension, which is always written with an ext32 header so that
+// the size of the header is known. The keys are written in order, so the same records always
+// give the same index.
+func appendIndex(b []byte, offsets []int64, keys map[string]int64) []byte {
+	start := len(b)
+	b = append(b, 0xc9, 0, 0, 0, 0, IndexExtension)
+	b = msgp.AppendMapHeader(b, 2)
+	b = msgp.AppendString(b, "offsets")
+	b = msgp.AppendArrayHeader(b, uint32(len(offsets)))
+	for _, off := range offsets {
+		b = msgp.AppendInt64(b, off)
+	}
+	b = msgp.AppendString(b, "keys")
+	b = msgp.AppendMapHeader(b, uint32(len(keys)))
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+	for _, k := range sorted {
+		b = msgp.AppendString(b, k)
+		b = msgp.AppendInt64(b, keys[k])
+	}
+	binary.BigEndian.PutUint32(b[start+1:], uint32(len(b)-start-6))
+	return b
+}
+
+// readIndex reads the data of the index extension.
+func readIndex(data []byte) (offsets []int64, keys map[string]int64, err error) {
+	sz, data, err := msgp.ReadMapHeaderBytes(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	keys = make(map[string]int64)
+	for i := uint32(0); i < sz; i++ {
+		var field []byte
+		if field, data, err = msgp.ReadMapKeyZC(data); err != nil {
+			return nil, nil, err
+		}
+		var n uint32
+		switch string(field) {
+		case "offsets":
+			if n, data, err = msgp.ReadArrayHeaderBytes(data); err != nil {
+				return nil, nil, err
+			}
+			if int(n) > len(data) {
+				return nil, nil, msgp.ErrShortBytes
+			}
+			offsets = make([]int64, n)
+			for j := range offsets {
+				if offsets[j], data, err = msgp.ReadInt64Bytes(data); err != nil {
+					return nil, nil, err
+				}
+			}
+		case "keys":
+			if n, data, err = msgp.ReadMapHeaderBytes(data); err != nil {
+				return nil, nil, err
+			}
+			for j := uint32(0); j < n; j++ {
+				var k string
+				var off int64
+				if k, data, err = msgp.ReadStringBytes(data); err != nil {
+					return nil, nil, err
+				}
+				if off, data, err = msgp.ReadInt64Bytes(data); err != nil {
+					return nil, nil, err
+				}
+				keys[k] = off
+			}
+		default:
+			if data, err = msgp.Skip(data); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	return offsets, keys, nil
+}
@@ -0,0 +1,325 @@
+package recfile
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dchenk/msgp/msgp"
+)
+
+// record returns a record that is a map with the key "id" holding i.
+func record(i int) []byte {
+	b := msgp.AppendMapHeader(nil, 2)
+	b = msgp.AppendString(b, "id")
+	b = msgp.AppendInt(b, i)
+	b = msgp.AppendString(b, "name")
+	return msgp.AppendString(b, fmt.Sprintf("record %d", i))
+}
+
+func recordKey(rec []byte) (string, bool) {
+	i, _, err := msgp.ReadIntBytes(msgp.Locate("id", rec))
+	return fmt.Sprint(i), err == nil && i%2 == 0
+}
+
+func TestWriteRead(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		if i%2 == 0 {
+			_, err = w.AppendKeyed(fmt.Sprint(i), record(i))
+		} else {
+			_, err = w.Append(record(i))
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err = w.Append([]byte{0x92, 0x01}); err != ErrBadRecord {
+		t.Errorf("got error %v for a partial record; want ErrBadRecord", err)
+	}
+	if _, err = w.Append(append(record(0), record(1)...)); err != ErrBadRecord {
+		t.Errorf("got error %v for two records; want ErrBadRecord", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.Append(record(100)); err != ErrClosed {
+		t.Errorf("got error %v after Close; want ErrClosed", err)
+	}
+
+	r, err := Open(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRecords(t, r, 100, true)
+
+	if _, err = Open(bytes.NewReader(buf.Bytes()[:buf.Len()-1]), int64(buf.Len()-1)); err != ErrNoIndex {
+		t.Errorf("got error %v without a footer; want ErrNoIndex", err)
+	}
+	if _, err = Open(bytes.NewReader([]byte("not a record file")), 17); err != ErrNotRecfile {
+		t.Errorf("got error %v for another file; want ErrNotRecfile", err)
+	}
+
+	// The same records and keys always give the same index.
+	var again bytes.Buffer
+	if w, err = NewWriter(&again); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		if i%2 == 0 {
+			_, err = w.AppendKeyed(fmt.Sprint(i), record(i))
+		} else {
+			_, err = w.Append(record(i))
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(again.Bytes(), buf.Bytes()) {
+		t.Error("the same records were written differently")
+	}
+}
+
+// checkRecords checks that r has records 0 to n-1, and the keys of the even ones if keyed is set.
+func checkRecords(t *testing.T, r *Reader, n int, keyed bool) {
+	t.Helper()
+	if r.Len() != n {
+		t.Fatalf("got %d records; want %d", r.Len(), n)
+	}
+	for i := 0; i < n; i++ {
+		rec, err := r.Get(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(rec, record(i)) {
+			t.Errorf("record %d is % x; want % x", i, rec, record(i))
+		}
+	}
+	for i := 0; i < n && keyed; i += 2 {
+		rec, err := r.Lookup(fmt.Sprint(i))
+		if err != nil {
+			t.Fatalf("key %d: %v", i, err)
+		}
+		if !bytes.Equal(rec, record(i)) {
+			t.Errorf("key %d has record % x; want % x", i, rec, record(i))
+		}
+	}
+	if _, err := r.Lookup("1"); err != ErrNotFound {
+		t.Errorf("got error %v for a missing key; want ErrNotFound", err)
+	}
+	var seen []int
+	err := r.Range(n/2, n, func(i int, rec []byte) error {
+		if !bytes.Equal(rec, record(i)) {
+			t.Errorf("record %d in range is % x", i, rec)
+		}
+		seen = append(seen, i)
+		return nil
+	})
+	if err != nil || len(seen) != n-n/2 {
+		t.Errorf("ranged over %v with error %v", seen, err)
+	}
+	for _, b := range [][2]int{{-1, n}, {0, n + 1}, {n, n / 2}} {
+		if err = r.Range(b[0], b[1], func(int, []byte) error { return nil }); err != ErrRange {
+			t.Errorf("got error %v ranging from %d to %d; want ErrRange", err, b[0], b[1])
+		}
+	}
+}
+
+func TestRecover(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "records")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// Write records without closing, then part of another record.
+	w, err := NewWriter(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if _, err = w.AppendKeyed(fmt.Sprint(i), record(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	partial := record(10)[:5]
+	if _, err = f.Write(partial); err != nil {
+		t.Fatal(err)
+	}
+
+	size := func() int64 {
+		fi, err := f.Stat()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fi.Size()
+	}
+	w, cut, err := Recover(f, size(), recordKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cut != int64(len(partial)) || w.Len() != 10 {
+		t.Fatalf("truncated %d bytes leaving %d records; want %d bytes and 10 records", cut, w.Len(), len(partial))
+	}
+	for i := 10; i < 20; i++ {
+		if i%2 == 0 {
+			_, err = w.AppendKeyed(fmt.Sprint(i), record(i))
+		} else {
+			_, err = w.Append(record(i))
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := Open(f, size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRecords(t, r, 20, true)
+
+	// A closed file is reopened for appending, keeping its keys.
+	if w, _, err = Recover(f, size(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.Append(record(20)); err != nil {
+		t.Fatal(err)
+	}
+	// A crash while writing the footer leaves part of the index, which is truncated.
+	var footer bytes.Buffer
+	w.w = &footer
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = f.Write(footer.Bytes()[:footer.Len()/2]); err != nil {
+		t.Fatal(err)
+	}
+	if w, cut, err = Recover(f, size(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if cut != int64(footer.Len()/2) || w.Len() != 21 {
+		t.Fatalf("truncated %d bytes leaving %d records; want %d bytes and 21 records", cut, w.Len(), footer.Len()/2)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if r, err = Open(f, size()); err != nil {
+		t.Fatal(err)
+	}
+	checkRecords(t, r, 21, false)
+}
+
+// failingFile is a File whose long reads fail past limit, as if the disk failed. The short
+// reads of the header and the trailer are not affected.
+type failingFile struct {
+	*os.File
+	limit int64
+}
+
+var errDisk = errors.New("disk error")
+
+func (f failingFile) ReadAt(p []byte, off int64) (int, error) {
+	if len(p) > trailerSize && off+int64(len(p)) > f.limit {
+		n := 0
+		if off < f.limit {
+			n, _ = f.File.ReadAt(p[:f.limit-off], off)
+		}
+		return n, errDisk
+	}
+	return f.File.ReadAt(p, off)
+}
+
+func TestRecoverReadError(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "records"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w, err := NewWriter(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if _, err = w.Append(record(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	size := int64(headerSize + 10*len(record(0)))
+	if _, _, err = Recover(failingFile{File: f, limit: size / 2}, size, nil); err != errDisk {
+		t.Fatalf("got error %v; want the read error", err)
+	}
+	if fi, err := f.Stat(); err != nil || fi.Size() != size {
+		t.Fatalf("file truncated after a read error")
+	}
+	if w, _, err = Recover(f, size, nil); err != nil || w.Len() != 10 {
+		t.Fatalf("recovered %d records with error %v after a read error; want 10", w.Len(), err)
+	}
+}
+
+func TestRecoverBadIndex(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "records"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w, err := NewWriter(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i += 2 {
+		if _, err = w.AppendKeyed(fmt.Sprint(i), record(i)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = w.Append(record(i + 1)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	end := w.off
+	fi, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := fi.Size()
+
+	// Corrupt the map header of the index, leaving the trailer intact.
+	if _, err = f.WriteAt([]byte{0xc1}, end+6); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = Open(f, size); err != ErrBadIndex {
+		t.Fatalf("got error %v for a corrupt index; want ErrBadIndex", err)
+	}
+	w, cut, err := Recover(f, size, recordKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cut != size-end || w.Len() != 10 {
+		t.Fatalf("truncated %d bytes leaving %d records; want %d bytes and 10 records", cut, w.Len(), size-end)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err = f.Stat(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := Open(f, fi.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRecords(t, r, 10, true)
+}
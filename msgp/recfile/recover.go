@@ -0,0 +1,114 @@
+package recfile
+
+import (
+	"io"
+
+	"github.com/dchenk/msgp/msgp"
+)
+
+// A File is a record file that Recover can repair and append to. An *os.File is a File.
+type File interface {
+	io.ReaderAt
+	io.Writer
+	io.Seeker
+	Truncate(size int64) error
+}
+
+// A KeyFunc returns the key of a record and says if it has one. Recover uses it to rebuild the
+// keys of the index, which are kept only in the footer.
+type KeyFunc func(rec []byte) (string, bool)
+
+// Recover opens the record file f of the given size for appending and returns a Writer that
+// appends to it, along with the number of bytes truncated from the end of the file.
+//
+// If the file has a footer, the footer is read and truncated, and Closing the Writer writes a
+// new one. Otherwise, or if the footer is corrupt, Recover skips over the records from the start
+// of the file, as far as they are complete objects, and truncates whatever follows them: a
+// partial record or an index that was not completely written. The keys of the records are then
+// recovered with key, or lost if key is nil. An empty file, or one with only part of the header,
+// gets a new header. If the file cannot be read, Recover returns the error and truncates nothing.
+func Recover(f File, size int64, key KeyFunc) (*Writer, int64, error) {
+	w := &Writer{w: f, keys: make(map[string]int64)}
+	if size < int64(headerSize) {
+		h := make([]byte, size)
+		if _, err := f.ReadAt(h, 0); err != nil {
+			return nil, 0, err
+		}
+		if string(h) != fileMagic[:size] {
+			return nil, 0, ErrNotRecfile
+		}
+		if err := truncate(f, 0); err != nil {
+			return nil, 0, err
+		}
+		if _, err := io.WriteString(f, fileMagic); err != nil {
+			return nil, 0, err
+		}
+		w.off = int64(headerSize)
+		return w, size, nil
+	}
+
+	if r, err := Open(f, size); err == nil {
+		w.offsets, w.keys, w.off = r.offsets, r.keys, r.end
+		return w, size - r.end, truncate(f, r.end)
+	} else if err != ErrNoIndex && err != ErrBadIndex {
+		return nil, 0, err
+	}
+
+	w.off = int64(headerSize)
+	cr := &countReader{r: io.NewSectionReader(f, w.off, size-w.off)}
+	mr := msgp.NewReader(cr)
+	for w.off < size {
+		if p, err := mr.R.Peek(6); err == nil && isIndex(p) {
+			break
+		}
+		if err := mr.Skip(); err != nil {
+			if !partialRecord(err) {
+				return nil, 0, err
+			}
+			break
+		}
+		end := int64(headerSize) + cr.n - int64(mr.Buffered())
+		w.offsets = append(w.offsets, w.off)
+		if key != nil {
+			rec := make([]byte, end-w.off)
+			if _, err := f.ReadAt(rec, w.off); err != nil {
+				return nil, 0, err
+			}
+			if k, ok := key(rec); ok {
+				w.keys[k] = w.off
+			}
+		}
+		w.off = end
+	}
+	return w, size - w.off, truncate(f, w.off)
+}
+
+// partialRecord says if err, returned while skipping over a record, means that the record is
+// incomplete or malformed rather than that the file could not be read.
+func partialRecord(err error) bool {
+	if _, ok := err.(msgp.InvalidPrefixError); ok {
+		return true
+	}
+	return err == io.EOF || err == io.ErrUnexpectedEOF || err == msgp.ErrShortBytes
+}
+
+// truncate truncates f to size and moves to the end.
+func truncate(f File, size int64) error {
+	if err := f.Truncate(size); err != nil {
+		return err
+	}
+	_, err := f.Seek(size, io.SeekStart)
+	return err
+}
+
+// countReader counts the bytes read from r.
+type countReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -24,6 +24,11 @@ const (
 	NilSize  = 1
 	TimeSize = 15
 
+	DurationSize = Int64Size
+	IPSize       = 18
+	IPAddrSize   = IPSize
+	UUIDSize     = 18
+
 	MapHeaderSize   = 5
 	ArrayHeaderSize = 5
 
@@ -0,0 +1,378 @@
+package msgp
+
+import (
+	"io"
+	bigmath "math/big"
+	"net"
+	"net/netip"
+	"time"
+)
+
+// A Source is what objects are read from: a *Reader, which reads from a stream, or a
+// *BytesSource, which reads from a byte slice. Decoding written against a Source works for
+// both, so a type can implement DecodeMsg and UnmarshalMsg with one method:
+//
+//  func (t *T) DecodeSource(s msgp.Source) error { ... }
+//
+//  func (t *T) DecodeMsg(r *msgp.Reader) error { return t.DecodeSource(r) }
+//
+//  func (t *T) UnmarshalMsg(b []byte) ([]byte, error) { return msgp.UnmarshalSource(b, t) }
+//
+// The methods behave as those of Reader do.
+type Source interface {
+	NextType() (Type, error)
+	IsNil() bool
+	Skip() error
+
+	ReadNil() error
+	ReadBool() (bool, error)
+	ReadInt() (int, error)
+	ReadInt8() (int8, error)
+	ReadInt16() (int16, error)
+	ReadInt32() (int32, error)
+	ReadInt64() (int64, error)
+	ReadUint() (uint, error)
+	ReadUint8() (uint8, error)
+	ReadUint16() (uint16, error)
+	ReadUint32() (uint32, error)
+	ReadUint64() (uint64, error)
+	ReadFloat32() (float32, error)
+	ReadFloat64() (float64, error)
+	ReadComplex64() (complex64, error)
+	ReadComplex128() (complex128, error)
+	ReadString() (string, error)
+	ReadStringAsBytes(scratch []byte) ([]byte, error)
+	ReadBytes(scratch []byte) ([]byte, error)
+	ReadMapHeader() (uint32, error)
+	ReadArrayHeader() (uint32, error)
+	ReadMapKeyPtr() ([]byte, error)
+	ReadIntf() (interface{}, error)
+
+	ReadExtension(e Extension) error
+	ReadTime() (time.Time, error)
+	ReadDuration() (time.Duration, error)
+	ReadBigInt() (*bigmath.Int, error)
+	ReadBigFloat() (*bigmath.Float, error)
+	ReadBigRat() (*bigmath.Rat, error)
+	ReadIP() (net.IP, error)
+	ReadIPAddr() (netip.Addr, error)
+	ReadUUID() (UUID, error)
+}
+
+// A SourceDecoder decodes itself from a Source.
+type SourceDecoder interface {
+	DecodeSource(Source) error
+}
+
+// UnmarshalSource decodes d from the first object in b and returns the bytes after it.
+func UnmarshalSource(b []byte, d SourceDecoder) ([]byte, error) {
+	s := BytesSource{b: b}
+	err := d.DecodeSource(&s)
+	return s.b, err
+}
+
+var (
+	_ Source = (*Reader)(nil)
+	_ Source = (*BytesSource)(nil)
+)
+
+// A BytesSource is a Source that reads from a byte slice with the ReadXxxxBytes functions,
+// without the buffering and copying of a Reader. ReadMapKeyPtr returns a slice of the bytes
+// that stays valid as long as they do.
+type BytesSource struct {
+	// Extensions is the registry used to decode extensions in ReadIntf. If it is nil,
+	// DefaultExtensions is used.
+	Extensions *ExtensionRegistry
+
+	// Lenient says to decode numbers, strings, and 'bin' data leniently, as the Lenient field
+	// of a Reader does.
+	Lenient bool
+
+	b []byte
+}
+
+// extensions returns the registry used by the source.
+func (s *BytesSource) extensions() *ExtensionRegistry {
+	if s.Extensions != nil {
+		return s.Extensions
+	}
+	return DefaultExtensions
+}
+
+// NewBytesSource returns a BytesSource that reads from b.
+func NewBytesSource(b []byte) *BytesSource { return &BytesSource{b: b} }
+
+// Reset makes s read from b.
+func (s *BytesSource) Reset(b []byte) { s.b = b }
+
+// Remaining returns the bytes that have not been read.
+func (s *BytesSource) Remaining() []byte { return s.b }
+
+// NextType returns the type of the next object, or io.EOF if there are no bytes left.
+func (s *BytesSource) NextType() (Type, error) {
+	if len(s.b) == 0 {
+		return InvalidType, io.EOF
+	}
+	return NextType(s.b), nil
+}
+
+// IsNil says if the next object is nil.
+func (s *BytesSource) IsNil() bool { return IsNil(s.b) }
+
+// Skip skips the next object.
+func (s *BytesSource) Skip() (err error) {
+	s.b, err = Skip(s.b)
+	return
+}
+
+// ReadNil reads a nil.
+func (s *BytesSource) ReadNil() (err error) {
+	s.b, err = ReadNilBytes(s.b)
+	return
+}
+
+// ReadBool reads a bool.
+func (s *BytesSource) ReadBool() (v bool, err error) {
+	v, s.b, err = ReadBoolBytes(s.b)
+	return
+}
+
+// ReadInt reads an int.
+func (s *BytesSource) ReadInt() (v int, err error) {
+	if s.Lenient {
+		v, s.b, err = ReadIntBytesLenient(s.b)
+		return
+	}
+	v, s.b, err = ReadIntBytes(s.b)
+	return
+}
+
+// ReadInt8 reads an int8.
+func (s *BytesSource) ReadInt8() (v int8, err error) {
+	if s.Lenient {
+		v, s.b, err = ReadInt8BytesLenient(s.b)
+		return
+	}
+	v, s.b, err = ReadInt8Bytes(s.b)
+	return
+}
+
+// ReadInt16 reads an int16.
+func (s *BytesSource) ReadInt16() (v int16, err error) {
+	if s.Lenient {
+		v, s.b, err = ReadInt16BytesLenient(s.b)
+		return
+	}
+	v, s.b, err = ReadInt16Bytes(s.b)
+	return
+}
+
+// ReadInt32 reads an int32.
+func (s *BytesSource) ReadInt32() (v int32, err error) {
+	if s.Lenient {
+		v, s.b, err = ReadInt32BytesLenient(s.b)
+		return
+	}
+	v, s.b, err = ReadInt32Bytes(s.b)
+	return
+}
+
+// ReadInt64 reads an int64.
+func (s *BytesSource) ReadInt64() (v int64, err error) {
+	if s.Lenient {
+		v, s.b, err = ReadInt64BytesLenient(s.b)
+		return
+	}
+	v, s.b, err = ReadInt64Bytes(s.b)
+	return
+}
+
+// ReadUint reads a uint.
+func (s *BytesSource) ReadUint() (v uint, err error) {
+	if s.Lenient {
+		v, s.b, err = ReadUintBytesLenient(s.b)
+		return
+	}
+	v, s.b, err = ReadUintBytes(s.b)
+	return
+}
+
+// ReadUint8 reads a uint8.
+func (s *BytesSource) ReadUint8() (v uint8, err error) {
+	if s.Lenient {
+		v, s.b, err = ReadUint8BytesLenient(s.b)
+		return
+	}
+	v, s.b, err = ReadUint8Bytes(s.b)
+	return
+}
+
+// ReadUint16 reads a uint16.
+func (s *BytesSource) ReadUint16() (v uint16, err error) {
+	if s.Lenient {
+		v, s.b, err = ReadUint16BytesLenient(s.b)
+		return
+	}
+	v, s.b, err = ReadUint16Bytes(s.b)
+	return
+}
+
+// ReadUint32 reads a uint32.
+func (s *BytesSource) ReadUint32() (v uint32, err error) {
+	if s.Lenient {
+		v, s.b, err = ReadUint32BytesLenient(s.b)
+		return
+	}
+	v, s.b, err = ReadUint32Bytes(s.b)
+	return
+}
+
+// ReadUint64 reads a uint64.
+func (s *BytesSource) ReadUint64() (v uint64, err error) {
+	if s.Lenient {
+		v, s.b, err = ReadUint64BytesLenient(s.b)
+		return
+	}
+	v, s.b, err = ReadUint64Bytes(s.b)
+	return
+}
+
+// ReadFloat32 reads a float32.
+func (s *BytesSource) ReadFloat32() (v float32, err error) {
+	if s.Lenient {
+		v, s.b, err = ReadFloat32BytesLenient(s.b)
+		return
+	}
+	v, s.b, err = ReadFloat32Bytes(s.b)
+	return
+}
+
+// ReadFloat64 reads a float64.
+func (s *BytesSource) ReadFloat64() (v float64, err error) {
+	if s.Lenient {
+		v, s.b, err = ReadFloat64BytesLenient(s.b)
+		return
+	}
+	v, s.b, err = ReadFloat64Bytes(s.b)
+	return
+}
+
+// ReadComplex64 reads a complex64.
+func (s *BytesSource) ReadComplex64() (v complex64, err error) {
+	v, s.b, err = ReadComplex64Bytes(s.b)
+	return
+}
+
+// ReadComplex128 reads a complex128.
+func (s *BytesSource) ReadComplex128() (v complex128, err error) {
+	v, s.b, err = ReadComplex128Bytes(s.b)
+	return
+}
+
+// ReadString reads a string.
+func (s *BytesSource) ReadString() (v string, err error) {
+	if s.Lenient {
+		v, s.b, err = ReadStringBytesLenient(s.b)
+		return
+	}
+	v, s.b, err = ReadStringBytes(s.b)
+	return
+}
+
+// ReadStringAsBytes reads a string into scratch, if it fits, and returns it.
+func (s *BytesSource) ReadStringAsBytes(scratch []byte) (v []byte, err error) {
+	if s.Lenient && NextType(s.b) == BinType {
+		v, s.b, err = ReadBytesBytes(s.b, scratch)
+		return
+	}
+	v, s.b, err = ReadStringAsBytes(s.b, scratch)
+	return
+}
+
+// ReadBytes reads a binary object into scratch, if it fits, and returns it.
+func (s *BytesSource) ReadBytes(scratch []byte) (v []byte, err error) {
+	if s.Lenient {
+		v, s.b, err = ReadBytesBytesLenient(s.b, scratch)
+		return
+	}
+	v, s.b, err = ReadBytesBytes(s.b, scratch)
+	return
+}
+
+// ReadMapHeader reads a map header and returns the number of entries.
+func (s *BytesSource) ReadMapHeader() (sz uint32, err error) {
+	sz, s.b, err = ReadMapHeaderBytes(s.b)
+	return
+}
+
+// ReadArrayHeader reads an array header and returns the number of elements.
+func (s *BytesSource) ReadArrayHeader() (sz uint32, err error) {
+	sz, s.b, err = ReadArrayHeaderBytes(s.b)
+	return
+}
+
+// ReadMapKeyPtr reads a 'str' or 'bin' map key and returns a slice of the bytes holding it.
+func (s *BytesSource) ReadMapKeyPtr() (v []byte, err error) {
+	v, s.b, err = ReadMapKeyZC(s.b)
+	return
+}
+
+// ReadIntf reads the next object as an interface{}, decoding extensions with the registry of s.
+func (s *BytesSource) ReadIntf() (v interface{}, err error) {
+	v, s.b, err = readIntfBytes(s.b, s.extensions())
+	return
+}
+
+// ReadExtension reads an extension into e.
+func (s *BytesSource) ReadExtension(e Extension) (err error) {
+	s.b, err = ReadExtensionBytes(s.b, e)
+	return
+}
+
+// ReadTime reads a time.Time.
+func (s *BytesSource) ReadTime() (v time.Time, err error) {
+	v, s.b, err = ReadTimeBytes(s.b)
+	return
+}
+
+// ReadDuration reads a time.Duration.
+func (s *BytesSource) ReadDuration() (v time.Duration, err error) {
+	v, s.b, err = ReadDurationBytes(s.b)
+	return
+}
+
+// ReadBigInt reads a *big.Int.
+func (s *BytesSource) ReadBigInt() (v *bigmath.Int, err error) {
+	v, s.b, err = ReadBigIntBytes(s.b)
+	return
+}
+
+// ReadBigFloat reads a *big.Float.
+func (s *BytesSource) ReadBigFloat() (v *bigmath.Float, err error) {
+	v, s.b, err = ReadBigFloatBytes(s.b)
+	return
+}
+
+// ReadBigRat reads a *big.Rat.
+func (s *BytesSource) ReadBigRat() (v *bigmath.Rat, err error) {
+	v, s.b, err = ReadBigRatBytes(s.b)
+	return
+}
+
+// ReadIP reads a net.IP.
+func (s *BytesSource) ReadIP() (v net.IP, err error) {
+	v, s.b, err = ReadIPBytes(s.b)
+	return
+}
+
+// ReadIPAddr reads a netip.Addr.
+func (s *BytesSource) ReadIPAddr() (v netip.Addr, err error) {
+	v, s.b, err = ReadIPAddrBytes(s.b)
+	return
+}
+
+// ReadUUID reads a UUID.
+func (s *BytesSource) ReadUUID() (v UUID, err error) {
+	v, s.b, err = ReadUUIDBytes(s.b)
+	return
+}
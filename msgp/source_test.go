@@ -0,0 +1,164 @@
+package msgp
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// sourceThing decodes itself from a Source for both DecodeMsg and UnmarshalMsg.
+type sourceThing struct {
+	N    int64
+	S    string
+	B    []byte
+	T    time.Time
+	U    UUID
+	Tags []string
+}
+
+func (t *sourceThing) DecodeSource(s Source) error {
+	sz, err := s.ReadMapHeader()
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); i < sz; i++ {
+		key, err := s.ReadMapKeyPtr()
+		if err != nil {
+			return err
+		}
+		switch string(key) {
+		case "n":
+			t.N, err = s.ReadInt64()
+		case "s":
+			t.S, err = s.ReadString()
+		case "b":
+			t.B, err = s.ReadBytes(t.B)
+		case "t":
+			t.T, err = s.ReadTime()
+		case "u":
+			t.U, err = s.ReadUUID()
+		case "tags":
+			var n uint32
+			if n, err = s.ReadArrayHeader(); err != nil {
+				return err
+			}
+			t.Tags = make([]string, n)
+			for j := range t.Tags {
+				if t.Tags[j], err = s.ReadString(); err != nil {
+					return err
+				}
+			}
+		default:
+			err = s.Skip()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *sourceThing) DecodeMsg(r *Reader) error { return t.DecodeSource(r) }
+
+func (t *sourceThing) UnmarshalMsg(b []byte) ([]byte, error) { return UnmarshalSource(b, t) }
+
+func TestSource(t *testing.T) {
+	var b []byte
+	b = AppendMapHeader(b, 7)
+	b = AppendString(b, "n")
+	b = AppendInt64(b, -500)
+	b = AppendString(b, "s")
+	b = AppendString(b, "hello")
+	b = AppendString(b, "b")
+	b = AppendBytes(b, []byte{1, 2, 3})
+	b = AppendString(b, "skip")
+	b = AppendMapHeader(AppendArrayHeader(b, 1), 0)
+	b = AppendString(b, "t")
+	b = AppendTime(b, time.Unix(1500000000, 5))
+	b = AppendString(b, "u")
+	b = AppendUUID(b, UUID{1, 2, 3})
+	b = AppendString(b, "tags")
+	b = AppendArrayHeader(b, 2)
+	b = AppendString(b, "a")
+	b = AppendString(b, "b")
+	msg := AppendBool(b, true)
+
+	var fromBytes, fromReader sourceThing
+	rest, err := fromBytes.UnmarshalMsg(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(rest, msg[len(b):]) {
+		t.Errorf("got remaining bytes % x; want % x", rest, msg[len(b):])
+	}
+	r := NewReader(bytes.NewReader(msg))
+	if err = fromReader.DecodeMsg(r); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fromBytes, fromReader) {
+		t.Errorf("decoded %+v from bytes but %+v from a Reader", fromBytes, fromReader)
+	}
+	if fromBytes.N != -500 || fromBytes.S != "hello" || len(fromBytes.Tags) != 2 || fromBytes.U != (UUID{1, 2, 3}) {
+		t.Errorf("decoded %+v", fromBytes)
+	}
+
+	s := NewBytesSource(rest)
+	if v, err := s.ReadBool(); err != nil || !v {
+		t.Errorf("got %v, %v; want true", v, err)
+	}
+	if _, err := s.NextType(); err != io.EOF {
+		t.Errorf("got error %v at the end; want io.EOF", err)
+	}
+	if _, err := s.ReadInt64(); err == nil {
+		t.Error("no error reading past the end")
+	}
+}
+
+func TestBytesSourceOptions(t *testing.T) {
+	var b []byte
+	b = AppendMapHeader(b, 3)
+	b = AppendString(b, "n")
+	b = AppendFloat64(b, 42)
+	b = AppendString(b, "s")
+	b = AppendBytes(b, []byte("hello"))
+	b = AppendString(b, "b")
+	b = AppendString(b, "abc")
+
+	var fromBytes, fromReader sourceThing
+	if err := fromBytes.DecodeSource(NewBytesSource(b)); err == nil {
+		t.Error("no error decoding other types without Lenient")
+	}
+	s := NewBytesSource(b)
+	s.Lenient = true
+	if err := fromBytes.DecodeSource(s); err != nil {
+		t.Fatal(err)
+	}
+	r := NewReader(bytes.NewReader(b))
+	r.Lenient = true
+	if err := fromReader.DecodeMsg(r); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fromBytes, fromReader) {
+		t.Errorf("decoded %+v from bytes but %+v from a Reader", fromBytes, fromReader)
+	}
+	if fromBytes.N != 42 || fromBytes.S != "hello" || string(fromBytes.B) != "abc" {
+		t.Errorf("decoded %+v", fromBytes)
+	}
+
+	reg := NewExtensionRegistry(nil)
+	if err := reg.Register(50, func() Extension { return new(regExt) }); err != nil {
+		t.Fatal(err)
+	}
+	ext, err := AppendExtension(nil, &regExt{Data: []byte("x")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Reset(ext)
+	s.Extensions = reg
+	v, err := s.ReadIntf()
+	if e, ok := v.(*regExt); !ok || err != nil || string(e.Data) != "x" {
+		t.Errorf("got %#v, %v; want the registered extension", v, err)
+	}
+}
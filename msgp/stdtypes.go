@@ -0,0 +1,548 @@
+package msgp
+
+import (
+	bigmath "math/big"
+	"net"
+	"net/netip"
+	"time"
+)
+
+// This file contains the encoding of standard library types that MessagePack has no native
+// representation for. Most of them are written as one of this package's built-in extension
+// types (see BigIntExtension through UUIDExtension); time.Duration is written as an int64 number
+// of nanoseconds. A nil pointer, nil net.IP, or invalid netip.Addr is written as nil, and reading
+// nil gives back the zero value.
+
+// UUID is a 16-byte universally unique identifier. It is encoded as the UUIDExtension type.
+type UUID [16]byte
+
+// ExtensionType implements Extension.
+func (u *UUID) ExtensionType() int8 { return UUIDExtension }
+
+// Len implements Extension.
+func (u *UUID) Len() int { return 16 }
+
+// MarshalBinaryTo implements Extension.
+func (u *UUID) MarshalBinaryTo(b []byte) error {
+	copy(b, u[:])
+	return nil
+}
+
+// UnmarshalBinary implements Extension.
+func (u *UUID) UnmarshalBinary(b []byte) error {
+	if len(b) != 16 {
+		return ExtensionDataError{Type: UUIDExtension, Reason: "UUID must be 16 bytes long"}
+	}
+	copy(u[:], b)
+	return nil
+}
+
+// String returns the UUID in the canonical form xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx.
+func (u UUID) String() string {
+	return string(u.appendText(make([]byte, 0, 36)))
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (u UUID) MarshalText() ([]byte, error) {
+	return u.appendText(make([]byte, 0, 36)), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (u *UUID) UnmarshalText(text []byte) error {
+	v, err := ParseUUID(string(text))
+	if err != nil {
+		return err
+	}
+	*u = v
+	return nil
+}
+
+func (u UUID) appendText(b []byte) []byte {
+	for i, c := range u {
+		if i == 4 || i == 6 || i == 8 || i == 10 {
+			b = append(b, '-')
+		}
+		b = append(b, hex[c>>4], hex[c&0xF])
+	}
+	return b
+}
+
+// ParseUUID parses a UUID given in the canonical form xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx.
+func ParseUUID(s string) (UUID, error) {
+	var u UUID
+	if len(s) != 36 || s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+		return u, errInvalidUUID
+	}
+	j := 0
+	for i := 0; i < len(s); {
+		if s[i] == '-' {
+			i++
+			continue
+		}
+		hi, ok1 := fromHexChar(s[i])
+		lo, ok2 := fromHexChar(s[i+1])
+		if !ok1 || !ok2 {
+			return u, errInvalidUUID
+		}
+		u[j] = hi<<4 | lo
+		i += 2
+		j++
+	}
+	return u, nil
+}
+
+var errInvalidUUID = ExtensionDataError{Type: UUIDExtension, Reason: "UUID string is not in the canonical form"}
+
+func fromHexChar(c byte) (byte, bool) {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0', true
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10, true
+	case 'A' <= c && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
+
+// AppendUUID appends a UUID to b as a UUIDExtension.
+func AppendUUID(b []byte, u UUID) []byte {
+	o, n := ensure(b, UUIDSize)
+	o[n] = mfixext16
+	o[n+1] = UUIDExtension & 0xff
+	copy(o[n+2:], u[:])
+	return o
+}
+
+// ReadUUIDBytes reads a UUID from b and returns the remaining bytes.
+func ReadUUIDBytes(b []byte) (u UUID, o []byte, err error) {
+	if IsNil(b) {
+		o, err = ReadNilBytes(b)
+		return
+	}
+	o, err = ReadExtensionBytes(b, &u)
+	return
+}
+
+// WriteUUID writes a UUID to the writer as a UUIDExtension.
+func (mw *Writer) WriteUUID(u UUID) error {
+	return mw.WriteExtension(&u)
+}
+
+// ReadUUID reads a UUID from the reader.
+func (m *Reader) ReadUUID() (u UUID, err error) {
+	if m.IsNil() {
+		err = m.ReadNil()
+		return
+	}
+	err = m.ReadExtension(&u)
+	return
+}
+
+// AppendDuration appends a time.Duration to b as an int64 number of nanoseconds.
+func AppendDuration(b []byte, d time.Duration) []byte { return AppendInt64(b, int64(d)) }
+
+// ReadDurationBytes reads a time.Duration from b and returns the remaining bytes.
+func ReadDurationBytes(b []byte) (time.Duration, []byte, error) {
+	i, o, err := ReadInt64Bytes(b)
+	return time.Duration(i), o, err
+}
+
+// WriteDuration writes a time.Duration to the writer as an int64 number of nanoseconds.
+func (mw *Writer) WriteDuration(d time.Duration) error { return mw.WriteInt64(int64(d)) }
+
+// ReadDuration reads a time.Duration from the reader.
+func (m *Reader) ReadDuration() (time.Duration, error) {
+	i, err := m.ReadInt64()
+	return time.Duration(i), err
+}
+
+// bigIntExt is the Extension used to encode a *big.Int.
+type bigIntExt struct{ v *bigmath.Int }
+
+func (e *bigIntExt) ExtensionType() int8 { return BigIntExtension }
+
+func (e *bigIntExt) Len() int { return 1 + (e.v.BitLen()+7)/8 }
+
+func (e *bigIntExt) MarshalBinaryTo(b []byte) error {
+	b[0] = 0
+	if e.v.Sign() < 0 {
+		b[0] = 1
+	}
+	e.v.FillBytes(b[1:e.Len()])
+	return nil
+}
+
+func (e *bigIntExt) UnmarshalBinary(b []byte) error {
+	if len(b) == 0 || b[0] > 1 {
+		return ExtensionDataError{Type: BigIntExtension, Reason: "missing or invalid sign byte"}
+	}
+	e.v.SetBytes(b[1:])
+	if b[0] == 1 {
+		e.v.Neg(e.v)
+	}
+	return nil
+}
+
+func bigIntSize(i *bigmath.Int) int {
+	if i == nil {
+		return NilSize
+	}
+	return ExtensionPrefixSize + 1 + (i.BitLen()+7)/8
+}
+
+// AppendBigInt appends a *big.Int to b as a BigIntExtension.
+func AppendBigInt(b []byte, i *bigmath.Int) []byte {
+	if i == nil {
+		return AppendNil(b)
+	}
+	o, _ := AppendExtension(b, &bigIntExt{i})
+	return o
+}
+
+// ReadBigIntBytes reads a *big.Int from b and returns the remaining bytes.
+func ReadBigIntBytes(b []byte) (*bigmath.Int, []byte, error) {
+	if IsNil(b) {
+		o, err := ReadNilBytes(b)
+		return nil, o, err
+	}
+	e := bigIntExt{new(bigmath.Int)}
+	o, err := ReadExtensionBytes(b, &e)
+	if err != nil {
+		return nil, o, err
+	}
+	return e.v, o, nil
+}
+
+// WriteBigInt writes a *big.Int to the writer as a BigIntExtension.
+func (mw *Writer) WriteBigInt(i *bigmath.Int) error {
+	if i == nil {
+		return mw.WriteNil()
+	}
+	return mw.WriteExtension(&bigIntExt{i})
+}
+
+// ReadBigInt reads a *big.Int from the reader.
+func (m *Reader) ReadBigInt() (*bigmath.Int, error) {
+	if m.IsNil() {
+		return nil, m.ReadNil()
+	}
+	e := bigIntExt{new(bigmath.Int)}
+	if err := m.ReadExtension(&e); err != nil {
+		return nil, err
+	}
+	return e.v, nil
+}
+
+// bigFloatExt is the Extension used to encode a *big.Float. When encoding, data holds the
+// GobEncode output of v.
+type bigFloatExt struct {
+	v    *bigmath.Float
+	data []byte
+}
+
+func newBigFloatExt(f *bigmath.Float) *bigFloatExt {
+	data, _ := f.GobEncode() // never fails for a non-nil *big.Float
+	return &bigFloatExt{v: f, data: data}
+}
+
+func (e *bigFloatExt) ExtensionType() int8 { return BigFloatExtension }
+
+func (e *bigFloatExt) Len() int { return len(e.data) }
+
+func (e *bigFloatExt) MarshalBinaryTo(b []byte) error {
+	copy(b, e.data)
+	return nil
+}
+
+func (e *bigFloatExt) UnmarshalBinary(b []byte) error {
+	if err := e.v.GobDecode(b); err != nil {
+		return ExtensionDataError{Type: BigFloatExtension, Reason: err.Error()}
+	}
+	return nil
+}
+
+// bigFloatSize returns an upper bound on the encoded size of f.
+func bigFloatSize(f *bigmath.Float) int {
+	if f == nil {
+		return NilSize
+	}
+	// The gob encoding has a 6-byte header, a 4-byte exponent, and up to prec bits of mantissa
+	// rounded up to whole 64-bit words.
+	return ExtensionPrefixSize + 10 + int((f.Prec()+63)/64)*8
+}
+
+// AppendBigFloat appends a *big.Float to b as a BigFloatExtension.
+func AppendBigFloat(b []byte, f *bigmath.Float) []byte {
+	if f == nil {
+		return AppendNil(b)
+	}
+	o, _ := AppendExtension(b, newBigFloatExt(f))
+	return o
+}
+
+// ReadBigFloatBytes reads a *big.Float from b and returns the remaining bytes.
+func ReadBigFloatBytes(b []byte) (*bigmath.Float, []byte, error) {
+	if IsNil(b) {
+		o, err := ReadNilBytes(b)
+		return nil, o, err
+	}
+	e := bigFloatExt{v: new(bigmath.Float)}
+	o, err := ReadExtensionBytes(b, &e)
+	if err != nil {
+		return nil, o, err
+	}
+	return e.v, o, nil
+}
+
+// WriteBigFloat writes a *big.Float to the writer as a BigFloatExtension.
+func (mw *Writer) WriteBigFloat(f *bigmath.Float) error {
+	if f == nil {
+		return mw.WriteNil()
+	}
+	return mw.WriteExtension(newBigFloatExt(f))
+}
+
+// ReadBigFloat reads a *big.Float from the reader.
+func (m *Reader) ReadBigFloat() (*bigmath.Float, error) {
+	if m.IsNil() {
+		return nil, m.ReadNil()
+	}
+	e := bigFloatExt{v: new(bigmath.Float)}
+	if err := m.ReadExtension(&e); err != nil {
+		return nil, err
+	}
+	return e.v, nil
+}
+
+// bigRatExt is the Extension used to encode a *big.Rat.
+type bigRatExt struct{ v *bigmath.Rat }
+
+func (e *bigRatExt) ExtensionType() int8 { return BigRatExtension }
+
+func (e *bigRatExt) Len() int {
+	return 5 + (e.v.Num().BitLen()+7)/8 + (e.v.Denom().BitLen()+7)/8
+}
+
+func (e *bigRatExt) MarshalBinaryTo(b []byte) error {
+	num, den := e.v.Num(), e.v.Denom()
+	b[0] = 0
+	if num.Sign() < 0 {
+		b[0] = 1
+	}
+	nl := (num.BitLen() + 7) / 8
+	big.PutUint32(b[1:], uint32(nl))
+	num.FillBytes(b[5 : 5+nl])
+	den.FillBytes(b[5+nl : e.Len()])
+	return nil
+}
+
+func (e *bigRatExt) UnmarshalBinary(b []byte) error {
+	if len(b) < 5 || b[0] > 1 {
+		return ExtensionDataError{Type: BigRatExtension, Reason: "missing or invalid header"}
+	}
+	nl := big.Uint32(b[1:])
+	if uint64(nl) > uint64(len(b)-5) {
+		return ExtensionDataError{Type: BigRatExtension, Reason: "numerator length out of range"}
+	}
+	num := new(bigmath.Int).SetBytes(b[5 : 5+nl])
+	den := new(bigmath.Int).SetBytes(b[5+nl:])
+	if den.Sign() == 0 {
+		return ExtensionDataError{Type: BigRatExtension, Reason: "zero denominator"}
+	}
+	if b[0] == 1 {
+		num.Neg(num)
+	}
+	e.v.SetFrac(num, den)
+	return nil
+}
+
+func bigRatSize(r *bigmath.Rat) int {
+	if r == nil {
+		return NilSize
+	}
+	return ExtensionPrefixSize + (&bigRatExt{r}).Len()
+}
+
+// AppendBigRat appends a *big.Rat to b as a BigRatExtension.
+func AppendBigRat(b []byte, r *bigmath.Rat) []byte {
+	if r == nil {
+		return AppendNil(b)
+	}
+	o, _ := AppendExtension(b, &bigRatExt{r})
+	return o
+}
+
+// ReadBigRatBytes reads a *big.Rat from b and returns the remaining bytes.
+func ReadBigRatBytes(b []byte) (*bigmath.Rat, []byte, error) {
+	if IsNil(b) {
+		o, err := ReadNilBytes(b)
+		return nil, o, err
+	}
+	e := bigRatExt{new(bigmath.Rat)}
+	o, err := ReadExtensionBytes(b, &e)
+	if err != nil {
+		return nil, o, err
+	}
+	return e.v, o, nil
+}
+
+// WriteBigRat writes a *big.Rat to the writer as a BigRatExtension.
+func (mw *Writer) WriteBigRat(r *bigmath.Rat) error {
+	if r == nil {
+		return mw.WriteNil()
+	}
+	return mw.WriteExtension(&bigRatExt{r})
+}
+
+// ReadBigRat reads a *big.Rat from the reader.
+func (m *Reader) ReadBigRat() (*bigmath.Rat, error) {
+	if m.IsNil() {
+		return nil, m.ReadNil()
+	}
+	e := bigRatExt{new(bigmath.Rat)}
+	if err := m.ReadExtension(&e); err != nil {
+		return nil, err
+	}
+	return e.v, nil
+}
+
+// ipExt is the Extension used to encode IP addresses. The ip field is always 4 or 16 bytes
+// long when encoding.
+type ipExt struct{ ip []byte }
+
+func (e *ipExt) ExtensionType() int8 { return IPExtension }
+
+func (e *ipExt) Len() int { return len(e.ip) }
+
+func (e *ipExt) MarshalBinaryTo(b []byte) error {
+	copy(b, e.ip)
+	return nil
+}
+
+func (e *ipExt) UnmarshalBinary(b []byte) error {
+	if len(b) != net.IPv4len && len(b) != net.IPv6len {
+		return ExtensionDataError{Type: IPExtension, Reason: "IP address must be 4 or 16 bytes long"}
+	}
+	e.ip = append(e.ip[:0], b...)
+	return nil
+}
+
+// AppendIP appends a net.IP to b as an IPExtension. IPv4 addresses are always written in their
+// 4-byte form. An IP that is neither 4 nor 16 bytes long is appended as nil.
+func AppendIP(b []byte, ip net.IP) []byte {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	} else if len(ip) != net.IPv6len {
+		return AppendNil(b)
+	}
+	o, _ := AppendExtension(b, &ipExt{ip})
+	return o
+}
+
+// ReadIPBytes reads a net.IP from b and returns the remaining bytes.
+func ReadIPBytes(b []byte) (net.IP, []byte, error) {
+	if IsNil(b) {
+		o, err := ReadNilBytes(b)
+		return nil, o, err
+	}
+	var e ipExt
+	o, err := ReadExtensionBytes(b, &e)
+	if err != nil {
+		return nil, o, err
+	}
+	return net.IP(e.ip), o, nil
+}
+
+// WriteIP writes a net.IP to the writer as an IPExtension. IPv4 addresses are always written
+// in their 4-byte form. An IP that is neither 4 nor 16 bytes long is written as nil.
+func (mw *Writer) WriteIP(ip net.IP) error {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	} else if len(ip) != net.IPv6len {
+		return mw.WriteNil()
+	}
+	return mw.WriteExtension(&ipExt{ip})
+}
+
+// ReadIP reads a net.IP from the reader.
+func (m *Reader) ReadIP() (net.IP, error) {
+	if m.IsNil() {
+		return nil, m.ReadNil()
+	}
+	var e ipExt
+	if err := m.ReadExtension(&e); err != nil {
+		return nil, err
+	}
+	return net.IP(e.ip), nil
+}
+
+// ipAddrBytes returns the 4-byte form of an IPv4 address and the 16-byte form of an IPv6
+// address. The IPv6 zone is not kept.
+func ipAddrBytes(a netip.Addr) []byte {
+	if a.Is4() {
+		a4 := a.As4()
+		return a4[:]
+	}
+	a16 := a.As16()
+	return a16[:]
+}
+
+// AppendIPAddr appends a netip.Addr to b as an IPExtension. The zone of an IPv6 address is
+// dropped, and the zero Addr is appended as nil.
+func AppendIPAddr(b []byte, a netip.Addr) []byte {
+	if !a.IsValid() {
+		return AppendNil(b)
+	}
+	o, _ := AppendExtension(b, &ipExt{ipAddrBytes(a)})
+	return o
+}
+
+// ReadIPAddrBytes reads a netip.Addr from b and returns the remaining bytes.
+func ReadIPAddrBytes(b []byte) (netip.Addr, []byte, error) {
+	ip, o, err := ReadIPBytes(b)
+	if err != nil || ip == nil {
+		return netip.Addr{}, o, err
+	}
+	a, _ := netip.AddrFromSlice(ip)
+	return a, o, nil
+}
+
+// WriteIPAddr writes a netip.Addr to the writer as an IPExtension. The zone of an IPv6 address
+// is dropped, and the zero Addr is written as nil.
+func (mw *Writer) WriteIPAddr(a netip.Addr) error {
+	if !a.IsValid() {
+		return mw.WriteNil()
+	}
+	return mw.WriteExtension(&ipExt{ipAddrBytes(a)})
+}
+
+// ReadIPAddr reads a netip.Addr from the reader.
+func (m *Reader) ReadIPAddr() (netip.Addr, error) {
+	ip, err := m.ReadIP()
+	if err != nil || ip == nil {
+		return netip.Addr{}, err
+	}
+	a, _ := netip.AddrFromSlice(ip)
+	return a, nil
+}
+
+// appendStdJSON appends the JSON form of v, which must be a value returned by ReadIntf or
+// ReadIntfBytes for one of the types in this file. Big integers are written as bare numbers,
+// and the other types are written as strings.
+func appendStdJSON(b []byte, v interface{}) []byte {
+	switch v := v.(type) {
+	case *bigmath.Int:
+		return v.Append(b, 10)
+	case *bigmath.Float:
+		return append(v.Append(append(b, '"'), 'g', -1), '"')
+	case *bigmath.Rat:
+		return append(append(append(b, '"'), v.RatString()...), '"')
+	case net.IP:
+		return append(append(append(b, '"'), v.String()...), '"')
+	case UUID:
+		return append(v.appendText(append(b, '"')), '"')
+	default:
+		return append(b, null...)
+	}
+}
@@ -0,0 +1,344 @@
+package msgp
+
+import (
+	"bytes"
+	bigmath "math/big"
+	"net"
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func bigInts() []*bigmath.Int {
+	huge, _ := new(bigmath.Int).SetString("123456789012345678901234567890", 10)
+	return []*bigmath.Int{
+		bigmath.NewInt(0),
+		bigmath.NewInt(1),
+		bigmath.NewInt(-1),
+		bigmath.NewInt(255),
+		bigmath.NewInt(-256),
+		huge,
+		new(bigmath.Int).Neg(huge),
+	}
+}
+
+func TestBigInt(t *testing.T) {
+	var buf bytes.Buffer
+	en := NewWriter(&buf)
+	dc := NewReader(&buf)
+	for _, v := range bigInts() {
+		bts := AppendBigInt(nil, v)
+		if GuessSize(v) < len(bts) {
+			t.Errorf("%s: GuessSize %d is less than encoded length %d", v, GuessSize(v), len(bts))
+		}
+		if NextType(bts) != BigIntType {
+			t.Errorf("%s: got type %s", v, NextType(bts))
+		}
+		out, left, err := ReadBigIntBytes(bts)
+		if err != nil {
+			t.Fatalf("%s: %s", v, err)
+		}
+		if len(left) != 0 {
+			t.Errorf("%s: %d bytes left", v, len(left))
+		}
+		if out.Cmp(v) != 0 {
+			t.Errorf("put %s in; got %s out", v, out)
+		}
+
+		buf.Reset()
+		en.WriteBigInt(v)
+		en.Flush()
+		if !bytes.Equal(buf.Bytes(), bts) {
+			t.Errorf("%s: Writer and Append encodings differ", v)
+		}
+		out, err = dc.ReadBigInt()
+		if err != nil {
+			t.Fatalf("%s: %s", v, err)
+		}
+		if out.Cmp(v) != 0 {
+			t.Errorf("put %s in; got %s out", v, out)
+		}
+	}
+}
+
+func TestBigFloat(t *testing.T) {
+	values := []*bigmath.Float{
+		bigmath.NewFloat(0),
+		bigmath.NewFloat(-1.5),
+		new(bigmath.Float).SetPrec(200).Quo(bigmath.NewFloat(1), bigmath.NewFloat(3)),
+		new(bigmath.Float).SetInf(true),
+	}
+	var buf bytes.Buffer
+	en := NewWriter(&buf)
+	dc := NewReader(&buf)
+	for _, v := range values {
+		bts := AppendBigFloat(nil, v)
+		if GuessSize(v) < len(bts) {
+			t.Errorf("%s: GuessSize %d is less than encoded length %d", v, GuessSize(v), len(bts))
+		}
+		out, _, err := ReadBigFloatBytes(bts)
+		if err != nil {
+			t.Fatalf("%s: %s", v, err)
+		}
+		if out.Cmp(v) != 0 || out.Prec() != v.Prec() {
+			t.Errorf("put %s (prec %d) in; got %s (prec %d) out", v, v.Prec(), out, out.Prec())
+		}
+
+		buf.Reset()
+		en.WriteBigFloat(v)
+		en.Flush()
+		out, err = dc.ReadBigFloat()
+		if err != nil {
+			t.Fatalf("%s: %s", v, err)
+		}
+		if out.Cmp(v) != 0 {
+			t.Errorf("put %s in; got %s out", v, out)
+		}
+	}
+}
+
+func TestBigRat(t *testing.T) {
+	values := []*bigmath.Rat{
+		new(bigmath.Rat),
+		bigmath.NewRat(5, 1),
+		bigmath.NewRat(-3, 7),
+		new(bigmath.Rat).SetFrac(bigInts()[5], bigmath.NewInt(11)),
+	}
+	var buf bytes.Buffer
+	en := NewWriter(&buf)
+	dc := NewReader(&buf)
+	for _, v := range values {
+		bts := AppendBigRat(nil, v)
+		if GuessSize(v) < len(bts) {
+			t.Errorf("%s: GuessSize %d is less than encoded length %d", v, GuessSize(v), len(bts))
+		}
+		out, _, err := ReadBigRatBytes(bts)
+		if err != nil {
+			t.Fatalf("%s: %s", v, err)
+		}
+		if out.Cmp(v) != 0 {
+			t.Errorf("put %s in; got %s out", v, out)
+		}
+
+		buf.Reset()
+		en.WriteBigRat(v)
+		en.Flush()
+		out, err = dc.ReadBigRat()
+		if err != nil {
+			t.Fatalf("%s: %s", v, err)
+		}
+		if out.Cmp(v) != 0 {
+			t.Errorf("put %s in; got %s out", v, out)
+		}
+	}
+
+	// A zero denominator must be rejected rather than cause a panic.
+	bts := []byte{mfixext8, BigRatExtension & 0xff, 0, 0, 0, 0, 1, 1, 0, 0}
+	if _, _, err := ReadBigRatBytes(bts[:7]); err == nil {
+		t.Error("expected an error for a truncated big.Rat")
+	}
+	bts = []byte{mext8, 6, BigRatExtension & 0xff, 0, 0, 0, 0, 1, 1, 0}
+	if _, _, err := ReadBigRatBytes(bts); err == nil {
+		t.Error("expected an error for a zero denominator")
+	}
+}
+
+func TestIP(t *testing.T) {
+	values := []net.IP{
+		net.IPv4(192, 168, 1, 20),
+		net.ParseIP("2001:db8::68"),
+		nil,
+	}
+	var buf bytes.Buffer
+	en := NewWriter(&buf)
+	dc := NewReader(&buf)
+	for _, v := range values {
+		bts := AppendIP(nil, v)
+		if len(bts) > IPSize {
+			t.Errorf("%s: encoded length %d is greater than IPSize", v, len(bts))
+		}
+		out, _, err := ReadIPBytes(bts)
+		if err != nil {
+			t.Fatalf("%s: %s", v, err)
+		}
+		if !out.Equal(v) {
+			t.Errorf("put %s in; got %s out", v, out)
+		}
+
+		buf.Reset()
+		en.WriteIP(v)
+		en.Flush()
+		out, err = dc.ReadIP()
+		if err != nil {
+			t.Fatalf("%s: %s", v, err)
+		}
+		if !out.Equal(v) {
+			t.Errorf("put %s in; got %s out", v, out)
+		}
+	}
+}
+
+func TestIPAddr(t *testing.T) {
+	values := []netip.Addr{
+		netip.MustParseAddr("10.0.0.1"),
+		netip.MustParseAddr("::ffff:10.0.0.1"),
+		netip.MustParseAddr("fe80::1"),
+		{},
+	}
+	var buf bytes.Buffer
+	en := NewWriter(&buf)
+	dc := NewReader(&buf)
+	for _, v := range values {
+		bts := AppendIPAddr(nil, v)
+		out, _, err := ReadIPAddrBytes(bts)
+		if err != nil {
+			t.Fatalf("%s: %s", v, err)
+		}
+		if out != v {
+			t.Errorf("put %s in; got %s out", v, out)
+		}
+
+		buf.Reset()
+		en.WriteIPAddr(v)
+		en.Flush()
+		out, err = dc.ReadIPAddr()
+		if err != nil {
+			t.Fatalf("%s: %s", v, err)
+		}
+		if out != v {
+			t.Errorf("put %s in; got %s out", v, out)
+		}
+	}
+
+	// net.IP and netip.Addr share an encoding.
+	out, _, err := ReadIPBytes(AppendIPAddr(nil, values[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !out.Equal(net.IPv4(10, 0, 0, 1)) {
+		t.Errorf("got %s", out)
+	}
+}
+
+func TestUUID(t *testing.T) {
+	const s = "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
+	u, err := ParseUUID(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.String() != s {
+		t.Errorf("parsed %q; printed %q", s, u.String())
+	}
+	for _, bad := range []string{"", "6ba7b810-9dad-11d1-80b4-00c04fd430c", "6ba7b810x9dad-11d1-80b4-00c04fd430c8", "6ba7b810-9dad-11d1-80b4-00c04fd430cg"} {
+		if _, err := ParseUUID(bad); err == nil {
+			t.Errorf("expected an error parsing %q", bad)
+		}
+	}
+
+	bts := AppendUUID(nil, u)
+	if len(bts) != UUIDSize {
+		t.Errorf("encoded length is %d; expected %d", len(bts), UUIDSize)
+	}
+	if NextType(bts) != UUIDType {
+		t.Errorf("got type %s", NextType(bts))
+	}
+	out, _, err := ReadUUIDBytes(bts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != u {
+		t.Errorf("put %s in; got %s out", u, out)
+	}
+
+	var buf bytes.Buffer
+	en := NewWriter(&buf)
+	en.WriteUUID(u)
+	en.Flush()
+	if !bytes.Equal(buf.Bytes(), bts) {
+		t.Error("Writer and Append encodings differ")
+	}
+	out, err = NewReader(&buf).ReadUUID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != u {
+		t.Errorf("put %s in; got %s out", u, out)
+	}
+}
+
+func TestDuration(t *testing.T) {
+	d := 90 * time.Minute
+	out, _, err := ReadDurationBytes(AppendDuration(nil, d))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != d {
+		t.Errorf("put %s in; got %s out", d, out)
+	}
+}
+
+func TestStdTypesIntf(t *testing.T) {
+	u, _ := ParseUUID("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+	values := []interface{}{
+		bigmath.NewInt(-42),
+		bigmath.NewFloat(2.5),
+		bigmath.NewRat(1, 3),
+		net.IP{127, 0, 0, 1},
+		u,
+	}
+	for _, v := range values {
+		bts, err := AppendIntf(nil, v)
+		if err != nil {
+			t.Fatalf("%T: %s", v, err)
+		}
+		out, _, err := ReadIntfBytes(bts)
+		if err != nil {
+			t.Fatalf("%T: %s", v, err)
+		}
+		if reflect.TypeOf(out) != reflect.TypeOf(v) {
+			t.Errorf("put a %T in; got a %T out", v, out)
+		}
+
+		var buf bytes.Buffer
+		en := NewWriter(&buf)
+		if err := en.WriteIntf(v); err != nil {
+			t.Fatalf("%T: %s", v, err)
+		}
+		en.Flush()
+		out, err = NewReader(&buf).ReadIntf()
+		if err != nil {
+			t.Fatalf("%T: %s", v, err)
+		}
+		if reflect.TypeOf(out) != reflect.TypeOf(v) {
+			t.Errorf("put a %T in; got a %T out", v, out)
+		}
+	}
+}
+
+func TestStdTypesJSON(t *testing.T) {
+	u, _ := ParseUUID("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+	bts := AppendArrayHeader(nil, 5)
+	bts = AppendBigInt(bts, bigmath.NewInt(-42))
+	bts = AppendBigFloat(bts, bigmath.NewFloat(2.5))
+	bts = AppendBigRat(bts, bigmath.NewRat(1, 3))
+	bts = AppendIP(bts, net.IPv4(127, 0, 0, 1))
+	bts = AppendUUID(bts, u)
+	const want = `[-42,"2.5","1/3","127.0.0.1","6ba7b810-9dad-11d1-80b4-00c04fd430c8"]`
+
+	var js bytes.Buffer
+	if _, err := UnmarshalAsJSON(&js, bts); err != nil {
+		t.Fatal(err)
+	}
+	if js.String() != want {
+		t.Errorf("UnmarshalAsJSON: got %s", js.String())
+	}
+
+	js.Reset()
+	if _, err := CopyToJSON(&js, bytes.NewReader(bts)); err != nil {
+		t.Fatal(err)
+	}
+	if js.String() != want {
+		t.Errorf("CopyToJSON: got %s", js.String())
+	}
+}
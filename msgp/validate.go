@@ -0,0 +1,248 @@
+package msgp
+
+import (
+	"fmt"
+	"strconv"
+	"unicode/utf8"
+)
+
+// ValidateOptions is a set of checks done by Validate beyond checking that the input is
+// well-formed MessagePack.
+type ValidateOptions uint8
+
+const (
+	// RejectDuplicateKeys rejects maps that have the same key more than once. Keys that are
+	// strings or 'bin' data with the same bytes are duplicates, as are integer keys with the
+	// same value.
+	RejectDuplicateKeys ValidateOptions = 1 << iota
+
+	// RejectNonMinimal rejects integers, lengths, and sizes not encoded in the shortest
+	// form available. An integer is minimal if no shorter format of the same signedness
+	// (or a fixint) holds its value.
+	RejectNonMinimal
+
+	// RejectInvalidUTF8 rejects strings, including map keys, that are not valid UTF-8.
+	RejectInvalidUTF8
+
+	// RejectTrailingBytes rejects input that has bytes left over after the first object.
+	RejectTrailingBytes
+
+	// Strict enables all of the checks.
+	Strict = RejectDuplicateKeys | RejectNonMinimal | RejectInvalidUTF8 | RejectTrailingBytes
+)
+
+// maxValidateDepth is the deepest nesting of maps and arrays that Validate accepts.
+const maxValidateDepth = 10000
+
+// A ValidationError is returned by Validate to describe the first violation found.
+type ValidationError struct {
+	Offset int             // offset of the offending object in the input
+	Check  ValidateOptions // the check that failed, or 0 if the input is malformed
+	Reason string          // description of the violation
+}
+
+// Error implements the error interface.
+func (v *ValidationError) Error() string {
+	return fmt.Sprintf("msgp: invalid input at offset %d: %s", v.Offset, v.Reason)
+}
+
+// Resumable is always false for ValidationErrors.
+func (v *ValidationError) Resumable() bool { return false }
+
+// Validate checks that b begins with one well-formed MessagePack object and does the checks
+// in opts. The first violation found is returned as a *ValidationError.
+func Validate(b []byte, opts ValidateOptions) error {
+	v := validator{opts: opts, size: len(b)}
+	rest, err := v.next(b, 0)
+	if err != nil {
+		return err
+	}
+	if opts&RejectTrailingBytes != 0 && len(rest) > 0 {
+		return v.fail(rest, RejectTrailingBytes, fmt.Sprintf("%d bytes after the object", len(rest)))
+	}
+	return nil
+}
+
+// UnmarshalStrict checks b with Validate(b, Strict) and then unmarshals it into u.
+func UnmarshalStrict(b []byte, u Unmarshaler) error {
+	if err := Validate(b, Strict); err != nil {
+		return err
+	}
+	_, err := u.UnmarshalMsg(b)
+	return err
+}
+
+type validator struct {
+	opts ValidateOptions
+	size int // length of the whole input
+}
+
+// fail returns a *ValidationError for the object at the start of b.
+func (v *validator) fail(b []byte, check ValidateOptions, reason string) error {
+	return &ValidationError{Offset: v.size - len(b), Check: check, Reason: reason}
+}
+
+// next validates the object at the start of b and returns the bytes following it.
+func (v *validator) next(b []byte, depth int) ([]byte, error) {
+	sz, objects, err := getSize(b)
+	if err != nil {
+		return b, v.fail(b, 0, err.Error())
+	}
+	if uintptr(len(b)) < sz {
+		return b, v.fail(b, 0, ErrShortBytes.Error())
+	}
+	if v.opts&RejectNonMinimal != 0 {
+		if reason := nonMinimal(b, sz); reason != "" {
+			return b, v.fail(b, RejectNonMinimal, reason)
+		}
+	}
+	typ := getType(b[0])
+	if typ == StrType && v.opts&RejectInvalidUTF8 != 0 {
+		if s, _, _ := ReadStringZC(b); !utf8.Valid(s) {
+			return b, v.fail(b, RejectInvalidUTF8, "string is not valid UTF-8")
+		}
+	}
+	rest := b[sz:]
+	if objects == 0 {
+		return rest, nil
+	}
+	if depth >= maxValidateDepth {
+		return b, v.fail(b, 0, "objects nested too deeply")
+	}
+
+	if typ != MapType {
+		for ; objects > 0; objects-- {
+			if rest, err = v.next(rest, depth+1); err != nil {
+				return rest, err
+			}
+		}
+		return rest, nil
+	}
+
+	var keys map[string]struct{}
+	if v.opts&RejectDuplicateKeys != 0 {
+		keys = make(map[string]struct{}, objects/2)
+	}
+	for ; objects > 0; objects -= 2 {
+		key := rest
+		if rest, err = v.next(rest, depth+1); err != nil {
+			return rest, err
+		}
+		if keys != nil {
+			id := keyIdentity(key[:len(key)-len(rest)])
+			if _, ok := keys[id]; ok {
+				return rest, v.fail(key, RejectDuplicateKeys, "duplicate map key")
+			}
+			keys[id] = struct{}{}
+		}
+		if rest, err = v.next(rest, depth+1); err != nil {
+			return rest, err
+		}
+	}
+	return rest, nil
+}
+
+// keyIdentity returns a string that is the same for map keys that decoders treat as equal.
+func keyIdentity(key []byte) string {
+	switch getType(key[0]) {
+	case StrType, BinType:
+		s, _, _ := ReadMapKeyZC(key)
+		return "s" + string(s)
+	case IntType:
+		i, _, err := ReadInt64Bytes(key)
+		if err == nil {
+			return "i" + strconv.FormatInt(i, 10)
+		}
+		// A uint64 too big for an int64.
+		u, _, _ := ReadUint64Bytes(key)
+		return "i" + strconv.FormatUint(u, 10)
+	case UintType:
+		u, _, _ := ReadUint64Bytes(key)
+		return "i" + strconv.FormatUint(u, 10)
+	default:
+		return "r" + string(key)
+	}
+}
+
+// nonMinimal returns the reason that the object at the start of b, having size sz, is not
+// minimally encoded, or an empty string if it is.
+func nonMinimal(b []byte, sz uintptr) string {
+	switch lead := b[0]; lead {
+	case muint8, muint16, muint32, muint64:
+		u, _, _ := ReadUint64Bytes(b)
+		if uintptr(uintSize(u)) < sz {
+			return "integer is not minimally encoded"
+		}
+	case mint8, mint16, mint32, mint64:
+		i, _, _ := ReadInt64Bytes(b)
+		if uintptr(intSize(i)) < sz {
+			return "integer is not minimally encoded"
+		}
+	case mstr8:
+		if b[1] < 32 {
+			return "string length is not minimally encoded"
+		}
+	case mstr16, mbin16:
+		if big.Uint16(b[1:]) <= 0xff {
+			return "length is not minimally encoded"
+		}
+	case mstr32, mbin32:
+		if big.Uint32(b[1:]) <= 0xffff {
+			return "length is not minimally encoded"
+		}
+	case marray16, mmap16:
+		if big.Uint16(b[1:]) < 16 {
+			return "element count is not minimally encoded"
+		}
+	case marray32, mmap32:
+		if big.Uint32(b[1:]) <= 0xffff {
+			return "element count is not minimally encoded"
+		}
+	case mext8:
+		switch b[1] {
+		case 1, 2, 4, 8, 16:
+			return "extension length is not minimally encoded"
+		}
+	case mext16:
+		if big.Uint16(b[1:]) <= 0xff {
+			return "extension length is not minimally encoded"
+		}
+	case mext32:
+		if big.Uint32(b[1:]) <= 0xffff {
+			return "extension length is not minimally encoded"
+		}
+	}
+	return ""
+}
+
+// uintSize returns the size of the shortest unsigned (or positive fixint) encoding of u.
+func uintSize(u uint64) int {
+	switch {
+	case u <= 0x7f:
+		return 1
+	case u <= 0xff:
+		return 2
+	case u <= 0xffff:
+		return 3
+	case u <= 0xffffffff:
+		return 5
+	default:
+		return 9
+	}
+}
+
+// intSize returns the size of the shortest signed (or fixint) encoding of i.
+func intSize(i int64) int {
+	switch {
+	case i >= -32 && i <= 0x7f:
+		return 1
+	case i >= -1<<7 && i < 1<<7:
+		return 2
+	case i >= -1<<15 && i < 1<<15:
+		return 3
+	case i >= -1<<31 && i < 1<<31:
+		return 5
+	default:
+		return 9
+	}
+}
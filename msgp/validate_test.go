@@ -0,0 +1,140 @@
+package msgp
+
+import (
+	"bytes"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestValidateAcceptsOwnEncodings(t *testing.T) {
+	b := AppendArrayHeader(nil, 10)
+	b = AppendMapHeader(b, 16)
+	for i, v := range []int64{0, 127, 128, 255, 256, 32767, 32768, 1 << 40, -1, -32, -33, -128, -129, -40000, math.MinInt64} {
+		b = AppendInt(b, i)
+		b = AppendInt64(b, v)
+	}
+	b = AppendString(b, "u")
+	b = AppendArrayHeader(b, 6)
+	for _, u := range []uint64{0, 200, 60000, 1 << 20, 1 << 40, math.MaxUint64} {
+		b = AppendUint64(b, u)
+	}
+	var strs [5]string
+	b = AppendArrayHeader(b, uint32(len(strs)))
+	for i, n := range []int{0, 31, 32, 256, 70000} {
+		strs[i] = string(make([]byte, n))
+		b = AppendString(b, strs[i])
+	}
+	b = AppendBytes(b, make([]byte, 300))
+	b = AppendTime(b, time.Now())
+	for _, n := range []int{3, 8} {
+		var err error
+		if b, err = AppendExtension(b, &RawExtension{Type: 20, Data: make([]byte, n)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b = AppendArrayHeader(b, 20)
+	for i := 0; i < 20; i++ {
+		b = AppendNil(b)
+	}
+	b = AppendFloat32(b, 1)
+	b = AppendMapHeader(b, 1)
+	b = AppendUint(b, 1)
+	b = AppendInt(b, 2)
+	b = AppendBool(b, true)
+
+	if err := Validate(b, Strict); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateExtensionLengths(t *testing.T) {
+	for _, n := range []int{255, 256, 65535, 65536} {
+		x := &RawExtension{Type: 20, Data: make([]byte, n)}
+		b, err := AppendExtension(nil, x)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = Validate(b, Strict); err != nil {
+			t.Errorf("AppendExtension with %d bytes: %v", n, err)
+		}
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		if err = w.WriteExtension(x); err == nil {
+			err = w.Flush()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = Validate(buf.Bytes(), Strict); err != nil {
+			t.Errorf("WriteExtension with %d bytes: %v", n, err)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		name   string
+		in     []byte
+		check  ValidateOptions // 0 if the input is malformed
+		offset int
+	}{
+		{"truncated", []byte{0x92, 0x01}, 0, 2},
+		{"invalid prefix", []byte{0x91, 0xc1}, 0, 1},
+		{"duplicate key", []byte{0x83, 0xa1, 'a', 1, 0xa1, 'b', 2, 0xa1, 'a', 3}, RejectDuplicateKeys, 7},
+		{"duplicate str and bin key", []byte{0x82, 0xa1, 'a', 1, 0xc4, 1, 'a', 2}, RejectDuplicateKeys, 4},
+		{"duplicate int key", []byte{0x82, 0xcc, 200, 1, 0xd1, 0, 200, 2}, RejectDuplicateKeys, 4},
+		{"duplicate nested key", []byte{0x91, 0x82, 0xc0, 1, 0xc0, 2}, RejectDuplicateKeys, 4},
+		{"uint8 fixint", []byte{0xcc, 0x05}, RejectNonMinimal, 0},
+		{"int16 fits int8", []byte{0xd1, 0xff, 0x80}, RejectNonMinimal, 0},
+		{"uint32 fits uint16", []byte{0x91, 0xce, 0, 0, 0xff, 0xff}, RejectNonMinimal, 1},
+		{"str8 fits fixstr", []byte{0xd9, 1, 'a'}, RejectNonMinimal, 0},
+		{"bin16 fits bin8", []byte{0xc5, 0, 1, 'a'}, RejectNonMinimal, 0},
+		{"array16 fits fixarray", []byte{0xdc, 0, 1, 0xc0}, RejectNonMinimal, 0},
+		{"map32 fits map16", []byte{0xdf, 0, 0, 0, 0}, RejectNonMinimal, 0},
+		{"ext8 fits fixext", []byte{0xc7, 1, 5, 0}, RejectNonMinimal, 0},
+		{"invalid UTF-8", []byte{0x92, 0xa1, 'a', 0xa2, 0xff, 0xfe}, RejectInvalidUTF8, 3},
+		{"invalid UTF-8 key", []byte{0x81, 0xa1, 0x80, 0xc0}, RejectInvalidUTF8, 1},
+		{"trailing bytes", []byte{0x01, 0x02}, RejectTrailingBytes, 1},
+	}
+	for _, c := range cases {
+		err := Validate(c.in, Strict)
+		verr, ok := err.(*ValidationError)
+		if !ok {
+			t.Errorf("%s: expected a *ValidationError; got %v", c.name, err)
+			continue
+		}
+		if verr.Check != c.check || verr.Offset != c.offset {
+			t.Errorf("%s: got check %d at offset %d; want check %d at offset %d", c.name, verr.Check, verr.Offset, c.check, c.offset)
+		}
+		if c.check != 0 {
+			if err = Validate(c.in, Strict&^c.check); err != nil {
+				t.Errorf("%s: unexpected error without the check: %s", c.name, err)
+			}
+		}
+	}
+}
+
+func TestValidateDepth(t *testing.T) {
+	b := make([]byte, maxValidateDepth+2)
+	for i := range b {
+		b[i] = 0x91
+	}
+	b[len(b)-1] = 0xc0
+	if err := Validate(b, 0); err == nil {
+		t.Error("expected an error for deeply nested arrays")
+	}
+	if err := Validate(b[len(b)-maxValidateDepth:], 0); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUnmarshalStrict(t *testing.T) {
+	var r Raw
+	if err := UnmarshalStrict([]byte{0x81, 0xa1, 'a', 0xc0}, &r); err != nil {
+		t.Error(err)
+	}
+	if err := UnmarshalStrict([]byte{0x81, 0xa1, 'a', 0xc0, 0xc0}, &r); err == nil {
+		t.Error("expected an error for trailing bytes")
+	}
+}
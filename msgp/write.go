@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"io"
 	"math"
+	bigmath "math/big"
+	"net"
+	"net/netip"
 	"reflect"
 	"time"
 )
@@ -516,6 +519,7 @@ func (mw *Writer) WriteTime(t time.Time) error {
 // WriteIntf writes the concrete type of v. The type of v must
 // be one of the following:
 //  - bool, float, string, []byte, int, uint, complex, time.Time, or nil
+//  - time.Duration, *big.Int, *big.Float, *big.Rat, net.IP, netip.Addr, or UUID
 //  - map of supported types, with string keys
 //  - array or slice of supported types
 //  - pointer to a supported type
@@ -576,6 +580,20 @@ func (mw *Writer) WriteIntf(v interface{}) error {
 		return mw.WriteMapStrIntf(v)
 	case time.Time:
 		return mw.WriteTime(v)
+	case time.Duration:
+		return mw.WriteDuration(v)
+	case *bigmath.Int:
+		return mw.WriteBigInt(v)
+	case *bigmath.Float:
+		return mw.WriteBigFloat(v)
+	case *bigmath.Rat:
+		return mw.WriteBigRat(v)
+	case net.IP:
+		return mw.WriteIP(v)
+	case netip.Addr:
+		return mw.WriteIPAddr(v)
+	case UUID:
+		return mw.WriteUUID(v)
 	}
 
 	val := reflect.ValueOf(v)
@@ -679,6 +697,18 @@ func GuessSize(i interface{}) int {
 		return Complex128Size
 	case bool:
 		return BoolSize
+	case time.Duration:
+		return DurationSize
+	case *bigmath.Int:
+		return bigIntSize(i)
+	case *bigmath.Float:
+		return bigFloatSize(i)
+	case *bigmath.Rat:
+		return bigRatSize(i)
+	case net.IP, netip.Addr:
+		return IPSize
+	case UUID:
+		return UUIDSize
 	case map[string]interface{}:
 		s := MapHeaderSize
 		for key, val := range i {
@@ -2,6 +2,9 @@ package msgp
 
 import (
 	"math"
+	bigmath "math/big"
+	"net"
+	"net/netip"
 	"reflect"
 	"time"
 )
@@ -357,6 +360,20 @@ func AppendIntf(b []byte, i interface{}) ([]byte, error) {
 		return AppendUint64(b, i), nil
 	case time.Time:
 		return AppendTime(b, i), nil
+	case time.Duration:
+		return AppendDuration(b, i), nil
+	case *bigmath.Int:
+		return AppendBigInt(b, i), nil
+	case *bigmath.Float:
+		return AppendBigFloat(b, i), nil
+	case *bigmath.Rat:
+		return AppendBigRat(b, i), nil
+	case net.IP:
+		return AppendIP(b, i), nil
+	case netip.Addr:
+		return AppendIPAddr(b, i), nil
+	case UUID:
+		return AppendUUID(b, i), nil
 	case map[string]interface{}:
 		return AppendMapStrIntf(b, i)
 	case map[string]string:
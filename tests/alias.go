@@ -0,0 +1,17 @@
+package tests
+
+//go:generate msgp
+
+// Renamed has fields whose keys changed over time.
+type Renamed struct {
+	FullName string  `msgp:"full_name,alias=name|person_name"`
+	Age      int     `msgp:"age"`
+	Score    float64 `msgp:"score,alias=points"`
+}
+
+// RenamedV1 is an older version of Renamed.
+type RenamedV1 struct {
+	Name   string  `msgp:"name"`
+	Age    int     `msgp:"age"`
+	Points float64 `msgp:"points"`
+}
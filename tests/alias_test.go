@@ -0,0 +1,71 @@
+package tests
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/dchenk/msgp/msgp"
+)
+
+func TestFieldAliases(t *testing.T) {
+	old := RenamedV1{Name: "Ada", Age: 36, Points: 9.5}
+	bts, err := old.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var v Renamed
+	if _, err = v.UnmarshalMsg(bts); err != nil {
+		t.Fatal(err)
+	}
+	want := Renamed{FullName: "Ada", Age: 36, Score: 9.5}
+	if v != want {
+		t.Errorf("UnmarshalMsg: got %+v", v)
+	}
+
+	v = Renamed{}
+	if err = msgp.Decode(bytes.NewReader(bts), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v != want {
+		t.Errorf("DecodeMsg: got %+v", v)
+	}
+
+	// The older keys are accepted in any mix.
+	mixed := msgp.AppendMapHeader(nil, 2)
+	mixed = msgp.AppendString(mixed, "person_name")
+	mixed = msgp.AppendString(mixed, "Bob")
+	mixed = msgp.AppendString(mixed, "score")
+	mixed = msgp.AppendFloat64(mixed, 1)
+	v = Renamed{}
+	if _, err = v.UnmarshalMsg(mixed); err != nil {
+		t.Fatal(err)
+	}
+	if v.FullName != "Bob" || v.Score != 1 {
+		t.Errorf("got %+v", v)
+	}
+
+	// Only the primary names are written.
+	bts, err = want.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	sz, bts, err := msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for ; sz > 0; sz-- {
+		var key []byte
+		if key, bts, err = msgp.ReadMapKeyZC(bts); err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, string(key))
+		if bts, err = msgp.Skip(bts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(keys) != 3 || keys[0] != "full_name" || keys[1] != "age" || keys[2] != "score" {
+		t.Errorf("encoded keys %q", keys)
+	}
+}
@@ -0,0 +1,153 @@
+package tests
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dchenk/msgp/gen"
+)
+
+const compatOld = `package p
+
+//msgp:tuple Point
+//msgp:intkeys Keyed
+//msgp:enum Color
+
+type Event struct {
+	Name    string            ` + "`msgp:\"name\"`" + `
+	Count   int32             ` + "`msgp:\"count\"`" + `
+	Size    int64             ` + "`msgp:\"size\"`" + `
+	Score   float64           ` + "`msgp:\"score\"`" + `
+	Title   string            ` + "`msgp:\"title\"`" + `
+	Gone    bool              ` + "`msgp:\"gone\"`" + `
+	Tags    []string          ` + "`msgp:\"tags\"`" + `
+	Color   Color             ` + "`msgp:\"color\"`" + `
+	Attrs   map[string]int64  ` + "`msgp:\"attrs\"`" + `
+}
+
+type Point struct {
+	X float64
+	Y float64
+	Z int
+}
+
+type Keyed struct {
+	A string ` + "`msgp:\"a,id=1\"`" + `
+}
+
+type Color int
+
+const (
+	Red Color = iota
+	Green
+	Blue
+)
+
+type Removed struct {
+	A int
+}
+`
+
+const compatNew = `package p
+
+//msgp:tuple Point
+//msgp:intkeys Keyed
+//msgp:enum Color
+
+type Event struct {
+	Name    string            ` + "`msgp:\"name\"`" + `
+	Count   int64             ` + "`msgp:\"count\"`" + `
+	Size    int16             ` + "`msgp:\"size\"`" + `
+	Score   string            ` + "`msgp:\"score\"`" + `
+	Heading string            ` + "`msgp:\"heading,alias=title\"`" + `
+	Tags    []int             ` + "`msgp:\"tags\"`" + `
+	Color   Color             ` + "`msgp:\"color\"`" + `
+	Attrs   map[string]*int64 ` + "`msgp:\"attrs\"`" + `
+	Added   bool              ` + "`msgp:\"added\"`" + `
+}
+
+type Point struct {
+	Y float64
+	X float64
+}
+
+type Keyed struct {
+	B string ` + "`msgp:\"b,id=1\"`" + `
+}
+
+type Color int
+
+const (
+	Red Color = iota
+	Blue
+	Purple
+)
+`
+
+func TestCompat(t *testing.T) {
+	dir, err := ioutil.TempDir("", "msgp-compat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// The versions are in directories of their own, as the constants of enums are read from the
+	// whole package.
+	oldPath, newPath := filepath.Join(dir, "old", "types.go"), filepath.Join(dir, "new", "types.go")
+	for path, src := range map[string]string{oldPath: compatOld, newPath: compatNew} {
+		if err = os.Mkdir(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(path, []byte(src), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The changes that are breaking only if the old version must decode what the new one writes
+	// are marked false.
+	want := map[string]bool{
+		"Color: enum constants removed: Green":                                                                true,
+		"Color: enum constants added: Purple, which the old version rejects":                                  false,
+		"Event.attrs{}: now a pointer, so nil values cannot be decoded by the old version":                    false,
+		"Event.count: widened from int32 to int64, which the old version cannot always decode":                false,
+		"Event.gone: field removed":                                                                           true,
+		"Event.score: changed from float64 to string":                                                         true,
+		"Event.size: narrowed from int64 to int16, which cannot hold every old value":                         true,
+		"Event.tags[]: changed from string to int":                                                            true,
+		"Event.title: renamed to heading, which accepts the old key, but the old version ignores the new key": false,
+		"Point: tuple length changed from 3 to 2":                                                             true,
+		"Point[0]: field X moved to position 1":                                                               true,
+		"Point[1]: field Y moved to position 0":                                                               true,
+		"Removed: type removed":                                                                               true,
+	}
+	for _, both := range []bool{false, true} {
+		changes, err := gen.Compat(oldPath, newPath, gen.CompatOptions{Both: both})
+		if err != nil {
+			t.Fatal(err)
+		}
+		expect := map[string]bool{"Event.added: field added": true}
+		for c, breaking := range want {
+			if breaking || both {
+				c += " (breaking)"
+			}
+			expect[c] = true
+		}
+		for _, c := range changes {
+			if !expect[c.String()] {
+				t.Errorf("both=%v: unexpected change: %s", both, c)
+			}
+			delete(expect, c.String())
+		}
+		for c := range expect {
+			t.Errorf("both=%v: missing change: %s", both, c)
+		}
+		if !gen.Breaking(changes) {
+			t.Errorf("both=%v: expected breaking changes", both)
+		}
+	}
+
+	if changes, err := gen.Compat(newPath, newPath, gen.CompatOptions{Both: true}); err != nil || len(changes) != 0 {
+		t.Errorf("comparing a file with itself: %v, %v", changes, err)
+	}
+}
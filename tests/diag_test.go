@@ -0,0 +1,131 @@
+package tests
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dchenk/msgp/gen"
+)
+
+const diagSource = `package p
+
+type Event struct {
+	Name  string
+	Ch    chan int
+	Inner struct {
+		F func()
+	}
+	Count int ` + "`msgp:\"count,omitempty,id=x\"`" + `
+	Skip  chan bool ` + "`msgp:\"-\"`" + `
+}
+
+//msgp:strict Kind Missing
+
+type Kind int
+`
+
+func TestDiagnostics(t *testing.T) {
+	dir, err := ioutil.TempDir("", "msgp-diag")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "diag.go")
+	if err = ioutil.WriteFile(src, []byte(diagSource), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var diags gen.Diagnostics
+	opts := gen.Options{Mode: gen.Marshal | gen.Unmarshal}
+	opts.Report = func(d gen.Diagnostic) { diags = append(diags, d) }
+	out, _, err := opts.RunData(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out == nil {
+		t.Fatal("no code generated")
+	}
+	want := []string{
+		src + ":5:8: warning: Event.Ch: unsupported type chan int; the field is ignored",
+		src + ":7:5: warning: Event.Inner.F: unsupported type func(); the field is ignored",
+		src + ":9:12: warning: Event.Count: invalid field ID in \"id=x\"",
+		src + ":13:1: warning: Kind: only structs can be strict",
+		src + ":13:1: warning: Missing: cannot make unknown type strict",
+	}
+	if len(diags) != len(want) {
+		t.Fatalf("got diagnostics %q; want %q", diags, want)
+	}
+	for i, d := range diags {
+		if d.String() != want[i] {
+			t.Errorf("got %q; want %q", d, want[i])
+		}
+	}
+
+	opts.Strict = true
+	diags = nil
+	out, _, err = opts.RunData(src)
+	errs, ok := err.(gen.Diagnostics)
+	if !ok || len(errs) != 2 || errs[0].Severity != gen.Error || errs[0].Pos.Line != 5 {
+		t.Errorf("strict mode: got error %v", err)
+	}
+	if out != nil || len(diags) != 5 {
+		t.Errorf("strict mode: got %d diagnostics and output %v", len(diags), out != nil)
+	}
+}
+
+func TestFieldMaskLimit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "msgp-diag")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "mask.go")
+	var code strings.Builder
+	code.WriteString("package p\n\n//msgp:fieldmask Wide\n\ntype Wide struct {\n")
+	for i := 0; i < 65; i++ {
+		fmt.Fprintf(&code, "\tF%d int\n", i)
+	}
+	code.WriteString("}\n")
+	if err = ioutil.WriteFile(src, []byte(code.String()), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var diags gen.Diagnostics
+	opts := gen.Options{Mode: gen.Decode | gen.Unmarshal}
+	opts.Report = func(d gen.Diagnostic) { diags = append(diags, d) }
+	if _, _, err = opts.RunData(src); err != nil {
+		t.Fatal(err)
+	}
+	want := src + ":3:1: warning: Wide: only the first 64 of its 65 fields have mask bits; the others are always decoded"
+	if len(diags) != 1 || diags[0].String() != want {
+		t.Errorf("got diagnostics %q; want %q", diags, want)
+	}
+}
+
+func TestDuplicateAlias(t *testing.T) {
+	dir, err := ioutil.TempDir("", "msgp-diag")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "alias.go")
+	code := "package p\n\ntype A struct {\n\tB int `msgp:\"b\"`\n\tC int `msgp:\"c,alias=b\"`\n}\n"
+	if err = ioutil.WriteFile(src, []byte(code), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var diags gen.Diagnostics
+	opts := gen.Options{Mode: gen.Decode | gen.Unmarshal}
+	opts.Report = func(d gen.Diagnostic) { diags = append(diags, d) }
+	if _, _, err = opts.RunData(src); err != nil {
+		t.Fatal(err)
+	}
+	want := src + ":5:8: warning: A.C: alias \"b\" is already a key"
+	if len(diags) != 1 || diags[0].String() != want {
+		t.Errorf("got diagnostics %q; want %q", diags, want)
+	}
+}
@@ -0,0 +1,45 @@
+package tests
+
+//go:generate msgp
+
+//msgp:enum Color
+//msgp:enum Priority as:int
+//msgp:enum Level
+
+// Color is encoded as the names of its constants.
+type Color int
+
+// The colors.
+const (
+	Red Color = iota
+	Green
+	Blue
+
+	// Crimson is another name for Red; Red is the name encoded.
+	Crimson = Red
+)
+
+// Priority is encoded as an integer that must be one of its constants.
+type Priority uint8
+
+// The priorities.
+const (
+	Low    = Priority(1)
+	Normal = Priority(5)
+	High   = Priority(9)
+	// None is the zero value.
+	None Priority = 0
+)
+
+// Level has its constants in another file, enum_levels.go.
+type Level int8
+
+// Palette has enum fields.
+type Palette struct {
+	Main     Color
+	Accents  []Color
+	ByName   map[string]Color
+	Priority Priority
+	Ptr      *Color
+	Level    Level
+}
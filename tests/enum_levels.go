@@ -0,0 +1,11 @@
+package tests
+
+// The levels, declared apart from Level and its generated code.
+const (
+	LevelLow Level = iota - 1
+	LevelMid
+	LevelHigh
+
+	// levelMax is unexported but is still a constant of Level.
+	levelMax = LevelHigh + 1
+)
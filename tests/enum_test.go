@@ -0,0 +1,84 @@
+package tests
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/dchenk/msgp/msgp"
+)
+
+func TestEnums(t *testing.T) {
+	blue := Blue
+	in := Palette{
+		Main:     Crimson,
+		Accents:  []Color{Green, Blue},
+		ByName:   map[string]Color{"sky": Blue},
+		Priority: High,
+		Ptr:      &blue,
+		Level:    levelMax,
+	}
+	bts, err := in.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if in.Msgsize() < len(bts) {
+		t.Errorf("Msgsize %d is less than encoded length %d", in.Msgsize(), len(bts))
+	}
+
+	var out Palette
+	if _, err = out.UnmarshalMsg(bts); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("put %+v in; got %+v out", in, out)
+	}
+	out = Palette{}
+	if err = msgp.Decode(bytes.NewReader(bts), &out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("put %+v in; got %+v out", in, out)
+	}
+
+	// Colors are written as names and priorities as integers.
+	var js bytes.Buffer
+	if _, err = msgp.UnmarshalAsJSON(&js, bts); err != nil {
+		t.Fatal(err)
+	}
+	const want = `{"Main":"Red","Accents":["Green","Blue"],"ByName":{"sky":"Blue"},"Priority":9,"Ptr":"Blue","Level":"levelMax"}`
+	if js.String() != want {
+		t.Errorf("got %s", js.String())
+	}
+
+	// Values that are not constants are rejected in both directions.
+	bad := Palette{Main: Color(7)}
+	if _, err = bad.MarshalMsg(nil); err == nil {
+		t.Error("expected an error encoding an unknown Color")
+	}
+	if err = msgp.Encode(&js, &bad); err == nil {
+		t.Error("expected an error encoding an unknown Color")
+	}
+	for _, b := range [][]byte{
+		msgp.AppendString(msgp.AppendString(msgp.AppendMapHeader(nil, 1), "Main"), "Purple"),
+		msgp.AppendUint8(msgp.AppendString(msgp.AppendMapHeader(nil, 1), "Priority"), 3),
+	} {
+		_, err = out.UnmarshalMsg(b)
+		if _, ok := err.(msgp.EnumError); !ok {
+			t.Errorf("expected an EnumError; got %v", err)
+		}
+		err = msgp.Decode(bytes.NewReader(b), &out)
+		if _, ok := err.(msgp.EnumError); !ok {
+			t.Errorf("expected an EnumError; got %v", err)
+		}
+	}
+
+	var c Color
+	if err = msgp.Decode(bytes.NewReader(msgp.AppendString(nil, "Green")), &c); err != nil || c != Green {
+		t.Errorf("got %d, %v", c, err)
+	}
+	// Crimson has the value of Red, so it is decoded but never encoded.
+	if err = msgp.Decode(bytes.NewReader(msgp.AppendString(nil, "Crimson")), &c); err != nil || c != Red {
+		t.Errorf("got %d, %v for Crimson", c, err)
+	}
+}
@@ -0,0 +1,5 @@
+package tests
+
+// The types of idl_events.msgp are declared in the generated file idl_events_gen.go.
+
+//go:generate msgp -src idl_events.msgp
@@ -0,0 +1,131 @@
+package tests
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dchenk/msgp/gen"
+	"github.com/dchenk/msgp/msgp"
+)
+
+func TestIDLRoundTrip(t *testing.T) {
+	in := IDLEvent{
+		EventID: 7,
+		Level:   IDLError,
+		At:      time.Unix(1500000000, 0).UTC(),
+		Tags:    []string{"a", "b"},
+		Attrs:   map[string]string{"k": "v"},
+		Parent:  &IDLEvent{EventID: 6, Level: IDLInfo},
+		Point:   IDLPoint{X: 1, Y: 2},
+		Kinds:   []IDLKind{IDLKindA, IDLKindB},
+	}
+	b, err := in.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out IDLEvent
+	if _, err = out.UnmarshalMsg(b); err != nil {
+		t.Fatal(err)
+	}
+	out.At = out.At.UTC()
+	out.Parent.At = in.Parent.At
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("got %+v; want %+v", out, in)
+	}
+
+	// The keys are the field IDs and the level is written as its name.
+	key, rest, err := msgp.ReadInt64Bytes(b[1:])
+	if err != nil || key != 1 {
+		t.Fatalf("first key: %d, %v", key, err)
+	}
+	if _, rest, err = msgp.ReadInt64Bytes(rest); err != nil {
+		t.Fatal(err)
+	}
+	if _, rest, err = msgp.ReadInt64Bytes(rest); err != nil {
+		t.Fatal(err)
+	}
+	if level, _, err := msgp.ReadStringBytes(rest); err != nil || level != "IDLError" {
+		t.Errorf("level: %q, %v", level, err)
+	}
+	if IDLKindB != 2 {
+		t.Errorf("IDLKindB is %d", IDLKindB)
+	}
+}
+
+func TestIDLAliases(t *testing.T) {
+	b := msgp.AppendMapHeader(nil, 1)
+	b = msgp.AppendString(b, "person_name")
+	b = msgp.AppendString(b, "Ada")
+	var r IDLRenamed
+	if _, err := r.UnmarshalMsg(b); err != nil {
+		t.Fatal(err)
+	}
+	if r.FullName != "Ada" {
+		t.Errorf("FullName is %q", r.FullName)
+	}
+}
+
+func TestIDLStdTypes(t *testing.T) {
+	in := IDLStd{
+		UserID: msgp.UUID{1, 2, 3},
+		Amount: big.NewInt(-42),
+		Ratio:  big.NewRat(1, 3),
+		Scale:  big.NewFloat(2.5),
+		Addr:   net.IPv4(10, 0, 0, 1),
+	}
+	b, err := in.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(b, msgp.AppendString(nil, "user-id")) {
+		t.Errorf("the key user-id is not in %x", b)
+	}
+	var out IDLStd
+	if _, err = out.UnmarshalMsg(b); err != nil {
+		t.Fatal(err)
+	}
+	if out.UserID != in.UserID || out.Amount.Cmp(in.Amount) != 0 || out.Ratio.Cmp(in.Ratio) != 0 ||
+		out.Scale.Cmp(in.Scale) != 0 || !out.Addr.Equal(in.Addr) {
+		t.Errorf("got %+v; want %+v", out, in)
+	}
+}
+
+func TestIDLErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "msgp-idl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cases := []struct {
+		src string
+		err string
+	}{
+		{"package p\nmessage A {\n  b Missing\n}\n", "bad.msgp:3:5: undefined type Missing"},
+		{"package p\nmessage A intkeys {\n  b int = 1\n  c int\n}\n", "bad.msgp:4:3: field c of an intkeys message has no ID"},
+		{"package p\nmessage A {\n  b map[int]int\n}\n", "bad.msgp:3:5: map keys must be strings"},
+		{"package p\nenum E {\n}\n", "bad.msgp:3:1: enum E has no constants"},
+		{"package p\nmessage a {\n}\n", "bad.msgp:2:9: type name a must begin with an upper-case letter"},
+		{"package p\nmessage A {\n  b int c\n}\n", "bad.msgp:3:9: expected newline"},
+		{"package p\nmessage A {\n  \"1st\" int\n}\n", "bad.msgp:3:3: cannot make an exported Go name of field 1st"},
+		{"package p\nmessage A {\n  \"a,b\" int\n}\n", "bad.msgp:3:3: invalid key \"a,b\""},
+	}
+	path := filepath.Join(dir, "bad.msgp")
+	for _, c := range cases {
+		if err = ioutil.WriteFile(path, []byte(c.src), 0600); err != nil {
+			t.Fatal(err)
+		}
+		_, _, err = gen.RunData(path, gen.Marshal|gen.Unmarshal, false)
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%q: got error %v; want %q", c.src, err, c.err)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package tests
+
+//go:generate msgp
+
+//msgp:intkeys IntKeyed IntKeyedInner IntKeyedV2
+
+// IntKeyed is encoded as a map with integer keys.
+type IntKeyed struct {
+	Name   string            `msgp:"name,id=1"`
+	Count  int64             `msgp:"2"`
+	Inner  IntKeyedInner     `msgp:"inner,id=3"`
+	Labels map[string]string `msgp:"labels,id=10"`
+	Nested *IntKeyed         `msgp:"nested,id=11"`
+}
+
+// IntKeyedInner is inlined into IntKeyed.
+type IntKeyedInner struct {
+	Flag bool `msgp:"0"`
+}
+
+// IntKeyedV2 is a later version of IntKeyed with a field removed and a field added.
+type IntKeyedV2 struct {
+	Name  string  `msgp:"name,id=1"`
+	Score float64 `msgp:"score,id=4"`
+}
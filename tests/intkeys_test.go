@@ -0,0 +1,67 @@
+package tests
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/dchenk/msgp/msgp"
+)
+
+func TestIntKeys(t *testing.T) {
+	in := IntKeyed{
+		Name:   "a",
+		Count:  -5,
+		Inner:  IntKeyedInner{Flag: true},
+		Labels: map[string]string{"x": "y"},
+		Nested: &IntKeyed{Name: "b"},
+	}
+	bts, err := in.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if in.Msgsize() < len(bts) {
+		t.Errorf("Msgsize %d is less than encoded length %d", in.Msgsize(), len(bts))
+	}
+
+	// The keys are integers.
+	sz, rest, err := msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sz != 5 || msgp.NextType(rest) != msgp.IntType {
+		t.Fatalf("got a map of %d with %s keys", sz, msgp.NextType(rest))
+	}
+
+	var out IntKeyed
+	if _, err = out.UnmarshalMsg(bts); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("UnmarshalMsg: put %+v in; got %+v out", in, out)
+	}
+
+	var buf bytes.Buffer
+	if err = msgp.Encode(&buf, &in); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), bts) {
+		t.Error("EncodeMsg and MarshalMsg encodings differ")
+	}
+	out = IntKeyed{}
+	if err = msgp.Decode(&buf, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("DecodeMsg: put %+v in; got %+v out", in, out)
+	}
+
+	// Unknown IDs are skipped.
+	var v2 IntKeyedV2
+	if _, err = v2.UnmarshalMsg(bts); err != nil {
+		t.Fatal(err)
+	}
+	if v2.Name != "a" || v2.Score != 0 {
+		t.Errorf("got %+v", v2)
+	}
+}
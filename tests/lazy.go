@@ -0,0 +1,17 @@
+package tests
+
+import "github.com/dchenk/msgp/msgp"
+
+//go:generate msgp
+
+// LazyEnvelope has a payload that is decoded only when it is needed.
+type LazyEnvelope struct {
+	ID      string    `msgp:"id"`
+	Payload msgp.Lazy `msgp:"payload,lazy=LazyPayload"`
+}
+
+// LazyPayload is the payload of a LazyEnvelope.
+type LazyPayload struct {
+	Items []string `msgp:"items"`
+	Count int      `msgp:"count"`
+}
@@ -0,0 +1,99 @@
+package tests
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dchenk/msgp/gen"
+	"github.com/dchenk/msgp/msgp"
+)
+
+func TestLazyField(t *testing.T) {
+	in := LazyEnvelope{ID: "e1"}
+	in.Payload.Set(&LazyPayload{Items: []string{"a", "b"}, Count: 2})
+	b, err := in.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out LazyEnvelope
+	if _, err = out.UnmarshalMsg(b); err != nil {
+		t.Fatal(err)
+	}
+	if out.ID != "e1" || out.Payload.Decoded() || len(out.Payload.Raw()) == 0 {
+		t.Fatalf("the payload was decoded or not kept: %+v", out)
+	}
+
+	// The untouched payload is written again verbatim.
+	again, err := out.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(again, b) {
+		t.Errorf("re-encoded as %x; want %x", again, b)
+	}
+
+	p, err := out.PayloadValue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(*p, LazyPayload{Items: []string{"a", "b"}, Count: 2}) {
+		t.Errorf("decoded %+v", p)
+	}
+	if again, err := out.PayloadValue(); again != p || err != nil {
+		t.Errorf("PayloadValue gave %p, %v on the second call; want %p", again, err, p)
+	}
+	p.Count = 3
+	if b, err = out.MarshalMsg(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err = msgp.Encode(&buf, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), b) {
+		t.Errorf("EncodeMsg wrote %x; MarshalMsg wrote %x", buf.Bytes(), b)
+	}
+	var dec LazyEnvelope
+	if err = msgp.Decode(&buf, &dec); err != nil {
+		t.Fatal(err)
+	}
+	if p, err = dec.PayloadValue(); err != nil || p.Count != 3 {
+		t.Errorf("decoded %+v, %v after a change", p, err)
+	}
+
+	var empty LazyEnvelope
+	if p, err = empty.PayloadValue(); p != nil || err != nil {
+		t.Errorf("got %+v, %v for a nil payload", p, err)
+	}
+}
+
+func TestLazyFieldType(t *testing.T) {
+	dir, err := ioutil.TempDir("", "msgp-lazy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "lazy.go")
+	for field, want := range map[string]string{
+		"B []byte `msgp:\"b,lazy=T\"`":      "lazy.go:4:4: error: A.B: lazy fields must be of type msgp.Lazy, not []byte",
+		"B msgp.Lazy `msgp:\"b,lazy\"`":     "lazy.go:4:14: error: A.B: the lazy option needs the type to decode into, as in lazy=T, on a field of type msgp.Lazy",
+		"B T `msgp:\"b,lazy\"`":             "lazy.go:4:6: error: A.B: the lazy option needs the type to decode into, as in lazy=T, on a field of type msgp.Lazy",
+		"B msgp.Lazy `msgp:\"b,lazy=[]T\"`": "lazy.go:4:14: error: A.B: invalid type name in \"lazy=[]T\"",
+	} {
+		code := "package p\n\ntype A struct {\n\t" + field + "\n}\n"
+		if err = ioutil.WriteFile(src, []byte(code), 0600); err != nil {
+			t.Fatal(err)
+		}
+		_, _, err = gen.RunData(src, gen.Marshal|gen.Unmarshal, false)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: got error %v; want %s", field, err, want)
+		}
+	}
+}
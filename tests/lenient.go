@@ -0,0 +1,36 @@
+package tests
+
+//go:generate msgp
+
+//msgp:lenient Lenient LenientList LenientOuter
+
+// Lenient is decoded with lenient type conversions.
+type Lenient struct {
+	Count  int32
+	Ratio  float32
+	Big    uint64
+	Name   string
+	Data   []byte
+	Inner  LenientInner
+	Scores map[string]float64
+}
+
+// LenientInner is inlined into Lenient.
+type LenientInner struct {
+	Level uint8
+}
+
+// LenientList is a lenient slice type.
+type LenientList []int16
+
+// LenientOuter is lenient, but RenamedV1 is declared in another file and keeps decoding
+// strictly inside of it.
+type LenientOuter struct {
+	Count int32
+	Other RenamedV1
+}
+
+// Strict is not named in a lenient directive, so it is decoded strictly.
+type Strict struct {
+	Count int32
+}
@@ -0,0 +1,108 @@
+package tests
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/dchenk/msgp/msgp"
+)
+
+// looseLenient returns a Lenient encoded the way a less particular encoder might write it.
+func looseLenient() []byte {
+	b := msgp.AppendMapHeader(nil, 7)
+	b = msgp.AppendString(b, "Count")
+	b = msgp.AppendFloat64(b, 12)
+	b = msgp.AppendString(b, "Ratio")
+	b = msgp.AppendInt64(b, 3)
+	b = msgp.AppendString(b, "Big")
+	b = msgp.AppendFloat64(b, 1<<40)
+	b = msgp.AppendString(b, "Name")
+	b = msgp.AppendBytes(b, []byte("abc"))
+	b = msgp.AppendString(b, "Data")
+	b = msgp.AppendString(b, "xyz")
+	b = msgp.AppendString(b, "Inner")
+	b = msgp.AppendMapHeader(b, 1)
+	b = msgp.AppendString(b, "Level")
+	b = msgp.AppendInt64(b, 9)
+	b = msgp.AppendString(b, "Scores")
+	b = msgp.AppendMapHeader(b, 1)
+	b = msgp.AppendString(b, "a")
+	b = msgp.AppendUint64(b, 5)
+	return b
+}
+
+func checkLenient(t *testing.T, v *Lenient) {
+	t.Helper()
+	if v.Count != 12 || v.Ratio != 3 || v.Big != 1<<40 || v.Name != "abc" || string(v.Data) != "xyz" ||
+		v.Inner.Level != 9 || v.Scores["a"] != 5 {
+		t.Errorf("decoded %+v", v)
+	}
+}
+
+func TestLenientUnmarshal(t *testing.T) {
+	var v Lenient
+	if _, err := v.UnmarshalMsg(looseLenient()); err != nil {
+		t.Fatal(err)
+	}
+	checkLenient(t, &v)
+
+	var list LenientList
+	b := msgp.AppendArrayHeader(nil, 2)
+	b = msgp.AppendFloat64(b, 1)
+	b = msgp.AppendFloat64(b, 1.5)
+	if _, err := list.UnmarshalMsg(b); err == nil {
+		t.Error("expected an error decoding 1.5 as an int16")
+	}
+}
+
+func TestLenientDecode(t *testing.T) {
+	rd := msgp.NewReader(bytes.NewReader(looseLenient()))
+	var v Lenient
+	if err := v.DecodeMsg(rd); err != nil {
+		t.Fatal(err)
+	}
+	checkLenient(t, &v)
+	if rd.Lenient {
+		t.Error("DecodeMsg did not restore the Reader's Lenient setting")
+	}
+}
+
+func TestStrictNotLenient(t *testing.T) {
+	b := msgp.AppendMapHeader(nil, 1)
+	b = msgp.AppendString(b, "Count")
+	b = msgp.AppendFloat64(b, 12)
+	var v Strict
+	if _, err := v.UnmarshalMsg(b); err == nil {
+		t.Error("expected an error decoding a float as an int32")
+	}
+	if err := v.DecodeMsg(msgp.NewReader(bytes.NewReader(b))); err == nil {
+		t.Error("expected an error decoding a float as an int32")
+	}
+}
+
+func TestLenientNotInherited(t *testing.T) {
+	b := msgp.AppendMapHeader(nil, 2)
+	b = msgp.AppendString(b, "Count")
+	b = msgp.AppendFloat64(b, 12)
+	b = msgp.AppendString(b, "Other")
+	b = msgp.AppendMapHeader(b, 1)
+	b = msgp.AppendString(b, "age")
+	b = msgp.AppendFloat64(b, 30)
+	var v LenientOuter
+	if _, err := v.UnmarshalMsg(b); err == nil {
+		t.Error("UnmarshalMsg decoded a float as the int of a type that is not lenient")
+	}
+	if err := v.DecodeMsg(msgp.NewReader(bytes.NewReader(b))); err == nil {
+		t.Error("DecodeMsg decoded a float as the int of a type that is not lenient")
+	}
+
+	b = msgp.AppendMapHeader(nil, 1)
+	b = msgp.AppendString(b, "Count")
+	b = msgp.AppendFloat64(b, 12)
+	if _, err := v.UnmarshalMsg(b); err != nil || v.Count != 12 {
+		t.Errorf("UnmarshalMsg gave %d, %v", v.Count, err)
+	}
+	if err := v.DecodeMsg(msgp.NewReader(bytes.NewReader(b))); err != nil || v.Count != 12 {
+		t.Errorf("DecodeMsg gave %d, %v", v.Count, err)
+	}
+}
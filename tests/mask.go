@@ -0,0 +1,48 @@
+package tests
+
+//go:generate msgp
+
+//msgp:fieldmask MaskRecord MaskUser MaskPart MaskPoint MaskIntKeyed
+//msgp:tuple MaskPoint
+//msgp:intkeys MaskIntKeyed
+
+// MaskRecord is a wide record of which readers need only a few fields.
+type MaskRecord struct {
+	ID     string               `msgp:"id"`
+	Owner  MaskUser             `msgp:"owner"`
+	Tags   []string             `msgp:"tags"`
+	Body   []byte               `msgp:"body"`
+	Parts  []MaskPart           `msgp:"parts"`
+	Index  map[string]*MaskPart `msgp:"index"`
+	Origin *MaskPoint           `msgp:"origin"`
+	Extra  struct {
+		Note string `msgp:"note"`
+	} `msgp:"extra"`
+}
+
+// MaskUser is inlined into MaskRecord.
+type MaskUser struct {
+	Name  string `msgp:"name"`
+	Email string `msgp:"email"`
+}
+
+// MaskPart is complex enough not to be inlined, so it is decoded with its own methods.
+type MaskPart struct {
+	Name   string            `msgp:"name"`
+	Size   int64             `msgp:"size"`
+	Labels map[string]string `msgp:"labels"`
+	Data   []byte            `msgp:"data"`
+	Links  []string          `msgp:"links"`
+	Sums   map[string]uint64 `msgp:"sums"`
+}
+
+// MaskPoint is a tuple with a field mask.
+type MaskPoint struct {
+	X, Y, Z float64
+}
+
+// MaskIntKeyed has a field mask and integer keys.
+type MaskIntKeyed struct {
+	A string `msgp:"1"`
+	B string `msgp:"2"`
+}
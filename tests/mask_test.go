@@ -0,0 +1,94 @@
+package tests
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/dchenk/msgp/msgp"
+)
+
+func maskRecord() *MaskRecord {
+	r := &MaskRecord{
+		ID:     "r1",
+		Owner:  MaskUser{Name: "ann", Email: "ann@example.com"},
+		Tags:   []string{"a", "b"},
+		Body:   []byte("body"),
+		Parts:  []MaskPart{{Name: "p1", Size: 10, Links: []string{"x"}}, {Name: "p2", Size: 20}},
+		Index:  map[string]*MaskPart{"p1": {Name: "p1", Size: 10}},
+		Origin: &MaskPoint{X: 1, Y: 2, Z: 3},
+	}
+	r.Extra.Note = "note"
+	return r
+}
+
+// maskWant is what decoding maskRecord with maskTestMask gives.
+func maskWant() MaskRecord {
+	return MaskRecord{
+		ID:     "r1",
+		Owner:  MaskUser{Name: "ann"},
+		Parts:  []MaskPart{{Size: 10}, {Size: 20}},
+		Index:  map[string]*MaskPart{"p1": {Name: "p1", Size: 10}},
+		Origin: &MaskPoint{Y: 2},
+	}
+}
+
+var maskTestMask = msgp.Fields(MaskRecordFieldID|MaskRecordFieldIndex).
+	With(MaskRecordFieldOwner, msgp.Fields(MaskUserFieldName)).
+	With(MaskRecordFieldParts, msgp.Fields(MaskPartFieldSize)).
+	With(MaskRecordFieldOrigin, msgp.Fields(MaskPointFieldY))
+
+func TestUnmarshalMsgFields(t *testing.T) {
+	b, err := maskRecord().MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out MaskRecord
+	left, err := out.UnmarshalMsgFields(b, maskTestMask)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(left) != 0 {
+		t.Errorf("%d bytes left", len(left))
+	}
+	if want := maskWant(); !reflect.DeepEqual(out, want) {
+		t.Errorf("decoded\n%+v\nwant\n%+v", out, want)
+	}
+
+	// All the fields are decoded with msgp.AllFields.
+	out = MaskRecord{}
+	if _, err = out.UnmarshalMsgFields(b, msgp.AllFields); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&out, maskRecord()) {
+		t.Errorf("decoded %+v with all fields", out)
+	}
+}
+
+func TestDecodeMsgFields(t *testing.T) {
+	var buf bytes.Buffer
+	if err := msgp.Encode(&buf, maskRecord()); err != nil {
+		t.Fatal(err)
+	}
+	var out MaskRecord
+	if err := out.DecodeMsgFields(msgp.NewReader(&buf), maskTestMask); err != nil {
+		t.Fatal(err)
+	}
+	if want := maskWant(); !reflect.DeepEqual(out, want) {
+		t.Errorf("decoded\n%+v\nwant\n%+v", out, want)
+	}
+}
+
+func TestFieldMaskKeepsUnselected(t *testing.T) {
+	b, err := (&MaskIntKeyed{A: "new a", B: "new b"}).MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := MaskIntKeyed{A: "old a", B: "old b"}
+	if _, err = out.UnmarshalMsgFields(b, msgp.Fields(MaskIntKeyedFieldB)); err != nil {
+		t.Fatal(err)
+	}
+	if out.A != "old a" || out.B != "new b" {
+		t.Errorf("decoded %+v", out)
+	}
+}
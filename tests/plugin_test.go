@@ -0,0 +1,124 @@
+package tests
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dchenk/msgp/gen"
+)
+
+// keysGen is a generator that prints a method returning the keys of a struct's fields.
+type keysGen struct {
+	w      io.Writer
+	passes []gen.TransformPass
+	only   map[string]bool // the types named in keys directives
+}
+
+func (k *keysGen) Method() gen.Method { return 0 }
+
+func (k *keysGen) Add(p gen.TransformPass) { k.passes = append(k.passes, p) }
+
+func (k *keysGen) Execute(e gen.Elem) error {
+	e = gen.ApplyPasses(k.passes, e)
+	st, ok := e.(*gen.Struct)
+	if !ok || !k.only[st.TypeName()] {
+		return nil
+	}
+	keys := make([]string, len(st.Fields))
+	for i := range st.Fields {
+		keys[i] = fmt.Sprintf("%q", st.Fields[i].Key())
+	}
+	_, err := fmt.Fprintf(k.w, "\nfunc (%s) MsgKeys() []string { return []string{%s} }\n", st.TypeName(), strings.Join(keys, ", "))
+	return err
+}
+
+func TestOptionsPlugins(t *testing.T) {
+	kg := &keysGen{only: make(map[string]bool)}
+	opts := gen.Options{
+		Mode: gen.Marshal | gen.Unmarshal | gen.Size,
+		Generators: []func(out, tests io.Writer) gen.Generator{
+			func(out, tests io.Writer) gen.Generator {
+				kg.w = out
+				return kg
+			},
+		},
+		Passes: []gen.TransformPass{gen.IgnoreTypename("RenamedV1")},
+		Directives: map[string]gen.DirectiveHandler{
+			"keys": func(args []string, types map[string]gen.Elem) error {
+				for _, name := range args[1:] {
+					if _, ok := types[name]; !ok {
+						return fmt.Errorf("unknown type %s", name)
+					}
+					kg.only[name] = true
+				}
+				return nil
+			},
+		},
+		Imports: []string{"sort"},
+	}
+
+	dir, err := ioutil.TempDir("", "msgp-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "plugin.go")
+	err = ioutil.WriteFile(src, []byte(`package p
+
+//msgp:keys Renamed RenamedV1
+
+type Renamed struct {
+	FullName string  `+"`msgp:\"full_name\"`"+`
+	Score    float64 `+"`msgp:\"score\"`"+`
+}
+
+type RenamedV1 struct {
+	Name string
+}
+`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, tests, err := opts.RunData(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tests != nil {
+		t.Error("expected no test file")
+	}
+	code := out.String()
+	for _, want := range []string{
+		`func (Renamed) MsgKeys() []string { return []string{"full_name", "score"} }`,
+		`Renamed) MarshalMsg(`,
+		`"sort"`,
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("the generated code does not contain %s", want)
+		}
+	}
+	for _, unwanted := range []string{"RenamedV1) MsgKeys", "RenamedV1) MarshalMsg"} {
+		if strings.Contains(code, unwanted) {
+			t.Errorf("the generated code contains %s", unwanted)
+		}
+	}
+
+	// Custom generators can run without any built-in methods.
+	opts.Mode = 0
+	if _, _, err = opts.RunData(src); err != nil {
+		t.Error(err)
+	}
+
+	// The names of built-in directives cannot be used.
+	for _, name := range []string{"tuple", "encode"} {
+		opts.Directives = map[string]gen.DirectiveHandler{name: opts.Directives["keys"]}
+		if _, _, err = opts.RunData(src); err == nil {
+			t.Errorf("no error for a directive named %s", name)
+		}
+	}
+}
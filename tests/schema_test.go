@@ -0,0 +1,113 @@
+package tests
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/dchenk/msgp/gen"
+)
+
+func TestSchema(t *testing.T) {
+	for _, file := range []string{"./alias.go", "./enum.go", "./intkeys.go", "./def.go"} {
+		doc, err := gen.Schema(file, false)
+		if err != nil {
+			t.Fatalf("%s: %s", file, err)
+		}
+		var v interface{}
+		if err = json.Unmarshal(doc, &v); err != nil {
+			t.Fatalf("%s: %s", file, err)
+		}
+	}
+
+	doc, err := gen.Schema("./alias.go", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema struct {
+		Defs map[string]struct {
+			Type       string `json:"type"`
+			Layout     string `json:"x-msgp-layout"`
+			Properties map[string]struct {
+				Type    string   `json:"x-msgp-type"`
+				GoName  string   `json:"x-go-name"`
+				Aliases []string `json:"x-msgp-aliases"`
+				Enum    []string `json:"enum"`
+				Ref     string   `json:"$ref"`
+				IntEnum []string `json:"x-msgp-enum"`
+				Ext     int      `json:"x-msgp-ext"`
+				Maximum uint64   `json:"maximum"`
+				AnyOf   []struct {
+					Ref string `json:"$ref"`
+				} `json:"anyOf"`
+			} `json:"properties"`
+		} `json:"$defs"`
+	}
+	if err = json.Unmarshal(doc, &schema); err != nil {
+		t.Fatal(err)
+	}
+	renamed := schema.Defs["Renamed"]
+	if renamed.Type != "object" || renamed.Layout != "map" {
+		t.Errorf("Renamed is a %q with layout %q", renamed.Type, renamed.Layout)
+	}
+	name := renamed.Properties["full_name"]
+	if name.Type != "str" || name.GoName != "FullName" || !reflect.DeepEqual(name.Aliases, []string{"name", "person_name"}) {
+		t.Errorf("full_name: %+v", name)
+	}
+	if renamed.Properties["score"].Type != "float64" {
+		t.Errorf("score: %+v", renamed.Properties["score"])
+	}
+
+	doc, err = gen.Schema("./enum.go", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = json.Unmarshal(doc, &schema); err != nil {
+		t.Fatal(err)
+	}
+	palette := schema.Defs["Palette"].Properties
+	if palette["Main"].Ref != "#/$defs/Color" {
+		t.Errorf("Main: %+v", palette["Main"])
+	}
+	if len(palette["Ptr"].AnyOf) != 2 || palette["Ptr"].AnyOf[0].Ref != "#/$defs/Color" {
+		t.Errorf("Ptr: %+v", palette["Ptr"])
+	}
+
+	var enums struct {
+		Defs map[string]struct {
+			Type    string        `json:"x-msgp-type"`
+			Enum    []interface{} `json:"enum"`
+			IntEnum []string      `json:"x-msgp-enum"`
+			Maximum uint64        `json:"maximum"`
+		} `json:"$defs"`
+	}
+	if err = json.Unmarshal(doc, &enums); err != nil {
+		t.Fatal(err)
+	}
+	if c := enums.Defs["Color"]; c.Type != "str" || !reflect.DeepEqual(c.Enum, []interface{}{"Red", "Green", "Blue", "Crimson"}) {
+		t.Errorf("Color: %+v", c)
+	}
+	p := enums.Defs["Priority"]
+	if p.Type != "uint" || p.Maximum != 255 || !reflect.DeepEqual(p.Enum, []interface{}{1.0, 5.0, 9.0, 0.0}) ||
+		!reflect.DeepEqual(p.IntEnum, []string{"Low", "Normal", "High", "None"}) {
+		t.Errorf("Priority: %+v", p)
+	}
+
+	doc, err = gen.Schema("./intkeys.go", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var intkeys struct {
+		Defs map[string]struct {
+			Layout     string                     `json:"x-msgp-layout"`
+			Properties map[string]json.RawMessage `json:"properties"`
+		} `json:"$defs"`
+	}
+	if err = json.Unmarshal(doc, &intkeys); err != nil {
+		t.Fatal(err)
+	}
+	ik := intkeys.Defs["IntKeyed"]
+	if ik.Layout != "intkeys" || len(ik.Properties) != 5 || ik.Properties["10"] == nil {
+		t.Errorf("IntKeyed: %+v", ik)
+	}
+}
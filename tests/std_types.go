@@ -0,0 +1,26 @@
+package tests
+
+import (
+	"math/big"
+	"net"
+	"net/netip"
+	"time"
+
+	"github.com/dchenk/msgp/msgp"
+)
+
+//go:generate msgp
+
+// StdTypes has fields of the standard library types encoded with the built-in extensions.
+type StdTypes struct {
+	Int      *big.Int
+	Float    *big.Float
+	Rat      *big.Rat
+	Timeout  time.Duration
+	Addr     net.IP
+	AddrPort netip.Addr
+	ID       msgp.UUID
+	Ints     []*big.Int
+	Peers    map[string]netip.Addr
+	Backoff  [3]time.Duration
+}
@@ -0,0 +1,68 @@
+package tests
+
+import (
+	"bytes"
+	"math/big"
+	"net"
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dchenk/msgp/msgp"
+)
+
+func stdTypesValue() *StdTypes {
+	id, _ := msgp.ParseUUID("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+	return &StdTypes{
+		Int:      big.NewInt(-1 << 40),
+		Float:    new(big.Float).SetPrec(100).SetFloat64(1.25),
+		Rat:      big.NewRat(-2, 3),
+		Timeout:  3 * time.Second,
+		Addr:     net.IP{10, 1, 2, 3},
+		AddrPort: netip.MustParseAddr("2001:db8::1"),
+		ID:       id,
+		Ints:     []*big.Int{big.NewInt(1), nil, big.NewInt(-7)},
+		Peers:    map[string]netip.Addr{"a": netip.MustParseAddr("127.0.0.1")},
+		Backoff:  [3]time.Duration{time.Millisecond, time.Second, time.Minute},
+	}
+}
+
+func TestStdTypesMarshal(t *testing.T) {
+	in := stdTypesValue()
+	bts, err := in.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bts) > in.Msgsize() {
+		t.Errorf("Msgsize() is %d but the encoded length is %d", in.Msgsize(), len(bts))
+	}
+	out := new(StdTypes)
+	left, err := out.UnmarshalMsg(bts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(left) != 0 {
+		t.Errorf("%d bytes left over", len(left))
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("put %+v in; got %+v out", in, out)
+	}
+}
+
+func TestStdTypesEncode(t *testing.T) {
+	in := stdTypesValue()
+	var buf bytes.Buffer
+	w := msgp.NewWriter(&buf)
+	if err := in.EncodeMsg(w); err != nil {
+		t.Fatal(err)
+	}
+	w.Flush()
+	out := new(StdTypes)
+	if err := out.DecodeMsg(msgp.NewReader(&buf)); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("put %+v in; got %+v out", in, out)
+	}
+}
@@ -0,0 +1,12 @@
+package tests
+
+//go:generate msgp
+
+//msgp:strict StrictInput
+
+// StrictInput validates its input strictly in UnmarshalMsg.
+type StrictInput struct {
+	Name  string
+	Count int64
+	Tags  map[string]string
+}
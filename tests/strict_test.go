@@ -0,0 +1,49 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/dchenk/msgp/msgp"
+)
+
+func TestStrictUnmarshal(t *testing.T) {
+	in := StrictInput{Name: "a", Count: 300, Tags: map[string]string{"k": "v"}}
+	bts, err := in.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out StrictInput
+	left, err := out.UnmarshalMsg(append(bts, 0xc0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(left) != 1 || out.Name != in.Name || out.Count != in.Count || out.Tags["k"] != "v" {
+		t.Errorf("decoded %+v with %d bytes left", out, len(left))
+	}
+
+	// The same key twice is ambiguous.
+	dup := msgp.AppendMapHeader(nil, 2)
+	dup = msgp.AppendString(dup, "Name")
+	dup = msgp.AppendString(dup, "a")
+	dup = msgp.AppendString(dup, "Name")
+	dup = msgp.AppendString(dup, "b")
+	_, err = out.UnmarshalMsg(dup)
+	if verr, ok := err.(*msgp.ValidationError); !ok || verr.Check != msgp.RejectDuplicateKeys {
+		t.Errorf("expected a duplicate key error; got %v", err)
+	}
+
+	// An integer that is not minimally encoded.
+	wide := msgp.AppendMapHeader(nil, 1)
+	wide = msgp.AppendString(wide, "Count")
+	wide = append(wide, 0xd3, 0, 0, 0, 0, 0, 0, 0, 1)
+	_, err = out.UnmarshalMsg(wide)
+	if verr, ok := err.(*msgp.ValidationError); !ok || verr.Check != msgp.RejectNonMinimal {
+		t.Errorf("expected a non-minimal encoding error; got %v", err)
+	}
+
+	// Types without the directive are not validated.
+	var loose Strict
+	if _, err = loose.UnmarshalMsg(wide); err != nil {
+		t.Error(err)
+	}
+}